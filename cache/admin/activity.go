@@ -0,0 +1,90 @@
+package admin
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxLastMessage bounds the bytes of the last message kept per channel.
+const maxLastMessage = 256
+
+// ChannelActivity is the traffic of a pub/sub channel since the handler started.
+type ChannelActivity struct {
+	Channel  string `json:"channel"`
+	Messages uint64 `json:"messages"`
+	Bytes    uint64 `json:"bytes"`
+	// LastMessage is the last message received, truncated to 256 bytes.
+	LastMessage   string    `json:"last_message"`
+	LastMessageAt time.Time `json:"last_message_at"`
+}
+
+type channelsResponse struct {
+	Since    time.Time         `json:"since"`
+	Channels []ChannelActivity `json:"channels"`
+	// Untracked counts the messages of the channels beyond Options.MaxChannels.
+	Untracked uint64 `json:"untracked"`
+	// Error is why the channels cannot be tracked, or the error the subscription last failed with.
+	Error string `json:"error,omitempty"`
+}
+
+// activity records the messages of the channels, keyed by channel.
+type activity struct {
+	max   int
+	since time.Time
+
+	mu        sync.Mutex
+	channels  map[string]*ChannelActivity
+	untracked uint64
+	err       error
+}
+
+func newActivity(max int) *activity {
+	return &activity{max: max, since: time.Now(), channels: make(map[string]*ChannelActivity)}
+}
+
+func (a *activity) record(channel, message string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c, has := a.channels[channel]
+	if !has {
+		if len(a.channels) >= a.max {
+			a.untracked++
+			return
+		}
+		c = &ChannelActivity{Channel: channel}
+		a.channels[channel] = c
+	}
+	c.Messages++
+	c.Bytes += uint64(len(message))
+	if len(message) > maxLastMessage {
+		message = message[:maxLastMessage]
+	}
+	c.LastMessage = message
+	c.LastMessageAt = time.Now()
+}
+
+func (a *activity) fail(err error) {
+	a.mu.Lock()
+	a.err = err
+	a.mu.Unlock()
+}
+
+// report returns the activity of the channels, sorted by channel.
+func (a *activity) report() *channelsResponse {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r := &channelsResponse{
+		Since:     a.since,
+		Channels:  make([]ChannelActivity, 0, len(a.channels)),
+		Untracked: a.untracked,
+	}
+	for _, c := range a.channels {
+		r.Channels = append(r.Channels, *c)
+	}
+	sort.Slice(r.Channels, func(i, j int) bool { return r.Channels[i].Channel < r.Channels[j].Channel })
+	if a.err != nil {
+		r.Error = a.err.Error()
+	}
+	return r
+}
@@ -0,0 +1,436 @@
+// Package admin serves an HTTP API to inspect and repair a cache chain, meant
+// to be mounted on an internal port:
+//
+//	h := admin.NewHandler(c)
+//	defer h.Close()
+//	http.Handle("/debug/cache/", http.StripPrefix("/debug/cache", h))
+//
+// Every response is JSON:
+//
+//	GET    /stats                           the stats of every level, lowest first
+//	GET    /channels                        the pub/sub channels seen since the handler started
+//	GET    /keys?prefix=&cursor=&limit=     a page of keys, read like Scan, of one level with level=
+//	DELETE /keys?prefix=                    deletes the keys with prefix from every level
+//	GET    /key?key=                        the value of key in every level, with its metadata
+//	DELETE /key?key=                        deletes key from every level
+package admin
+
+import (
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/cache/breaker"
+	"github.com/motclub/common/json"
+	"github.com/pkg/errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrKeyRequired    = errors.New(`mot: cache key required`)
+	ErrPrefixRequired = errors.New(`mot: cache key prefix required`)
+	ErrKeyNotFound    = errors.New(`mot: cache key not found`)
+	ErrInvalidLevel   = errors.New(`mot: invalid cache level`)
+	ErrInvalidLimit   = errors.New(`mot: invalid cache page limit`)
+	ErrReadOnly       = errors.New(`mot: cache admin is read-only`)
+)
+
+type Options struct {
+	// ReadOnly rejects the deletions with 403 Forbidden.
+	ReadOnly bool `json:"read_only"`
+	// PageSize is the number of keys listed when the request sets no limit, 100 by default.
+	PageSize int `json:"page_size"`
+	// MaxPageSize bounds the limit a request may set, 1000 by default.
+	MaxPageSize int `json:"max_page_size"`
+	// Channels are the patterns of the pub/sub channels whose activity is tracked, every channel by default.
+	Channels []string `json:"channels"`
+	// MaxChannels bounds the channels tracked, 1000 by default. The messages
+	// of the channels beyond it are only counted as untracked.
+	MaxChannels int `json:"max_channels"`
+}
+
+func resolveOptions(options []*Options) *Options {
+	var o Options
+	if len(options) > 0 && options[0] != nil {
+		o = *options[0]
+	}
+	if o.PageSize <= 0 {
+		o.PageSize = 100
+	}
+	if o.MaxPageSize <= 0 {
+		o.MaxPageSize = 1000
+	}
+	if o.PageSize > o.MaxPageSize {
+		o.PageSize = o.MaxPageSize
+	}
+	if len(o.Channels) == 0 {
+		o.Channels = []string{"*"}
+	}
+	if o.MaxChannels <= 0 {
+		o.MaxChannels = 1000
+	}
+	return &o
+}
+
+// Handler serves the admin API of a cache chain.
+type Handler struct {
+	c        cache.ICache
+	options  *Options
+	mux      *http.ServeMux
+	channels *activity
+	sub      cache.ISubscription
+}
+
+// NewHandler serves the chain of c, the lowest level as cache.NewCache returns
+// it, and starts tracking the activity of its pub/sub channels. A failure to
+// subscribe is reported by /channels rather than returned, so that the handler
+// stays available while the parent level is down.
+func NewHandler(c cache.ICache, options ...*Options) *Handler {
+	o := resolveOptions(options)
+	h := &Handler{
+		c:        c,
+		options:  o,
+		mux:      http.NewServeMux(),
+		channels: newActivity(o.MaxChannels),
+	}
+	sub, err := c.PSubscribe(o.Channels, h.channels.record)
+	if err != nil {
+		h.channels.fail(err)
+	} else {
+		h.sub = sub
+	}
+	h.mux.HandleFunc("/stats", h.serveStats)
+	h.mux.HandleFunc("/channels", h.serveChannels)
+	h.mux.HandleFunc("/keys", h.serveKeys)
+	h.mux.HandleFunc("/key", h.serveKey)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// Close stops tracking the pub/sub channels, it does not close the cache.
+func (h *Handler) Close() error {
+	if h.sub != nil {
+		return h.sub.Close()
+	}
+	return nil
+}
+
+// levels returns the levels of the chain, lowest first.
+func (h *Handler) levels() []cache.ICache {
+	var levels []cache.ICache
+	for c := h.c; c != nil; c = c.Parent() {
+		levels = append(levels, c)
+	}
+	return levels
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.STD().NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch errors.Cause(err) {
+	case ErrKeyRequired, ErrPrefixRequired, ErrInvalidLevel, ErrInvalidLimit, cache.ErrInvalidCursor:
+		status = http.StatusBadRequest
+	case ErrKeyNotFound:
+		status = http.StatusNotFound
+	case ErrReadOnly:
+		status = http.StatusForbidden
+	}
+	writeJSON(w, status, &errorResponse{Error: err.Error()})
+}
+
+// allow answers 405 Method Not Allowed unless r uses one of methods.
+func allow(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeJSON(w, http.StatusMethodNotAllowed, &errorResponse{Error: "mot: method not allowed"})
+	return false
+}
+
+// opLatency is the latency histogram of an operation. Stats keeps them in a
+// map, listed here sorted by operation for a stable output.
+type opLatency struct {
+	Op string `json:"op"`
+	cache.Histogram
+}
+
+type levelStats struct {
+	Index int `json:"index"`
+	cache.Stats
+	Latency []opLatency `json:"latency"`
+	// Circuit is the health of a level guarded by a circuit breaker.
+	Circuit *breaker.Health `json:"circuit,omitempty"`
+}
+
+func (h *Handler) serveStats(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	levels := h.levels()
+	stats := make([]levelStats, len(levels))
+	for i, level := range levels {
+		s := levelStats{Index: i, Stats: level.Stats()}
+		for op, histogram := range s.Stats.Latency {
+			s.Latency = append(s.Latency, opLatency{Op: op, Histogram: histogram})
+		}
+		sort.Slice(s.Latency, func(i, j int) bool { return s.Latency[i].Op < s.Latency[j].Op })
+		s.Stats.Latency = nil
+		if b, ok := level.(breaker.IBreakerCache); ok {
+			health := b.Health()
+			s.Circuit = &health
+		}
+		stats[i] = s
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (h *Handler) serveChannels(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	report := h.channels.report()
+	if h.sub != nil {
+		if err := h.sub.Err(); err != nil {
+			report.Error = err.Error()
+		}
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// keyInfo describes a key of a listing.
+type keyInfo struct {
+	Key string `json:"key"`
+	// TTL is the remaining time to live in milliseconds, 0 means no expiration.
+	TTL   int64  `json:"ttl"`
+	Codec string `json:"codec"`
+	Size  int    `json:"size"`
+}
+
+type keysResponse struct {
+	Keys []keyInfo `json:"keys"`
+	// Cursor reads the next page, empty after the last one.
+	Cursor string `json:"cursor"`
+}
+
+type deleteResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+func (h *Handler) serveKeys(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet, http.MethodDelete) {
+		return
+	}
+	q := r.URL.Query()
+	prefix := q.Get("prefix")
+	if r.Method == http.MethodDelete {
+		n, err := h.deletePrefix(prefix)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, &deleteResponse{Deleted: n})
+		return
+	}
+
+	limit := h.options.PageSize
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			writeError(w, ErrInvalidLimit)
+			return
+		}
+		if limit = n; limit > h.options.MaxPageSize {
+			limit = h.options.MaxPageSize
+		}
+	}
+	c := h.c
+	if s := q.Get("level"); s != "" {
+		levels := h.levels()
+		i, err := strconv.Atoi(s)
+		if err != nil || i < 0 || i >= len(levels) {
+			writeError(w, ErrInvalidLevel)
+			return
+		}
+		c = levels[i].Local()
+	}
+	items, next, err := c.Scan(prefix, q.Get("cursor"), limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	keys := make([]keyInfo, len(items))
+	for i, item := range items {
+		keys[i] = keyInfo{Key: item.Key, TTL: ttl(item.TTL), Codec: codec(item.Codec), Size: len(item.Value)}
+	}
+	writeJSON(w, http.StatusOK, &keysResponse{Keys: keys, Cursor: next})
+}
+
+// deletePrefix deletes the keys with prefix found in any level, including the
+// copies left in a child level only, and returns how many it found.
+func (h *Handler) deletePrefix(prefix string) (int, error) {
+	if h.options.ReadOnly {
+		return 0, ErrReadOnly
+	}
+	if prefix == "" {
+		return 0, ErrPrefixRequired
+	}
+	found := make(map[string]bool)
+	for _, level := range h.levels() {
+		local := level.Local()
+		cursor := ""
+		for {
+			items, next, err := local.Scan(prefix, cursor, h.options.MaxPageSize)
+			if err != nil {
+				return 0, err
+			}
+			for _, item := range items {
+				found[item.Key] = true
+			}
+			if cursor = next; cursor == "" {
+				break
+			}
+		}
+	}
+	keys := make([]string, 0, len(found))
+	for key := range found {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for start := 0; start < len(keys); start += h.options.MaxPageSize {
+		end := start + h.options.MaxPageSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		if err := h.del(keys[start:end]...); err != nil {
+			return start, err
+		}
+	}
+	return len(keys), nil
+}
+
+// del deletes keys from every level: from the lowest one, which propagates the
+// deletion up the chain, then from the local view of each level, which clears
+// the copies a level failing to propagate may have left.
+func (h *Handler) del(keys ...string) error {
+	if err := h.c.Del(keys...); err != nil {
+		return err
+	}
+	for _, level := range h.levels() {
+		if err := level.Local().Del(keys...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// levelValue is the value of a key in a level, with the metadata of its envelope.
+type levelValue struct {
+	Index int    `json:"index"`
+	Level string `json:"level"`
+	Found bool   `json:"found"`
+	// TTL is the remaining time to live in milliseconds, 0 means no expiration.
+	TTL       int64      `json:"ttl"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Codec     string     `json:"codec,omitempty"`
+	Size      int        `json:"size"`
+	// Value is the value when it is JSON, Data its encoded bytes otherwise.
+	Value json.RawMessage `json:"value,omitempty"`
+	Data  []byte          `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+type keyResponse struct {
+	Key    string       `json:"key"`
+	Levels []levelValue `json:"levels"`
+}
+
+func (h *Handler) serveKey(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet, http.MethodDelete) {
+		return
+	}
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		writeError(w, ErrKeyRequired)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		if h.options.ReadOnly {
+			writeError(w, ErrReadOnly)
+			return
+		}
+		n := 0
+		if h.c.Has(key) {
+			n = 1
+		}
+		if err := h.del(key); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, &deleteResponse{Deleted: n})
+		return
+	}
+
+	resp := keyResponse{Key: key}
+	found := false
+	now := time.Now()
+	for i, level := range h.levels() {
+		v := levelValue{Index: i, Level: level.Stats().Level}
+		items, err := level.Local().MGet(key)
+		if err != nil {
+			v.Error = err.Error()
+		} else if item, has := items[key]; has {
+			found = true
+			v.Found = true
+			v.TTL = ttl(item.TTL)
+			if item.TTL > 0 {
+				at := now.Add(item.TTL)
+				v.ExpiresAt = &at
+			}
+			v.Codec = codec(item.Codec)
+			v.Size = len(item.Value)
+			if v.Codec == cache.CodecJSON && json.STD().Valid(item.Value) {
+				v.Value = item.Value
+			} else {
+				v.Data = item.Value
+			}
+		}
+		resp.Levels = append(resp.Levels, v)
+	}
+	if !found {
+		writeError(w, ErrKeyNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, &resp)
+}
+
+// ttl returns d in milliseconds, keeping a positive TTL below a millisecond positive.
+func ttl(d time.Duration) int64 {
+	ms := d.Milliseconds()
+	if d > 0 && ms == 0 {
+		ms = 1
+	}
+	return ms
+}
+
+func codec(name string) string {
+	if name == "" {
+		return cache.CodecJSON
+	}
+	return name
+}
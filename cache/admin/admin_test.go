@@ -0,0 +1,169 @@
+package admin
+
+import (
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/cache/memory"
+	"github.com/motclub/common/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// newTestChain returns a chain of two memory levels, lowest first.
+func newTestChain(t *testing.T) (cache.ICache, cache.ICache) {
+	child, err := memory.NewMemoryCache()
+	assert.Nil(t, err)
+	parent, err := memory.NewMemoryCache()
+	assert.Nil(t, err)
+	c, err := cache.NewCache([]cache.ICache{child, parent})
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_ = child.Close()
+		_ = parent.Close()
+	})
+	return c, parent
+}
+
+func do(t *testing.T, h http.Handler, method, path string, dst interface{}) int {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	if dst != nil {
+		assert.Nil(t, json.STD().Unmarshal(w.Body.Bytes(), dst), w.Body.String())
+	}
+	return w.Code
+}
+
+func TestHandler_Keys(t *testing.T) {
+	c, parent := newTestChain(t)
+	h := NewHandler(c)
+	defer h.Close()
+
+	assert.Nil(t, c.Set("user:1", "a", time.Minute))
+	assert.Nil(t, c.Set("user:2", "b"))
+	assert.Nil(t, c.Set("order:1", "c"))
+
+	var (
+		keys   []string
+		cursor string
+	)
+	for i := 0; i < 10; i++ {
+		var resp keysResponse
+		assert.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/keys?prefix=user:&limit=1&cursor="+url.QueryEscape(cursor), &resp))
+		for _, key := range resp.Keys {
+			keys = append(keys, key.Key)
+			assert.Equal(t, cache.CodecJSON, key.Codec)
+		}
+		if cursor = resp.Cursor; cursor == "" {
+			break
+		}
+	}
+	assert.ElementsMatch(t, []string{"user:1", "user:2"}, keys)
+
+	// a level can be listed on its own
+	assert.Nil(t, parent.Set("parent-only", 1))
+	var resp keysResponse
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/keys?prefix=parent&level=0", &resp))
+	assert.Len(t, resp.Keys, 0)
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/keys?prefix=parent&level=1", &resp))
+	assert.Len(t, resp.Keys, 1)
+
+	var e errorResponse
+	assert.Equal(t, http.StatusBadRequest, do(t, h, http.MethodGet, "/keys?level=2", &e))
+	assert.Equal(t, ErrInvalidLevel.Error(), e.Error)
+	assert.Equal(t, http.StatusBadRequest, do(t, h, http.MethodGet, "/keys?limit=x", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, do(t, h, http.MethodPost, "/keys", nil))
+}
+
+func TestHandler_Key(t *testing.T) {
+	c, parent := newTestChain(t)
+	h := NewHandler(c)
+	defer h.Close()
+
+	assert.Nil(t, parent.Set("k", struct {
+		A int `json:"a"`
+	}{A: 1}, time.Minute))
+	var resp keyResponse
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/key?key=k", &resp))
+	if assert.Len(t, resp.Levels, 2) {
+		assert.False(t, resp.Levels[0].Found)
+		assert.Equal(t, "memory", resp.Levels[1].Level)
+		assert.True(t, resp.Levels[1].Found)
+		assert.Equal(t, `{"a":1}`, string(resp.Levels[1].Value))
+		assert.True(t, resp.Levels[1].TTL > 0 && resp.Levels[1].TTL <= time.Minute.Milliseconds())
+		assert.NotNil(t, resp.Levels[1].ExpiresAt)
+	}
+
+	assert.Equal(t, http.StatusNotFound, do(t, h, http.MethodGet, "/key?key=missing", nil))
+	assert.Equal(t, http.StatusBadRequest, do(t, h, http.MethodGet, "/key", nil))
+}
+
+func TestHandler_Delete(t *testing.T) {
+	c, parent := newTestChain(t)
+	h := NewHandler(c)
+	defer h.Close()
+
+	assert.Nil(t, c.Set("a", 1))
+	var del deleteResponse
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodDelete, "/key?key=a", &del))
+	assert.Equal(t, 1, del.Deleted)
+	assert.False(t, c.Local().Has("a"))
+	assert.False(t, parent.Has("a"))
+
+	// copies left in a child level only are deleted as well
+	assert.Nil(t, c.Set("p:1", 1))
+	assert.Nil(t, c.Set("p:2", 2))
+	assert.Nil(t, c.Local().Set("p:stale", 3))
+	assert.Nil(t, c.Set("q:1", 4))
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodDelete, "/keys?prefix=p:", &del))
+	assert.Equal(t, 3, del.Deleted)
+	for _, key := range []string{"p:1", "p:2", "p:stale"} {
+		assert.False(t, c.Local().Has(key))
+		assert.False(t, parent.Has(key))
+	}
+	assert.True(t, c.Has("q:1"))
+	assert.Equal(t, http.StatusBadRequest, do(t, h, http.MethodDelete, "/keys", nil))
+
+	ro := NewHandler(c, &Options{ReadOnly: true})
+	defer ro.Close()
+	assert.Equal(t, http.StatusForbidden, do(t, ro, http.MethodDelete, "/key?key=q:1", nil))
+	assert.Equal(t, http.StatusForbidden, do(t, ro, http.MethodDelete, "/keys?prefix=q:", nil))
+	assert.True(t, c.Has("q:1"))
+}
+
+func TestHandler_StatsAndChannels(t *testing.T) {
+	c, _ := newTestChain(t)
+	h := NewHandler(c, &Options{MaxChannels: 1})
+	defer h.Close()
+
+	assert.Nil(t, c.Set("a", 1))
+	assert.Equal(t, 1, c.GetInt("a"))
+	var stats []levelStats
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/stats", &stats))
+	if assert.Len(t, stats, 2) {
+		assert.Equal(t, 1, stats[1].Index)
+		assert.Equal(t, "memory", stats[0].Level)
+		assert.Equal(t, uint64(1), stats[0].Hits)
+		assert.NotEmpty(t, stats[0].Latency)
+		assert.Nil(t, stats[0].Circuit)
+	}
+
+	assert.Nil(t, c.Publish("news", "hello"))
+	assert.Nil(t, c.Publish("other", "ignored"))
+	var channels channelsResponse
+	for i := 0; i < 100; i++ {
+		do(t, h, http.MethodGet, "/channels", &channels)
+		if len(channels.Channels) == 1 && channels.Untracked == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if assert.Len(t, channels.Channels, 1) {
+		assert.Equal(t, "news", channels.Channels[0].Channel)
+		assert.Equal(t, uint64(1), channels.Channels[0].Messages)
+		assert.Equal(t, "hello", channels.Channels[0].LastMessage)
+	}
+	assert.Equal(t, uint64(1), channels.Untracked)
+}
@@ -0,0 +1,878 @@
+package breaker
+
+import (
+	"context"
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/json"
+	"github.com/motclub/common/logging"
+	"time"
+)
+
+// IBreakerCache guards a parent cache level, such as Redis, with a circuit
+// breaker. Once Threshold consecutive calls failed, the circuit opens: reads
+// are served by the local levels alone, writes are queued for replay, and the
+// operations only the parent level can decide, such as Incr, Lock or SetNX,
+// fail with ErrCircuitOpen. After RetryTimeout, and once the parent answers
+// its pings when it can be pinged, the child levels are evicted, the queued
+// writes replayed, and the circuit closes again.
+type IBreakerCache interface {
+	cache.ICache
+	// State returns StateClosed, StateOpen or StateHalfOpen.
+	State() string
+	Health() Health
+}
+
+type Options struct {
+	// Threshold is the number of consecutive failures that opens the circuit, 5 by default.
+	Threshold int `json:"threshold"`
+	// RetryTimeout is how long the circuit stays open before recovering, 5s by default.
+	RetryTimeout time.Duration `json:"retry_timeout"`
+	// ProbeInterval is how often the parent level is pinged, when it is a cache.IPinger,
+	// and the circuit checked for recovery, 1s by default.
+	ProbeInterval time.Duration `json:"probe_interval"`
+	// MaxQueue bounds the writes queued while the circuit is open, 1000 by default.
+	// Writes beyond it fail with ErrReplayQueueFull.
+	MaxQueue int `json:"max_queue"`
+	// IsFailure reports whether an error means the parent level is unavailable, IsUnavailable by default.
+	IsFailure func(err error) bool `json:"-"`
+	// OnStateChange is called as the circuit moves from one state to another.
+	OnStateChange func(from, to string) `json:"-"`
+	// Logger logs the state changes, logging.DefaultLogger by default.
+	Logger logging.ILogger `json:"-"`
+}
+
+func resolveOptions(options []*Options) *Options {
+	var o Options
+	if len(options) > 0 && options[0] != nil {
+		o = *options[0]
+	}
+	if o.Threshold <= 0 {
+		o.Threshold = 5
+	}
+	if o.RetryTimeout <= 0 {
+		o.RetryTimeout = 5 * time.Second
+	}
+	if o.ProbeInterval <= 0 {
+		o.ProbeInterval = time.Second
+	}
+	if o.MaxQueue <= 0 {
+		o.MaxQueue = 1000
+	}
+	if o.IsFailure == nil {
+		o.IsFailure = IsUnavailable
+	}
+	if o.Logger == nil {
+		o.Logger = logging.DefaultLogger
+	}
+	return &o
+}
+
+// NewBreakerCache guards c, to be used as the parent level of a cache.NewCache chain.
+func NewBreakerCache(c cache.ICache, options ...*Options) IBreakerCache {
+	return newBreakerCache(c, newCircuit(c, resolveOptions(options)))
+}
+
+type breakerCache struct {
+	c       cache.ICache
+	circuit *circuit
+}
+
+func newBreakerCache(c cache.ICache, circuit *circuit) *breakerCache {
+	return &breakerCache{c: c, circuit: circuit}
+}
+
+func (b *breakerCache) State() string {
+	return b.circuit.health().State
+}
+
+func (b *breakerCache) Health() Health {
+	return b.circuit.health()
+}
+
+// call runs fn against the parent level unless the circuit is open, recording its outcome.
+func (b *breakerCache) call(fn func() error) error {
+	if !b.circuit.allow() {
+		return ErrCircuitOpen
+	}
+	err := fn()
+	b.circuit.record(err)
+	return err
+}
+
+// read is call for the reads the local levels can serve alone: it reports
+// false when the parent level is unavailable instead of an error.
+func (b *breakerCache) read(fn func() error) (bool, error) {
+	err := b.call(fn)
+	if err == ErrCircuitOpen || (err != nil && b.circuit.options.IsFailure(err)) {
+		return false, nil
+	}
+	return true, err
+}
+
+// write runs w against the parent level, queuing it for replay while the
+// circuit is open or the parent level fails.
+func (b *breakerCache) write(w write) error {
+	if b.circuit.allow() {
+		err := w(b.c)
+		if !b.circuit.record(err) {
+			return err
+		}
+	}
+	return b.circuit.enqueue(w)
+}
+
+// answered records a call of the parent level that found key as a success.
+// Has, HasGet and TTL report no error, so not finding key proves nothing.
+func (b *breakerCache) answered(found bool) bool {
+	if found {
+		b.circuit.record(nil)
+	}
+	return found
+}
+
+func (b *breakerCache) Has(key string) bool {
+	return b.circuit.allow() && b.answered(b.c.Has(key))
+}
+
+func (b *breakerCache) HasGet(key string, dst interface{}) bool {
+	return b.circuit.allow() && b.answered(b.c.HasGet(key, dst))
+}
+
+func (b *breakerCache) HasGetInt(key string) (int, bool) {
+	var v int
+	has := b.HasGet(key, &v)
+	return v, has
+}
+
+func (b *breakerCache) HasGetFloat(key string) (float64, bool) {
+	var v float64
+	has := b.HasGet(key, &v)
+	return v, has
+}
+
+func (b *breakerCache) HasGetString(key string) (string, bool) {
+	var v string
+	has := b.HasGet(key, &v)
+	return v, has
+}
+
+func (b *breakerCache) HasGetBool(key string) (bool, bool) {
+	var v bool
+	has := b.HasGet(key, &v)
+	return v, has
+}
+
+func (b *breakerCache) HasGetTime(key string) (time.Time, bool) {
+	var v time.Time
+	has := b.HasGet(key, &v)
+	return v, has
+}
+
+func (b *breakerCache) HasGetInt8(key string) (int8, bool) {
+	v, has := b.HasGetInt(key)
+	return int8(v), has
+}
+
+func (b *breakerCache) HasGetInt16(key string) (int16, bool) {
+	v, has := b.HasGetInt(key)
+	return int16(v), has
+}
+
+func (b *breakerCache) HasGetInt32(key string) (int32, bool) {
+	v, has := b.HasGetInt(key)
+	return int32(v), has
+}
+
+func (b *breakerCache) HasGetInt64(key string) (int64, bool) {
+	v, has := b.HasGetInt(key)
+	return int64(v), has
+}
+
+func (b *breakerCache) HasGetUint(key string) (uint, bool) {
+	v, has := b.HasGetInt(key)
+	return uint(v), has
+}
+
+func (b *breakerCache) HasGetUint8(key string) (uint8, bool) {
+	v, has := b.HasGetInt(key)
+	return uint8(v), has
+}
+
+func (b *breakerCache) HasGetUint16(key string) (uint16, bool) {
+	v, has := b.HasGetInt(key)
+	return uint16(v), has
+}
+
+func (b *breakerCache) HasGetUint32(key string) (uint32, bool) {
+	v, has := b.HasGetInt(key)
+	return uint32(v), has
+}
+
+func (b *breakerCache) HasGetUint64(key string) (uint64, bool) {
+	v, has := b.HasGetInt(key)
+	return uint64(v), has
+}
+
+func (b *breakerCache) HasGetFloat32(key string) (float32, bool) {
+	v, has := b.HasGetFloat(key)
+	return float32(v), has
+}
+
+func (b *breakerCache) HasGetFloat64(key string) (float64, bool) {
+	return b.HasGetFloat(key)
+}
+
+func (b *breakerCache) Get(key string, dst interface{}) {
+	_ = b.HasGet(key, dst)
+}
+
+func (b *breakerCache) GetInt(key string) int {
+	v, _ := b.HasGetInt(key)
+	return v
+}
+
+func (b *breakerCache) GetInt8(key string) int8 {
+	v, _ := b.HasGetInt8(key)
+	return v
+}
+
+func (b *breakerCache) GetInt16(key string) int16 {
+	v, _ := b.HasGetInt16(key)
+	return v
+}
+
+func (b *breakerCache) GetInt32(key string) int32 {
+	v, _ := b.HasGetInt32(key)
+	return v
+}
+
+func (b *breakerCache) GetInt64(key string) int64 {
+	v, _ := b.HasGetInt64(key)
+	return v
+}
+
+func (b *breakerCache) GetUint(key string) uint {
+	v, _ := b.HasGetUint(key)
+	return v
+}
+
+func (b *breakerCache) GetUint8(key string) uint8 {
+	v, _ := b.HasGetUint8(key)
+	return v
+}
+
+func (b *breakerCache) GetUint16(key string) uint16 {
+	v, _ := b.HasGetUint16(key)
+	return v
+}
+
+func (b *breakerCache) GetUint32(key string) uint32 {
+	v, _ := b.HasGetUint32(key)
+	return v
+}
+
+func (b *breakerCache) GetUint64(key string) uint64 {
+	v, _ := b.HasGetUint64(key)
+	return v
+}
+
+func (b *breakerCache) GetFloat(key string) float64 {
+	v, _ := b.HasGetFloat(key)
+	return v
+}
+
+func (b *breakerCache) GetFloat32(key string) float32 {
+	v, _ := b.HasGetFloat32(key)
+	return v
+}
+
+func (b *breakerCache) GetFloat64(key string) float64 {
+	v, _ := b.HasGetFloat64(key)
+	return v
+}
+
+func (b *breakerCache) GetString(key string) string {
+	v, _ := b.HasGetString(key)
+	return v
+}
+
+func (b *breakerCache) GetBool(key string) bool {
+	v, _ := b.HasGetBool(key)
+	return v
+}
+
+func (b *breakerCache) GetTime(key string) time.Time {
+	v, _ := b.HasGetTime(key)
+	return v
+}
+
+func (b *breakerCache) DefaultGet(key string, dst interface{}, defaultValue interface{}) {
+	if !b.HasGet(key, dst) {
+		_ = json.Copy(defaultValue, dst)
+	}
+}
+
+func (b *breakerCache) DefaultGetInt(key string, defaultValue int) int {
+	if v, has := b.HasGetInt(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (b *breakerCache) DefaultGetInt8(key string, defaultValue int8) int8 {
+	if v, has := b.HasGetInt8(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (b *breakerCache) DefaultGetInt16(key string, defaultValue int16) int16 {
+	if v, has := b.HasGetInt16(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (b *breakerCache) DefaultGetInt32(key string, defaultValue int32) int32 {
+	if v, has := b.HasGetInt32(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (b *breakerCache) DefaultGetInt64(key string, defaultValue int64) int64 {
+	if v, has := b.HasGetInt64(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (b *breakerCache) DefaultGetUint(key string, defaultValue uint) uint {
+	if v, has := b.HasGetUint(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (b *breakerCache) DefaultGetUint8(key string, defaultValue uint8) uint8 {
+	if v, has := b.HasGetUint8(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (b *breakerCache) DefaultGetUint16(key string, defaultValue uint16) uint16 {
+	if v, has := b.HasGetUint16(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (b *breakerCache) DefaultGetUint32(key string, defaultValue uint32) uint32 {
+	if v, has := b.HasGetUint32(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (b *breakerCache) DefaultGetUint64(key string, defaultValue uint64) uint64 {
+	if v, has := b.HasGetUint64(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (b *breakerCache) DefaultGetFloat(key string, defaultValue float64) float64 {
+	if v, has := b.HasGetFloat(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (b *breakerCache) DefaultGetFloat32(key string, defaultValue float32) float32 {
+	if v, has := b.HasGetFloat32(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (b *breakerCache) DefaultGetFloat64(key string, defaultValue float64) float64 {
+	if v, has := b.HasGetFloat64(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (b *breakerCache) DefaultGetString(key string, defaultValue string) string {
+	if v, has := b.HasGetString(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (b *breakerCache) DefaultGetBool(key string, defaultValue bool) bool {
+	if v, has := b.HasGetBool(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (b *breakerCache) DefaultGetTime(key string, defaultValue time.Time) time.Time {
+	if v, has := b.HasGetTime(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (b *breakerCache) TTL(key string) (time.Duration, bool) {
+	if !b.circuit.allow() {
+		return 0, false
+	}
+	ttl, has := b.c.TTL(key)
+	return ttl, b.answered(has)
+}
+
+func (b *breakerCache) Set(key string, value interface{}, expiration ...time.Duration) error {
+	return b.write(func(c cache.ICache) error {
+		return c.Set(key, value, expiration...)
+	})
+}
+
+func (b *breakerCache) MGet(keys ...string) (map[string]*cache.Item, error) {
+	var items map[string]*cache.Item
+	ok, err := b.read(func() (err error) {
+		items, err = b.c.MGet(keys...)
+		return err
+	})
+	if !ok {
+		return make(map[string]*cache.Item), nil
+	}
+	return items, err
+}
+
+func (b *breakerCache) MSet(values map[string]interface{}, expiration ...time.Duration) error {
+	return b.write(func(c cache.ICache) error {
+		return c.MSet(values, expiration...)
+	})
+}
+
+func (b *breakerCache) SetItems(items ...*cache.Item) error {
+	return b.write(func(c cache.ICache) error {
+		return cache.SetItems(c, items...)
+	})
+}
+
+func (b *breakerCache) SetNX(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	var ok bool
+	err := b.call(func() (err error) {
+		ok, err = b.c.SetNX(key, value, expiration...)
+		return err
+	})
+	return ok, err
+}
+
+func (b *breakerCache) SetXX(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	var ok bool
+	err := b.call(func() (err error) {
+		ok, err = b.c.SetXX(key, value, expiration...)
+		return err
+	})
+	return ok, err
+}
+
+func (b *breakerCache) GetSet(key string, value interface{}, dst interface{}) (bool, error) {
+	var has bool
+	err := b.call(func() (err error) {
+		has, err = b.c.GetSet(key, value, dst)
+		return err
+	})
+	return has, err
+}
+
+func (b *breakerCache) CompareAndSwap(key string, old, value interface{}, expiration ...time.Duration) (bool, error) {
+	var ok bool
+	err := b.call(func() (err error) {
+		ok, err = b.c.CompareAndSwap(key, old, value, expiration...)
+		return err
+	})
+	return ok, err
+}
+
+func (b *breakerCache) Expire(key string, ttl time.Duration) (bool, error) {
+	var has bool
+	err := b.call(func() (err error) {
+		has, err = b.c.Expire(key, ttl)
+		return err
+	})
+	return has, err
+}
+
+func (b *breakerCache) ExpireAt(key string, at time.Time) (bool, error) {
+	return b.Expire(key, time.Until(at))
+}
+
+func (b *breakerCache) Persist(key string) (bool, error) {
+	var has bool
+	err := b.call(func() (err error) {
+		has, err = b.c.Persist(key)
+		return err
+	})
+	return has, err
+}
+
+func (b *breakerCache) Touch(key string) (bool, error) {
+	var has bool
+	err := b.call(func() (err error) {
+		has, err = b.c.Touch(key)
+		return err
+	})
+	return has, err
+}
+
+func (b *breakerCache) SetWithTags(key string, value interface{}, tags []string, expiration ...time.Duration) error {
+	return b.write(func(c cache.ICache) error {
+		return c.SetWithTags(key, value, tags, expiration...)
+	})
+}
+
+func (b *breakerCache) InvalidateTags(tags ...string) error {
+	return b.write(func(c cache.ICache) error {
+		return c.InvalidateTags(tags...)
+	})
+}
+
+func (b *breakerCache) GetOrLoad(key string, dst interface{}, ttl time.Duration, loader cache.LoaderFunc) error {
+	return cache.GetOrLoad(b, key, dst, ttl, loader)
+}
+
+func (b *breakerCache) HasPrefix(s string, limit ...int) (map[string]string, error) {
+	return b.values(func() (map[string]string, error) {
+		return b.c.HasPrefix(s, limit...)
+	})
+}
+
+func (b *breakerCache) HasSuffix(s string, limit ...int) (map[string]string, error) {
+	return b.values(func() (map[string]string, error) {
+		return b.c.HasSuffix(s, limit...)
+	})
+}
+
+func (b *breakerCache) Contains(s string, limit ...int) (map[string]string, error) {
+	return b.values(func() (map[string]string, error) {
+		return b.c.Contains(s, limit...)
+	})
+}
+
+// values runs a key scan, which finds nothing while the parent level is unavailable.
+func (b *breakerCache) values(fn func() (map[string]string, error)) (map[string]string, error) {
+	var found map[string]string
+	ok, err := b.read(func() (err error) {
+		found, err = fn()
+		return err
+	})
+	if !ok {
+		return make(map[string]string), nil
+	}
+	return found, err
+}
+
+// Scan scans the parent level, or the child level right below it while the
+// parent level is unavailable.
+func (b *breakerCache) Scan(prefix, cursor string, limit int) ([]*cache.Item, string, error) {
+	var (
+		items []*cache.Item
+		next  string
+	)
+	ok, err := b.read(func() (err error) {
+		items, next, err = b.c.Scan(prefix, cursor, limit)
+		return err
+	})
+	if ok {
+		return items, next, err
+	}
+	if child := b.c.Children(); child != nil {
+		return child.Local().Scan(prefix, cursor, limit)
+	}
+	return nil, "", ErrCircuitOpen
+}
+
+func (b *breakerCache) Lock(key string, ttl time.Duration) (cache.ILock, error) {
+	var lock cache.ILock
+	err := b.call(func() (err error) {
+		lock, err = b.c.Lock(key, ttl)
+		return err
+	})
+	return lock, err
+}
+
+// Scripter runs scripts on the scripter of the parent level, failing with
+// ErrCircuitOpen while the circuit is open.
+func (b *breakerCache) Scripter() (cache.IScripter, bool) {
+	s, ok := cache.Scripter(b.c)
+	if !ok {
+		return nil, false
+	}
+	return &scripter{s: s, b: b}, true
+}
+
+type scripter struct {
+	s cache.IScripter
+	b *breakerCache
+}
+
+func (s *scripter) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	var v interface{}
+	err := s.b.call(func() (err error) {
+		v, err = s.s.Eval(script, keys, args...)
+		return err
+	})
+	return v, err
+}
+
+func (b *breakerCache) Incr(key string) (int, error) {
+	return b.IncrBy(key, 1)
+}
+
+func (b *breakerCache) IncrBy(key string, step int) (int, error) {
+	var v int
+	err := b.call(func() (err error) {
+		v, err = b.c.IncrBy(key, step)
+		return err
+	})
+	return v, err
+}
+
+func (b *breakerCache) IncrByFloat(key string, step float64) (float64, error) {
+	var v float64
+	err := b.call(func() (err error) {
+		v, err = b.c.IncrByFloat(key, step)
+		return err
+	})
+	return v, err
+}
+
+// count runs a collection operation returning a count.
+func (b *breakerCache) count(fn func() (int, error)) (int, error) {
+	var n int
+	err := b.call(func() (err error) {
+		n, err = fn()
+		return err
+	})
+	return n, err
+}
+
+// member runs a collection operation returning a member and whether it exists.
+func (b *breakerCache) member(fn func() (string, bool, error)) (string, bool, error) {
+	var (
+		v   string
+		has bool
+	)
+	err := b.call(func() (err error) {
+		v, has, err = fn()
+		return err
+	})
+	return v, has, err
+}
+
+// strings runs a collection operation returning strings.
+func (b *breakerCache) strings(fn func() ([]string, error)) ([]string, error) {
+	var v []string
+	err := b.call(func() (err error) {
+		v, err = fn()
+		return err
+	})
+	return v, err
+}
+
+// zs runs a sorted set operation returning members with their scores.
+func (b *breakerCache) zs(fn func() ([]cache.Z, error)) ([]cache.Z, error) {
+	var v []cache.Z
+	err := b.call(func() (err error) {
+		v, err = fn()
+		return err
+	})
+	return v, err
+}
+
+func (b *breakerCache) HSet(key string, values map[string]interface{}) (int, error) {
+	return b.count(func() (int, error) { return b.c.HSet(key, values) })
+}
+
+func (b *breakerCache) HGet(key, field string) (string, bool, error) {
+	return b.member(func() (string, bool, error) { return b.c.HGet(key, field) })
+}
+
+func (b *breakerCache) HGetAll(key string) (map[string]string, error) {
+	var v map[string]string
+	err := b.call(func() (err error) {
+		v, err = b.c.HGetAll(key)
+		return err
+	})
+	return v, err
+}
+
+func (b *breakerCache) HDel(key string, fields ...string) (int, error) {
+	return b.count(func() (int, error) { return b.c.HDel(key, fields...) })
+}
+
+func (b *breakerCache) LPush(key string, values ...interface{}) (int, error) {
+	return b.count(func() (int, error) { return b.c.LPush(key, values...) })
+}
+
+func (b *breakerCache) RPush(key string, values ...interface{}) (int, error) {
+	return b.count(func() (int, error) { return b.c.RPush(key, values...) })
+}
+
+func (b *breakerCache) LPop(key string) (string, bool, error) {
+	return b.member(func() (string, bool, error) { return b.c.LPop(key) })
+}
+
+func (b *breakerCache) RPop(key string) (string, bool, error) {
+	return b.member(func() (string, bool, error) { return b.c.RPop(key) })
+}
+
+func (b *breakerCache) LRange(key string, start, stop int) ([]string, error) {
+	return b.strings(func() ([]string, error) { return b.c.LRange(key, start, stop) })
+}
+
+func (b *breakerCache) SAdd(key string, members ...interface{}) (int, error) {
+	return b.count(func() (int, error) { return b.c.SAdd(key, members...) })
+}
+
+func (b *breakerCache) SRem(key string, members ...interface{}) (int, error) {
+	return b.count(func() (int, error) { return b.c.SRem(key, members...) })
+}
+
+func (b *breakerCache) SIsMember(key string, member interface{}) (bool, error) {
+	var is bool
+	err := b.call(func() (err error) {
+		is, err = b.c.SIsMember(key, member)
+		return err
+	})
+	return is, err
+}
+
+func (b *breakerCache) SMembers(key string) ([]string, error) {
+	return b.strings(func() ([]string, error) { return b.c.SMembers(key) })
+}
+
+func (b *breakerCache) ZAdd(key string, members ...cache.Z) (int, error) {
+	return b.count(func() (int, error) { return b.c.ZAdd(key, members...) })
+}
+
+func (b *breakerCache) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	var v float64
+	err := b.call(func() (err error) {
+		v, err = b.c.ZIncrBy(key, increment, member)
+		return err
+	})
+	return v, err
+}
+
+func (b *breakerCache) ZRem(key string, members ...string) (int, error) {
+	return b.count(func() (int, error) { return b.c.ZRem(key, members...) })
+}
+
+func (b *breakerCache) ZScore(key, member string) (float64, bool, error) {
+	var (
+		v   float64
+		has bool
+	)
+	err := b.call(func() (err error) {
+		v, has, err = b.c.ZScore(key, member)
+		return err
+	})
+	return v, has, err
+}
+
+func (b *breakerCache) ZRange(key string, start, stop int) ([]cache.Z, error) {
+	return b.zs(func() ([]cache.Z, error) { return b.c.ZRange(key, start, stop) })
+}
+
+func (b *breakerCache) ZRevRange(key string, start, stop int) ([]cache.Z, error) {
+	return b.zs(func() ([]cache.Z, error) { return b.c.ZRevRange(key, start, stop) })
+}
+
+func (b *breakerCache) ZRangeByScore(key string, min, max float64) ([]cache.Z, error) {
+	return b.zs(func() ([]cache.Z, error) { return b.c.ZRangeByScore(key, min, max) })
+}
+
+func (b *breakerCache) Del(keys ...string) error {
+	return b.write(func(c cache.ICache) error {
+		return c.Del(keys...)
+	})
+}
+
+func (b *breakerCache) Local() cache.ICache {
+	return newBreakerCache(b.c.Local(), b.circuit)
+}
+
+// Identity identifies the cache by its circuit and the cache it guards.
+func (b *breakerCache) Identity() interface{} {
+	return [2]interface{}{b.circuit, cache.Identity(b.c)}
+}
+
+func (b *breakerCache) Parent() cache.ICache {
+	return b.c.Parent()
+}
+
+func (b *breakerCache) Children() cache.ICache {
+	return b.c.Children()
+}
+
+func (b *breakerCache) SetParent(parent cache.ICache) {
+	b.c.SetParent(parent)
+}
+
+func (b *breakerCache) SetChildren(children cache.ICache) {
+	b.c.SetChildren(children)
+}
+
+func (b *breakerCache) Close() error {
+	b.circuit.probe.Stop()
+	return b.c.Close()
+}
+
+func (b *breakerCache) Stats() cache.Stats {
+	return b.c.Stats()
+}
+
+func (b *breakerCache) WithContext(ctx context.Context) cache.ICache {
+	return newBreakerCache(b.c.WithContext(ctx), b.circuit)
+}
+
+func (b *breakerCache) OnExpire(pattern string, handler func(key string)) error {
+	return b.call(func() error {
+		return b.c.OnExpire(pattern, handler)
+	})
+}
+
+func (b *breakerCache) OnChange(pattern string, handler func(key, event string)) error {
+	return b.call(func() error {
+		return b.c.OnChange(pattern, handler)
+	})
+}
+
+func (b *breakerCache) Publish(channel string, message interface{}) error {
+	return b.call(func() error {
+		return b.c.Publish(channel, message)
+	})
+}
+
+func (b *breakerCache) Subscribe(channels []string, handler func(string, string), options ...*cache.SubscribeOptions) (cache.ISubscription, error) {
+	var sub cache.ISubscription
+	err := b.call(func() (err error) {
+		sub, err = b.c.Subscribe(channels, handler, options...)
+		return err
+	})
+	return sub, err
+}
+
+func (b *breakerCache) PSubscribe(patterns []string, handler func(string, string), options ...*cache.SubscribeOptions) (cache.ISubscription, error) {
+	var sub cache.ISubscription
+	err := b.call(func() (err error) {
+		sub, err = b.c.PSubscribe(patterns, handler, options...)
+		return err
+	})
+	return sub, err
+}
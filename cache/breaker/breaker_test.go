@@ -0,0 +1,153 @@
+package breaker
+
+import (
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/cache/memory"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyCache is a parent level that can be taken down.
+type flakyCache struct {
+	cache.ICache
+	down int32
+}
+
+func (f *flakyCache) err() error {
+	if atomic.LoadInt32(&f.down) == 1 {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	return nil
+}
+
+func (f *flakyCache) Ping() error {
+	return f.err()
+}
+
+func (f *flakyCache) Set(key string, value interface{}, expiration ...time.Duration) error {
+	if err := f.err(); err != nil {
+		return err
+	}
+	return f.ICache.Set(key, value, expiration...)
+}
+
+func (f *flakyCache) MGet(keys ...string) (map[string]*cache.Item, error) {
+	if err := f.err(); err != nil {
+		return nil, err
+	}
+	return f.ICache.MGet(keys...)
+}
+
+func TestBreakerCache(t *testing.T) {
+	l1, _ := memory.NewMemoryCache()
+	l2, _ := memory.NewMemoryCache()
+	parent := &flakyCache{ICache: l2}
+	var (
+		mu          sync.Mutex
+		transitions []string
+	)
+	b := NewBreakerCache(parent, &Options{
+		Threshold:     1,
+		RetryTimeout:  20 * time.Millisecond,
+		ProbeInterval: 10 * time.Millisecond,
+		OnStateChange: func(from, to string) {
+			mu.Lock()
+			transitions = append(transitions, from+">"+to)
+			mu.Unlock()
+		},
+	})
+	defer b.Close()
+	c, err := cache.NewCache([]cache.ICache{l1, b})
+	assert.Nil(t, err)
+
+	assert.Nil(t, c.Set("a", 1))
+	atomic.StoreInt32(&parent.down, 1)
+
+	// writes are queued and reads served locally while the parent is down
+	assert.Nil(t, c.Set("b", 2))
+	assert.Equal(t, StateOpen, b.State())
+	assert.Equal(t, 1, b.Health().Queued)
+	assert.Equal(t, 1, c.GetInt("a"))
+	items, err := c.MGet("a", "missing")
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	_, err = c.Incr("n")
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	// once the parent is back, the queue is replayed and the child levels evicted
+	atomic.StoreInt32(&parent.down, 0)
+	deadline := time.Now().Add(time.Second)
+	for b.State() != StateClosed && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, StateClosed, b.State())
+	assert.Equal(t, 0, b.Health().Queued)
+	assert.Equal(t, 2, l2.GetInt("b"))
+	assert.False(t, l1.Local().Has("a"))
+	assert.Equal(t, 1, c.GetInt("a"))
+
+	mu.Lock()
+	assert.Equal(t, []string{"closed>open", "open>half-open", "half-open>closed"}, transitions)
+	mu.Unlock()
+}
+
+func TestBreakerCache_ReplayQueueFull(t *testing.T) {
+	l2, _ := memory.NewMemoryCache()
+	parent := &flakyCache{ICache: l2, down: 1}
+	b := NewBreakerCache(parent, &Options{Threshold: 1, MaxQueue: 1, RetryTimeout: time.Hour})
+	defer b.Close()
+
+	assert.Nil(t, b.Set("a", 1))
+	assert.Equal(t, ErrReplayQueueFull, b.Set("b", 1))
+	assert.Equal(t, StateOpen, b.Health().State)
+	assert.NotEmpty(t, b.Health().LastError)
+}
+
+// unstablePinger is a parent level whose pings fail every other time.
+type unstablePinger struct {
+	cache.ICache
+	pings int32
+}
+
+func (p *unstablePinger) Ping() error {
+	if atomic.AddInt32(&p.pings, 1)%2 == 1 {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	return nil
+}
+
+func TestBreakerCache_ConsecutiveFailures(t *testing.T) {
+	l2, _ := memory.NewMemoryCache()
+	b := NewBreakerCache(&unstablePinger{ICache: l2}, &Options{Threshold: 2, ProbeInterval: time.Hour})
+	defer b.Close()
+	circuit := b.(*breakerCache).circuit
+
+	// failures that are not consecutive never open the circuit
+	for i := 0; i < 10; i++ {
+		circuit.check()
+	}
+	assert.Equal(t, StateClosed, b.State())
+
+	// nor do the ones followed by reads answered by the parent level
+	assert.Nil(t, l2.Set("k", 1))
+	for i := 0; i < 5; i++ {
+		circuit.fail(errors.New("timeout"))
+		assert.True(t, b.Has("k"))
+		_, has := b.TTL("k")
+		assert.True(t, has)
+	}
+	assert.Equal(t, StateClosed, b.State())
+	assert.Equal(t, 0, b.Health().Failures)
+}
+
+func TestIsUnavailable(t *testing.T) {
+	assert.True(t, IsUnavailable(&net.OpError{Op: "read", Err: errors.New("reset")}))
+	assert.True(t, IsUnavailable(errors.Wrap(&net.OpError{Op: "read", Err: errors.New("reset")}, "get")))
+	assert.False(t, IsUnavailable(cache.ErrLockNotObtained))
+	assert.False(t, IsUnavailable(nil))
+}
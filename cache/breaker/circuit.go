@@ -0,0 +1,241 @@
+package breaker
+
+import (
+	"context"
+	"github.com/motclub/common/cache"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// StateClosed lets every call reach the parent level.
+	StateClosed = "closed"
+	// StateOpen serves reads from the local levels and queues writes, after the parent level failed.
+	StateOpen = "open"
+	// StateHalfOpen replays the queued writes before closing again, serving like StateOpen meanwhile.
+	StateHalfOpen = "half-open"
+)
+
+// clearPageSize is the number of keys evicted per call from a child level on recovery.
+const clearPageSize = 1000
+
+var (
+	ErrCircuitOpen     = errors.New(`mot: cache circuit open, parent level unavailable`)
+	ErrReplayQueueFull = errors.New(`mot: cache circuit replay queue full`)
+)
+
+// IsUnavailable reports whether err comes from a parent level that cannot be
+// reached, such as a network error or a timeout, rather than from a rejected
+// operation. It is the default Options.IsFailure.
+func IsUnavailable(err error) bool {
+	err = errors.Cause(err)
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF, context.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// Health is the state of a circuit.
+type Health struct {
+	State    string `json:"state"`
+	Failures int    `json:"failures"`
+	// Queued is the number of writes waiting to be replayed.
+	Queued int `json:"queued"`
+	// OpenedAt is when the circuit last opened, zero when it never did.
+	OpenedAt  time.Time `json:"opened_at"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// write is a queued write, replayed against the parent level.
+type write func(c cache.ICache) error
+
+// circuit tracks the failures of a parent level, shared by the views of a breaker cache.
+type circuit struct {
+	c       cache.ICache
+	options *Options
+	probe   *cache.Sweeper
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	lastErr  error
+	queue    []write
+}
+
+func newCircuit(c cache.ICache, o *Options) *circuit {
+	ci := &circuit{c: c, options: o, probe: new(cache.Sweeper), state: StateClosed}
+	ci.probe.Start(o.ProbeInterval, ci.check)
+	return ci
+}
+
+// allow reports whether calls may reach the parent level.
+func (c *circuit) allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state == StateClosed
+}
+
+// record counts err against the parent level and reports whether it is a failure.
+func (c *circuit) record(err error) bool {
+	if err != nil && c.options.IsFailure(err) {
+		c.fail(err)
+		return true
+	}
+	if err == nil {
+		c.mu.Lock()
+		if c.state == StateClosed {
+			c.failures = 0
+		}
+		c.mu.Unlock()
+	}
+	return false
+}
+
+// fail counts a failure, opening the circuit at the threshold.
+func (c *circuit) fail(err error) {
+	c.mu.Lock()
+	c.failures++
+	c.lastErr = err
+	if c.state != StateClosed || c.failures < c.options.Threshold {
+		c.mu.Unlock()
+		return
+	}
+	c.state = StateOpen
+	c.openedAt = time.Now()
+	failures := c.failures
+	c.mu.Unlock()
+	c.options.Logger.WARN("mot: cache circuit opened after %d failures: %v", failures, err)
+	c.changed(StateClosed, StateOpen)
+}
+
+// enqueue queues w for replay once the parent level is back.
+func (c *circuit) enqueue(w write) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.queue) >= c.options.MaxQueue {
+		return ErrReplayQueueFull
+	}
+	c.queue = append(c.queue, w)
+	return nil
+}
+
+// check runs at every probe interval: it pings the parent level when it can,
+// and tries to recover once the circuit has been open for the retry timeout.
+func (c *circuit) check() {
+	if pinger, ok := c.c.(cache.IPinger); ok {
+		if err := pinger.Ping(); err != nil {
+			c.fail(err)
+			return
+		}
+		c.record(nil)
+	}
+	c.mu.Lock()
+	retry := c.state == StateOpen && time.Since(c.openedAt) >= c.options.RetryTimeout
+	c.mu.Unlock()
+	if retry {
+		c.recover()
+	}
+}
+
+// recover evicts the child levels, whose values may have changed on other
+// nodes meanwhile, replays the queued writes and closes the circuit. A failure
+// while replaying opens it again, keeping the writes left.
+func (c *circuit) recover() {
+	c.mu.Lock()
+	queued := len(c.queue)
+	c.state = StateHalfOpen
+	c.mu.Unlock()
+	c.options.Logger.INFO("mot: cache circuit half-open, replaying %d writes", queued)
+	c.changed(StateOpen, StateHalfOpen)
+
+	c.evictChildren()
+	for {
+		c.mu.Lock()
+		queue := c.queue
+		c.queue = nil
+		if len(queue) == 0 {
+			c.state = StateClosed
+			c.failures = 0
+			c.lastErr = nil
+			c.mu.Unlock()
+			break
+		}
+		c.mu.Unlock()
+
+		for i, w := range queue {
+			err := w(c.c)
+			if err == nil {
+				continue
+			}
+			if !c.options.IsFailure(err) {
+				c.options.Logger.WARN("mot: dropping a replayed cache write: %v", err)
+				continue
+			}
+			c.mu.Lock()
+			c.queue = append(queue[i:], c.queue...)
+			c.state = StateOpen
+			c.openedAt = time.Now()
+			c.lastErr = err
+			c.mu.Unlock()
+			c.options.Logger.WARN("mot: cache circuit opened again while replaying: %v", err)
+			c.changed(StateHalfOpen, StateOpen)
+			return
+		}
+	}
+	c.options.Logger.INFO("mot: cache circuit closed")
+	c.changed(StateHalfOpen, StateClosed)
+}
+
+// evictChildren deletes every key of the child levels.
+func (c *circuit) evictChildren() {
+	for child := c.c.Children(); child != nil; child = child.Children() {
+		local := child.Local()
+		cursor := ""
+		for {
+			items, next, err := local.Scan("", cursor, clearPageSize)
+			if err != nil {
+				c.options.Logger.WARN("mot: evicting a child cache level: %v", err)
+				break
+			}
+			keys := make([]string, len(items))
+			for i, item := range items {
+				keys[i] = item.Key
+			}
+			if len(keys) > 0 {
+				_ = local.Del(keys...)
+			}
+			if cursor = next; cursor == "" {
+				break
+			}
+		}
+	}
+}
+
+func (c *circuit) changed(from, to string) {
+	if c.options.OnStateChange != nil {
+		c.options.OnStateChange(from, to)
+	}
+}
+
+func (c *circuit) health() Health {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := Health{
+		State:    c.state,
+		Failures: c.failures,
+		Queued:   len(c.queue),
+		OpenedAt: c.openedAt,
+	}
+	if c.lastErr != nil {
+		h.LastError = c.lastErr.Error()
+	}
+	return h
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"sync"
+)
+
+type brokerMessage struct {
+	channel string
+	payload string
+}
+
+type subscriber struct {
+	channels []string
+	pattern  bool
+	messages chan brokerMessage
+	sub      *Subscription
+}
+
+func (s *subscriber) match(channel string) bool {
+	for _, c := range s.channels {
+		if (s.pattern && Match(c, channel)) || (!s.pattern && c == channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriberBuffer is how many messages a subscriber can fall behind before losing them.
+const subscriberBuffer = 100
+
+// Broker delivers pub/sub messages to in-process subscribers, for the caches
+// without a Redis level. Like Redis it is at-most-once: a subscriber that cannot
+// keep up loses messages instead of blocking the publisher, and messages sent
+// while nobody subscribes are lost.
+type Broker struct {
+	mu          sync.RWMutex
+	subscribers map[*subscriber]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: make(map[*subscriber]struct{})}
+}
+
+// Publish sends message to the subscribers of channel.
+func (b *Broker) Publish(channel string, message interface{}) error {
+	payload, err := FormatArg(message)
+	if err != nil {
+		return err
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subscribers {
+		if !s.match(channel) {
+			continue
+		}
+		select {
+		case s.messages <- brokerMessage{channel: channel, payload: payload}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe delivers the messages of channels to handler.
+func (b *Broker) Subscribe(channels []string, handler func(string, string), options ...*SubscribeOptions) ISubscription {
+	return b.subscribe(channels, false, handler, options)
+}
+
+// PSubscribe delivers the messages of the channels matching patterns, Match globs, to handler.
+func (b *Broker) PSubscribe(patterns []string, handler func(string, string), options ...*SubscribeOptions) ISubscription {
+	return b.subscribe(patterns, true, handler, options)
+}
+
+func (b *Broker) subscribe(channels []string, pattern bool, handler func(string, string), options []*SubscribeOptions) ISubscription {
+	s := &subscriber{
+		channels: channels,
+		pattern:  pattern,
+		messages: make(chan brokerMessage, subscriberBuffer),
+	}
+	s.sub = NewSubscription(handler, func() error {
+		b.unsubscribe(s)
+		return nil
+	}, options...)
+	go func() {
+		for msg := range s.messages {
+			s.sub.Deliver(msg.channel, msg.payload)
+		}
+	}()
+	b.mu.Lock()
+	b.subscribers[s] = struct{}{}
+	b.mu.Unlock()
+	return s.sub
+}
+
+// unsubscribe stops delivering messages to s.
+func (b *Broker) unsubscribe(s *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, has := b.subscribers[s]; has {
+		delete(b.subscribers, s)
+		close(s.messages)
+	}
+}
+
+// Close ends every subscription with ErrCacheClosed.
+func (b *Broker) Close() {
+	b.mu.RLock()
+	subscribers := make([]*subscriber, 0, len(b.subscribers))
+	for s := range b.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	b.mu.RUnlock()
+	for _, s := range subscribers {
+		s.sub.Stop(ErrCacheClosed)
+	}
+}
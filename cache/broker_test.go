@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBroker(t *testing.T) {
+	b := NewBroker()
+	exact := make(chan string, 4)
+	matched := make(chan string, 4)
+	b.Subscribe([]string{"news"}, func(channel string, message string) {
+		exact <- channel + ":" + message
+	})
+	sub := b.PSubscribe([]string{"news*"}, func(channel string, message string) {
+		matched <- channel + ":" + message
+	})
+
+	assert.Nil(t, b.Publish("news", "a"))
+	assert.Nil(t, b.Publish("news.sport", 1))
+	for _, want := range []string{"news:a", "news.sport:1"} {
+		select {
+		case msg := <-matched:
+			assert.Equal(t, want, msg)
+		case <-time.After(time.Second):
+			t.Fatal("message not delivered")
+		}
+	}
+	select {
+	case msg := <-exact:
+		assert.Equal(t, "news:a", msg)
+	case <-time.After(time.Second):
+		t.Fatal("message not delivered")
+	}
+
+	assert.Nil(t, sub.Close())
+	b.Close()
+	assert.Nil(t, b.Publish("news", "late"))
+	select {
+	case msg := <-exact:
+		t.Fatalf("message %q delivered after Close", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBroker_AtMostOnce(t *testing.T) {
+	b := NewBroker()
+	defer b.Close()
+	release := make(chan struct{})
+	received := make(chan string, 2*subscriberBuffer)
+	b.Subscribe([]string{"c"}, func(channel string, message string) {
+		<-release
+		received <- message
+	})
+
+	// a subscriber that cannot keep up loses messages instead of blocking the publisher
+	for i := 0; i < 2*subscriberBuffer; i++ {
+		assert.Nil(t, b.Publish("c", i))
+	}
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, len(received) < 2*subscriberBuffer)
+	assert.True(t, len(received) > 0)
+}
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"github.com/motclub/common/getter"
 	"github.com/pkg/errors"
 	"time"
@@ -23,26 +24,144 @@ func NewCache(caches []ICache) (ICache, error) {
 	return caches[0], nil
 }
 
+// EvictChildren deletes keys from every level below c, without propagating
+// the deletion back up the chain.
+func EvictChildren(c ICache, keys ...string) {
+	for child := c.Children(); child != nil; child = child.Children() {
+		_ = child.Local().Del(keys...)
+	}
+}
+
+// RefreshChildren evicts keys from the child levels of c, then reads them back
+// through the lowest level so that every child level holds their current value.
+func RefreshChildren(c ICache, keys ...string) {
+	EvictChildren(c, keys...)
+	var lowest ICache
+	for child := c.Children(); child != nil; child = child.Children() {
+		lowest = child
+	}
+	if lowest != nil {
+		_, _ = lowest.MGet(keys...)
+	}
+}
+
 // ICache
 type ICache interface {
 	getter.IGetter
 
 	TTL(key string) (time.Duration, bool)
 	Set(key string, value interface{}, expiration ...time.Duration) error
+	// MGet returns the items found for keys, resolving the ones missing locally against the parent level.
+	MGet(keys ...string) (map[string]*Item, error)
+	MSet(values map[string]interface{}, expiration ...time.Duration) error
+	// SetNX sets key only when it does not exist, SetXX only when it does, and
+	// both report whether they did. Conditional writes are decided by the top
+	// level of the chain, the levels below store the value once it is written.
+	SetNX(key string, value interface{}, expiration ...time.Duration) (bool, error)
+	SetXX(key string, value interface{}, expiration ...time.Duration) (bool, error)
+	// GetSet sets key to value without expiration and decodes its previous value
+	// into dst, reporting whether there was one.
+	GetSet(key string, value interface{}, dst interface{}) (bool, error)
+	// CompareAndSwap sets key to value when it holds old, reporting whether it did.
+	// old is either the expected value or an *Item read earlier, which then
+	// serves as the version of the value.
+	CompareAndSwap(key string, old, value interface{}, expiration ...time.Duration) (bool, error)
+	// Expire sets the time to live of key to ttl from now, without passing its
+	// value again, and deletes key when ttl is not positive. Expire, ExpireAt,
+	// Persist and Touch report whether key exists.
+	Expire(key string, ttl time.Duration) (bool, error)
+	ExpireAt(key string, at time.Time) (bool, error)
+	// Persist removes the expiration of key.
+	Persist(key string) (bool, error)
+	// Touch restarts the expiration of key with the time to live it was last
+	// given, so that keys in use never expire: sliding expiration.
+	Touch(key string) (bool, error)
+	// SetWithTags is Set, additionally attaching tags that InvalidateTags can later drop the key by.
+	SetWithTags(key string, value interface{}, tags []string, expiration ...time.Duration) error
+	InvalidateTags(tags ...string) error
+	GetOrLoad(key string, dst interface{}, ttl time.Duration, loader LoaderFunc) error
 	HasPrefix(s string, limit ...int) (map[string]string, error)
 	HasSuffix(s string, limit ...int) (map[string]string, error)
 	Contains(s string, limit ...int) (map[string]string, error)
+	// Scan returns a page of about limit items whose keys start with prefix,
+	// resuming after cursor, along with the cursor of the next page. An empty
+	// cursor starts the scan and is returned once it is complete. Levels with a
+	// parent scan the parent, which holds every key of the chain.
+	Scan(prefix, cursor string, limit int) ([]*Item, string, error)
+	// Lock obtains an expiring lock on key at the top level of the chain, or
+	// fails with ErrLockNotObtained when another holder has it.
+	Lock(key string, ttl time.Duration) (ILock, error)
 	Incr(key string) (int, error)
 	IncrBy(key string, step int) (int, error)
 	IncrByFloat(key string, step float64) (float64, error)
+	ICollections
 	Del(keys ...string) error
+	// Local returns a view of this level alone: its operations neither reach
+	// the parent level nor notify other nodes.
+	Local() ICache
 	Parent() ICache
 	Children() ICache
 	SetParent(parent ICache)
 	SetChildren(children ICache)
 	Close() error
+	// Stats returns the counters of this level only, see ChainStats for the whole chain.
+	Stats() Stats
+
+	// WithContext returns a view of the cache whose operations, including
+	// the ones delegated to parent levels, use ctx, context.Background() when
+	// ctx is nil.
+	WithContext(ctx context.Context) ICache
+
+	// OnExpire calls handler with the keys matching pattern, a Match glob, as
+	// they expire. OnChange calls handler with the keys matching pattern and
+	// their events, such as EventSet or EventExpired. Both subscribe at the top
+	// level of the chain. On Redis they need the notify-keyspace-events
+	// setting, see the Redis options.
+	OnExpire(pattern string, handler func(key string)) error
+	OnChange(pattern string, handler func(key, event string)) error
 
+	// Publish sends message to channel. Subscribe and PSubscribe deliver the
+	// messages of channels, or of the channels matching patterns, to handler
+	// until the subscription returned is closed.
 	Publish(channel string, message interface{}) error
-	Subscribe(channels []string, handler func(string, string)) error
-	PSubscribe(patterns []string, handler func(string, string)) error
+	Subscribe(channels []string, handler func(string, string), options ...*SubscribeOptions) (ISubscription, error)
+	PSubscribe(patterns []string, handler func(string, string), options ...*SubscribeOptions) (ISubscription, error)
+}
+
+// IScripter is implemented by levels that can run Lua scripts atomically, such as Redis.
+type IScripter interface {
+	Eval(script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// IScripterWrapper is implemented by the caches wrapping another one, such as
+// namespaces, which run scripts on the scripter of the cache they wrap.
+type IScripterWrapper interface {
+	// Scripter returns the scripter of the wrapped cache, and false when it has none.
+	Scripter() (IScripter, bool)
+}
+
+// Scripter returns the scripter of c, looking through the wrappers of c and
+// the top level of its chain, and false when scripts cannot run.
+func Scripter(c ICache) (IScripter, bool) {
+	if w, ok := c.(IScripterWrapper); ok {
+		return w.Scripter()
+	}
+	if top := Top(c); top != c {
+		return Scripter(top)
+	}
+	s, ok := c.(IScripter)
+	return s, ok
+}
+
+// IPinger is implemented by levels backed by a server, such as Redis, to check it is reachable.
+type IPinger interface {
+	Ping() error
+}
+
+// Top returns the top level of the chain c belongs to.
+func Top(c ICache) ICache {
+	for c.Parent() != nil {
+		c = c.Parent()
+	}
+	return c
 }
@@ -0,0 +1,30 @@
+package cache_test
+
+import (
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/cache/memory"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRefreshChildren(t *testing.T) {
+	l1, _ := memory.NewMemoryCache()
+	l2, _ := memory.NewMemoryCache()
+	l3, _ := memory.NewMemoryCache()
+	c, err := cache.NewCache([]cache.ICache{l1, l2, l3})
+	assert.Nil(t, err)
+	assert.Nil(t, c.Set("k", "v1"))
+
+	// another node writes the top level only
+	assert.Nil(t, l3.Local().Set("k", "v2"))
+	assert.Equal(t, "v1", l1.Local().GetString("k"))
+
+	cache.RefreshChildren(l3, "k")
+	assert.Equal(t, "v2", l1.Local().GetString("k"))
+	assert.Equal(t, "v2", l2.Local().GetString("k"))
+
+	cache.EvictChildren(l3, "k")
+	assert.False(t, l1.Local().Has("k"))
+	assert.False(t, l2.Local().Has("k"))
+	assert.True(t, l3.Has("k"))
+}
@@ -0,0 +1,576 @@
+package cachetest
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedisServer is an in-process server speaking enough of the Redis protocol
+// for the Redis backend to pass the conformance suite: strings, counters,
+// expiry, key scans, hashes, lists, sets, sorted sets, WATCH/MULTI/EXEC
+// transactions and pub/sub. Lua scripts and keyspace notifications are not
+// supported, and every database index shares the same keys.
+type RedisServer struct {
+	l  net.Listener
+	wg sync.WaitGroup
+
+	mu       sync.Mutex
+	data     map[string]*redisValue
+	versions map[string]uint64
+	conns    map[*redisConn]bool
+	closed   bool
+}
+
+// NewRedisServer starts a server listening on a random local port.
+func NewRedisServer() (*RedisServer, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &RedisServer{
+		l:        l,
+		data:     make(map[string]*redisValue),
+		versions: make(map[string]uint64),
+		conns:    make(map[*redisConn]bool),
+	}
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// Addr returns the address the server listens on, as host:port.
+func (s *RedisServer) Addr() string {
+	return s.l.Addr().String()
+}
+
+// Close stops the server and closes the connections of its clients.
+func (s *RedisServer) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	err := s.l.Close()
+	for c := range s.conns {
+		_ = c.conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *RedisServer) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		c := &redisConn{
+			conn:     conn,
+			w:        bufio.NewWriter(conn),
+			channels: make(map[string]bool),
+			patterns: make(map[string]bool),
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.conns[c] = true
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serve(c)
+	}
+}
+
+// redisConn is the state of a client connection, guarded by the server mutex
+// but for its writer, which has its own.
+type redisConn struct {
+	conn net.Conn
+	wmu  sync.Mutex
+	w    *bufio.Writer
+
+	channels map[string]bool
+	patterns map[string]bool
+	watched  map[string]uint64
+	queued   [][]string
+	multi    bool
+	aborted  bool
+}
+
+func (c *redisConn) subscriptions() int {
+	return len(c.channels) + len(c.patterns)
+}
+
+func (c *redisConn) write(replies ...interface{}) error {
+	var buf bytes.Buffer
+	for _, reply := range replies {
+		encode(&buf, reply)
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := c.w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+func (s *RedisServer) serve(c *redisConn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		_ = c.conn.Close()
+	}()
+	r := bufio.NewReader(c.conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		name := strings.ToUpper(args[0])
+		reply, deliveries := s.command(c, name, args[1:])
+		if err := c.write(reply); err != nil {
+			return
+		}
+		for _, d := range deliveries {
+			_ = d.conn.write(d.message)
+		}
+		if name == "QUIT" {
+			return
+		}
+	}
+}
+
+// readCommand reads a command, sent either as an array of bulk strings or inline.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, io.ErrUnexpectedEOF
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args = append(args, string(data[:size]))
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+type (
+	// status is a simple string reply, such as OK.
+	status string
+	// redisError is an error reply.
+	redisError string
+	// nilArray is the reply of an aborted transaction.
+	nilArray struct{}
+	// replies are several replies to a single command, such as SUBSCRIBE with many channels.
+	replies []interface{}
+)
+
+const (
+	replyOK        = status("OK")
+	errWrongType   = redisError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNotInteger  = redisError("ERR value is not an integer or out of range")
+	errNotFloat    = redisError("ERR value is not a valid float")
+	errSyntax      = redisError("ERR syntax error")
+	errSubscribed  = redisError("ERR only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context")
+	errNestedMulti = redisError("ERR MULTI calls can not be nested")
+)
+
+// encode writes reply in the protocol: nil is a null bulk string, strings are
+// bulk strings, integers and slices are integers and arrays.
+func encode(buf *bytes.Buffer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		buf.WriteString("$-1\r\n")
+	case status:
+		buf.WriteString("+" + string(v) + "\r\n")
+	case redisError:
+		buf.WriteString("-" + string(v) + "\r\n")
+	case int:
+		buf.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case int64:
+		buf.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case string:
+		buf.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+	case nilArray:
+		buf.WriteString("*-1\r\n")
+	case replies:
+		for _, r := range v {
+			encode(buf, r)
+		}
+	case []string:
+		buf.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, s := range v {
+			encode(buf, s)
+		}
+	case []interface{}:
+		buf.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, r := range v {
+			encode(buf, r)
+		}
+	default:
+		panic("cachetest: cannot encode reply")
+	}
+}
+
+// delivery is a pub/sub message to write to a subscribed connection.
+type delivery struct {
+	conn    *redisConn
+	message []interface{}
+}
+
+type redisCommand struct {
+	// arity is the number of arguments, or minus the minimum number when it varies.
+	arity int
+	// run runs the command, named by args[0], with the server locked.
+	run func(s *RedisServer, c *redisConn, args []string) interface{}
+}
+
+var redisCommands map[string]redisCommand
+
+func init() {
+	redisCommands = map[string]redisCommand{
+		"ECHO":   {1, func(s *RedisServer, c *redisConn, args []string) interface{} { return args[1] }},
+		"SELECT": {1, ok},
+		"CLIENT": {-1, ok},
+		"CONFIG": {-1, cmdConfig},
+		"QUIT":   {0, ok},
+
+		"FLUSHALL": {0, cmdFlush},
+		"FLUSHDB":  {0, cmdFlush},
+		"DBSIZE":   {0, cmdDBSize},
+		"DEL":      {-1, cmdDel},
+		"UNLINK":   {-1, cmdDel},
+		"EXISTS":   {-1, cmdExists},
+		"TYPE":     {1, cmdType},
+		"KEYS":     {1, cmdKeys},
+		"SCAN":     {-1, cmdScan},
+		"TTL":      {1, cmdTTL},
+		"PTTL":     {1, cmdTTL},
+		"EXPIRE":   {2, cmdExpire},
+		"PEXPIRE":  {2, cmdExpire},
+		"PERSIST":  {1, cmdPersist},
+
+		"GET":         {1, cmdGet},
+		"SET":         {-2, cmdSet},
+		"SETNX":       {2, cmdSetNX},
+		"GETSET":      {2, cmdGetSet},
+		"MGET":        {-1, cmdMGet},
+		"MSET":        {-2, cmdMSet},
+		"INCR":        {1, cmdIncr},
+		"DECR":        {1, cmdIncr},
+		"INCRBY":      {2, cmdIncr},
+		"DECRBY":      {2, cmdIncr},
+		"INCRBYFLOAT": {2, cmdIncrByFloat},
+
+		"HSET":    {-3, cmdHSet},
+		"HMSET":   {-3, cmdHSet},
+		"HGET":    {2, cmdHGet},
+		"HGETALL": {1, cmdHGetAll},
+		"HDEL":    {-2, cmdHDel},
+		"HLEN":    {1, cmdHLen},
+
+		"LPUSH":  {-2, cmdPush},
+		"RPUSH":  {-2, cmdPush},
+		"LPOP":   {1, cmdPop},
+		"RPOP":   {1, cmdPop},
+		"LRANGE": {3, cmdLRange},
+		"LLEN":   {1, cmdLLen},
+
+		"SADD":      {-2, cmdSAdd},
+		"SREM":      {-2, cmdSRem},
+		"SMEMBERS":  {1, cmdSMembers},
+		"SISMEMBER": {2, cmdSIsMember},
+		"SCARD":     {1, cmdSCard},
+		"SUNION":    {-1, cmdSUnion},
+
+		"ZADD":             {-3, cmdZAdd},
+		"ZINCRBY":          {3, cmdZIncrBy},
+		"ZREM":             {-2, cmdZRem},
+		"ZSCORE":           {2, cmdZScore},
+		"ZCARD":            {1, cmdZCard},
+		"ZRANGE":           {-3, cmdZRange},
+		"ZREVRANGE":        {-3, cmdZRange},
+		"ZRANGEBYSCORE":    {-3, cmdZRangeByScore},
+		"ZREVRANGEBYSCORE": {-3, cmdZRangeByScore},
+	}
+}
+
+func ok(*RedisServer, *redisConn, []string) interface{} {
+	return replyOK
+}
+
+func arityError(name string) redisError {
+	return redisError("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+}
+
+// command runs a command for c, returning its reply and the messages it publishes.
+func (s *RedisServer) command(c *redisConn, name string, args []string) (interface{}, []delivery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch name {
+	case "PING":
+		if c.subscriptions() > 0 {
+			return []interface{}{"pong", strings.Join(args, "")}, nil
+		}
+		if len(args) > 0 {
+			return args[0], nil
+		}
+		return status("PONG"), nil
+	case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		return s.subscribe(c, strings.ToLower(name), args), nil
+	case "QUIT":
+		return replyOK, nil
+	}
+	if c.subscriptions() > 0 {
+		return errSubscribed, nil
+	}
+
+	switch name {
+	case "PUBLISH":
+		if len(args) != 2 {
+			return arityError(name), nil
+		}
+		deliveries := s.publish(args[0], args[1])
+		return len(deliveries), deliveries
+	case "WATCH":
+		if c.multi {
+			return redisError("ERR WATCH inside MULTI is not allowed"), nil
+		}
+		if c.watched == nil {
+			c.watched = make(map[string]uint64)
+		}
+		for _, key := range args {
+			c.watched[key] = s.versions[key]
+		}
+		return replyOK, nil
+	case "UNWATCH":
+		c.watched = nil
+		return replyOK, nil
+	case "MULTI":
+		if c.multi {
+			return errNestedMulti, nil
+		}
+		c.multi = true
+		return replyOK, nil
+	case "DISCARD":
+		if !c.multi {
+			return redisError("ERR DISCARD without MULTI"), nil
+		}
+		c.reset()
+		return replyOK, nil
+	case "EXEC":
+		if !c.multi {
+			return redisError("ERR EXEC without MULTI"), nil
+		}
+		return s.exec(c), nil
+	}
+
+	cmd, has := redisCommands[name]
+	switch {
+	case !has:
+		c.aborted = c.multi
+		return redisError("ERR unknown command '" + strings.ToLower(name) + "'"), nil
+	case cmd.arity >= 0 && len(args) != cmd.arity, cmd.arity < 0 && len(args) < -cmd.arity:
+		c.aborted = c.multi
+		return arityError(name), nil
+	case c.multi:
+		c.queued = append(c.queued, append([]string{name}, args...))
+		return status("QUEUED"), nil
+	}
+	return cmd.run(s, c, append([]string{name}, args...)), nil
+}
+
+func (c *redisConn) reset() {
+	c.multi, c.aborted, c.queued, c.watched = false, false, nil, nil
+}
+
+// exec runs the commands queued since MULTI, unless a key watched changed.
+func (s *RedisServer) exec(c *redisConn) interface{} {
+	defer c.reset()
+	if c.aborted {
+		return redisError("EXECABORT Transaction discarded because of previous errors.")
+	}
+	for key, version := range c.watched {
+		if s.versions[key] != version {
+			return nilArray{}
+		}
+	}
+	v := make([]interface{}, len(c.queued))
+	for i, args := range c.queued {
+		v[i] = redisCommands[args[0]].run(s, c, args)
+	}
+	return v
+}
+
+func (s *RedisServer) subscribe(c *redisConn, kind string, args []string) interface{} {
+	subscriptions := c.channels
+	if kind[0] == 'p' {
+		subscriptions = c.patterns
+	}
+	unsubscribe := strings.HasSuffix(kind, "unsubscribe")
+	if unsubscribe && len(args) == 0 {
+		for name := range subscriptions {
+			args = append(args, name)
+		}
+		if len(args) == 0 {
+			return []interface{}{kind, nil, 0}
+		}
+	}
+	var v replies
+	for _, name := range args {
+		if unsubscribe {
+			delete(subscriptions, name)
+		} else {
+			subscriptions[name] = true
+		}
+		v = append(v, []interface{}{kind, name, c.subscriptions()})
+	}
+	return v
+}
+
+func (s *RedisServer) publish(channel, message string) []delivery {
+	var deliveries []delivery
+	for c := range s.conns {
+		if c.channels[channel] {
+			deliveries = append(deliveries, delivery{c, []interface{}{"message", channel, message}})
+		}
+		for pattern := range c.patterns {
+			if match(pattern, channel) {
+				deliveries = append(deliveries, delivery{c, []interface{}{"pmessage", pattern, channel, message}})
+			}
+		}
+	}
+	return deliveries
+}
+
+// match reports whether s matches the glob-style pattern, as KEYS and PSUBSCRIBE read it.
+func match(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if match(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				return false
+			}
+			class := pattern[1 : end+1]
+			negate := strings.HasPrefix(class, "^")
+			if negate {
+				class = class[1:]
+			}
+			if inClass(class, s[0]) == negate {
+				return false
+			}
+			pattern = pattern[end+1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+func inClass(class string, b byte) bool {
+	for i := 0; i < len(class); i++ {
+		switch {
+		case class[i] == '\\' && i+1 < len(class):
+			i++
+			if class[i] == b {
+				return true
+			}
+		case i+2 < len(class) && class[i+1] == '-':
+			if class[i] <= b && b <= class[i+2] {
+				return true
+			}
+			i += 2
+		case class[i] == b:
+			return true
+		}
+	}
+	return false
+}
+
+// expiry returns when a key set with the expiration option of SET, EXPIRE and
+// friends expires, the option naming the unit of ttl.
+func expiry(option string, ttl string) (time.Time, bool) {
+	n, err := strconv.ParseInt(ttl, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	unit := time.Second
+	if strings.HasPrefix(option, "P") {
+		unit = time.Millisecond
+	}
+	return time.Now().Add(time.Duration(n) * unit), true
+}
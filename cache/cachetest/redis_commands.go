@@ -0,0 +1,839 @@
+package cachetest
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	typeString = "string"
+	typeHash   = "hash"
+	typeList   = "list"
+	typeSet    = "set"
+	typeZSet   = "zset"
+)
+
+// redisValue is a key of the server, holding a value of one of the types.
+type redisValue struct {
+	kind     string
+	str      string
+	hash     map[string]string
+	list     []string
+	set      map[string]bool
+	zset     map[string]float64
+	expireAt time.Time
+}
+
+func (v *redisValue) empty() bool {
+	switch v.kind {
+	case typeHash:
+		return len(v.hash) == 0
+	case typeList:
+		return len(v.list) == 0
+	case typeSet:
+		return len(v.set) == 0
+	case typeZSet:
+		return len(v.zset) == 0
+	}
+	return false
+}
+
+// touch records a change of key, failing the transactions watching it.
+func (s *RedisServer) touch(key string) {
+	s.versions[key]++
+}
+
+// lookup returns key, deleting it first when it expired.
+func (s *RedisServer) lookup(key string) *redisValue {
+	v, has := s.data[key]
+	if !has {
+		return nil
+	}
+	if !v.expireAt.IsZero() && !time.Now().Before(v.expireAt) {
+		delete(s.data, key)
+		s.touch(key)
+		return nil
+	}
+	return v
+}
+
+// typed returns key when it holds a value of kind, creating it when create is set.
+func (s *RedisServer) typed(key, kind string, create bool) (*redisValue, interface{}) {
+	v := s.lookup(key)
+	switch {
+	case v == nil && create:
+		v = &redisValue{
+			kind: kind,
+			hash: make(map[string]string),
+			set:  make(map[string]bool),
+			zset: make(map[string]float64),
+		}
+		s.data[key] = v
+	case v != nil && v.kind != kind:
+		return nil, errWrongType
+	}
+	return v, nil
+}
+
+// changed records a change of key, deleting it when a collection got empty.
+func (s *RedisServer) changed(key string, v *redisValue) {
+	if v.empty() {
+		delete(s.data, key)
+	}
+	s.touch(key)
+}
+
+func (s *RedisServer) keys() []string {
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		if s.lookup(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func cmdConfig(s *RedisServer, c *redisConn, args []string) interface{} {
+	if strings.ToUpper(args[1]) == "GET" {
+		return []string{}
+	}
+	return replyOK
+}
+
+func cmdFlush(s *RedisServer, c *redisConn, args []string) interface{} {
+	for key := range s.data {
+		s.touch(key)
+	}
+	s.data = make(map[string]*redisValue)
+	return replyOK
+}
+
+func cmdDBSize(s *RedisServer, c *redisConn, args []string) interface{} {
+	return len(s.keys())
+}
+
+func cmdDel(s *RedisServer, c *redisConn, args []string) interface{} {
+	var n int
+	for _, key := range args[1:] {
+		if s.lookup(key) != nil {
+			delete(s.data, key)
+			s.touch(key)
+			n++
+		}
+	}
+	return n
+}
+
+func cmdExists(s *RedisServer, c *redisConn, args []string) interface{} {
+	var n int
+	for _, key := range args[1:] {
+		if s.lookup(key) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdType(s *RedisServer, c *redisConn, args []string) interface{} {
+	if v := s.lookup(args[1]); v != nil {
+		return status(v.kind)
+	}
+	return status("none")
+}
+
+func cmdKeys(s *RedisServer, c *redisConn, args []string) interface{} {
+	keys := []string{}
+	for _, key := range s.keys() {
+		if match(args[1], key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// cmdScan walks the keys in order, the cursor being the index of the next key to examine.
+func cmdScan(s *RedisServer, c *redisConn, args []string) interface{} {
+	cursor, err := strconv.Atoi(args[1])
+	if err != nil || cursor < 0 {
+		return redisError("ERR invalid cursor")
+	}
+	pattern, count := "*", 10
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return errSyntax
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count < 1 {
+				return errSyntax
+			}
+		default:
+			return errSyntax
+		}
+	}
+	keys := s.keys()
+	found := []string{}
+	next := cursor + count
+	if next >= len(keys) {
+		next = 0
+	}
+	for i := cursor; i < len(keys) && i < cursor+count; i++ {
+		if match(pattern, keys[i]) {
+			found = append(found, keys[i])
+		}
+	}
+	return []interface{}{strconv.Itoa(next), found}
+}
+
+func cmdTTL(s *RedisServer, c *redisConn, args []string) interface{} {
+	v := s.lookup(args[1])
+	switch {
+	case v == nil:
+		return -2
+	case v.expireAt.IsZero():
+		return -1
+	case args[0] == "PTTL":
+		return int64(time.Until(v.expireAt) / time.Millisecond)
+	}
+	return int64((time.Until(v.expireAt) + time.Second/2) / time.Second)
+}
+
+func cmdExpire(s *RedisServer, c *redisConn, args []string) interface{} {
+	at, ok := expiry(args[0], args[2])
+	if !ok {
+		return errNotInteger
+	}
+	v := s.lookup(args[1])
+	if v == nil {
+		return 0
+	}
+	if at.After(time.Now()) {
+		v.expireAt = at
+	} else {
+		delete(s.data, args[1])
+	}
+	s.touch(args[1])
+	return 1
+}
+
+func cmdPersist(s *RedisServer, c *redisConn, args []string) interface{} {
+	v := s.lookup(args[1])
+	if v == nil || v.expireAt.IsZero() {
+		return 0
+	}
+	v.expireAt = time.Time{}
+	s.touch(args[1])
+	return 1
+}
+
+func cmdGet(s *RedisServer, c *redisConn, args []string) interface{} {
+	v, err := s.typed(args[1], typeString, false)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	return v.str
+}
+
+// set writes the string value of key, keeping its expiration when keepTTL is set.
+func (s *RedisServer) set(key, value string, expireAt time.Time, keepTTL bool) {
+	if old := s.lookup(key); old != nil && keepTTL {
+		expireAt = old.expireAt
+	}
+	s.data[key] = &redisValue{kind: typeString, str: value, expireAt: expireAt}
+	s.touch(key)
+}
+
+func cmdSet(s *RedisServer, c *redisConn, args []string) interface{} {
+	key := args[1]
+	var (
+		expireAt       time.Time
+		nx, xx, keep   bool
+		expirationSeen bool
+	)
+	for i := 3; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); option {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keep = true
+		case "EX", "PX":
+			if i+1 >= len(args) || expirationSeen {
+				return errSyntax
+			}
+			at, ok := expiry(option, args[i+1])
+			if !ok {
+				return errNotInteger
+			}
+			expireAt, expirationSeen = at, true
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	if nx && xx {
+		return errSyntax
+	}
+	exists := s.lookup(key) != nil
+	if nx && exists || xx && !exists {
+		return nil
+	}
+	s.set(key, args[2], expireAt, keep)
+	return replyOK
+}
+
+func cmdSetNX(s *RedisServer, c *redisConn, args []string) interface{} {
+	if s.lookup(args[1]) != nil {
+		return 0
+	}
+	s.set(args[1], args[2], time.Time{}, false)
+	return 1
+}
+
+func cmdGetSet(s *RedisServer, c *redisConn, args []string) interface{} {
+	old := cmdGet(s, c, args[:2])
+	if _, ok := old.(redisError); !ok {
+		s.set(args[1], args[2], time.Time{}, false)
+	}
+	return old
+}
+
+func cmdMGet(s *RedisServer, c *redisConn, args []string) interface{} {
+	values := make([]interface{}, len(args)-1)
+	for i, key := range args[1:] {
+		if v := s.lookup(key); v != nil && v.kind == typeString {
+			values[i] = v.str
+		}
+	}
+	return values
+}
+
+func cmdMSet(s *RedisServer, c *redisConn, args []string) interface{} {
+	if len(args)%2 == 0 {
+		return arityError(args[0])
+	}
+	for i := 1; i < len(args); i += 2 {
+		s.set(args[i], args[i+1], time.Time{}, false)
+	}
+	return replyOK
+}
+
+func cmdIncr(s *RedisServer, c *redisConn, args []string) interface{} {
+	step := int64(1)
+	if len(args) > 2 {
+		var err error
+		if step, err = strconv.ParseInt(args[2], 10, 64); err != nil {
+			return errNotInteger
+		}
+	}
+	if strings.HasPrefix(args[0], "DECR") {
+		step = -step
+	}
+	v, err := s.typed(args[1], typeString, false)
+	if err != nil {
+		return err
+	}
+	var n int64
+	if v != nil {
+		var err error
+		if n, err = strconv.ParseInt(v.str, 10, 64); err != nil {
+			return errNotInteger
+		}
+	}
+	n += step
+	s.set(args[1], strconv.FormatInt(n, 10), time.Time{}, true)
+	return n
+}
+
+func cmdIncrByFloat(s *RedisServer, c *redisConn, args []string) interface{} {
+	step, err := strconv.ParseFloat(args[2], 64)
+	if err != nil {
+		return errNotFloat
+	}
+	v, rerr := s.typed(args[1], typeString, false)
+	if rerr != nil {
+		return rerr
+	}
+	var f float64
+	if v != nil {
+		if f, err = strconv.ParseFloat(v.str, 64); err != nil {
+			return errNotFloat
+		}
+	}
+	f += step
+	s.set(args[1], formatFloat(f), time.Time{}, true)
+	return formatFloat(f)
+}
+
+func cmdHSet(s *RedisServer, c *redisConn, args []string) interface{} {
+	if len(args)%2 != 0 {
+		return arityError(args[0])
+	}
+	v, err := s.typed(args[1], typeHash, true)
+	if err != nil {
+		return err
+	}
+	var n int
+	for i := 2; i < len(args); i += 2 {
+		if _, has := v.hash[args[i]]; !has {
+			n++
+		}
+		v.hash[args[i]] = args[i+1]
+	}
+	s.changed(args[1], v)
+	if args[0] == "HMSET" {
+		return replyOK
+	}
+	return n
+}
+
+func cmdHGet(s *RedisServer, c *redisConn, args []string) interface{} {
+	v, err := s.typed(args[1], typeHash, false)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	if value, has := v.hash[args[2]]; has {
+		return value
+	}
+	return nil
+}
+
+func cmdHGetAll(s *RedisServer, c *redisConn, args []string) interface{} {
+	v, err := s.typed(args[1], typeHash, false)
+	if err != nil {
+		return err
+	}
+	pairs := []string{}
+	if v != nil {
+		for field, value := range v.hash {
+			pairs = append(pairs, field, value)
+		}
+	}
+	return pairs
+}
+
+func cmdHDel(s *RedisServer, c *redisConn, args []string) interface{} {
+	v, err := s.typed(args[1], typeHash, false)
+	if err != nil || v == nil {
+		return orZero(err)
+	}
+	var n int
+	for _, field := range args[2:] {
+		if _, has := v.hash[field]; has {
+			delete(v.hash, field)
+			n++
+		}
+	}
+	s.changed(args[1], v)
+	return n
+}
+
+func cmdHLen(s *RedisServer, c *redisConn, args []string) interface{} {
+	v, err := s.typed(args[1], typeHash, false)
+	if err != nil || v == nil {
+		return orZero(err)
+	}
+	return len(v.hash)
+}
+
+// orZero returns the error reply err, or 0 for a missing key.
+func orZero(err interface{}) interface{} {
+	if err != nil {
+		return err
+	}
+	return 0
+}
+
+func cmdPush(s *RedisServer, c *redisConn, args []string) interface{} {
+	v, err := s.typed(args[1], typeList, true)
+	if err != nil {
+		return err
+	}
+	for _, value := range args[2:] {
+		if args[0] == "LPUSH" {
+			v.list = append([]string{value}, v.list...)
+		} else {
+			v.list = append(v.list, value)
+		}
+	}
+	s.changed(args[1], v)
+	return len(v.list)
+}
+
+func cmdPop(s *RedisServer, c *redisConn, args []string) interface{} {
+	v, err := s.typed(args[1], typeList, false)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	var value string
+	if args[0] == "LPOP" {
+		value, v.list = v.list[0], v.list[1:]
+	} else {
+		value, v.list = v.list[len(v.list)-1], v.list[:len(v.list)-1]
+	}
+	s.changed(args[1], v)
+	return value
+}
+
+// span resolves the inclusive range of indexes start and stop, negative ones
+// counting from the end, over n elements.
+func span(start, stop string, n int) (int, int, interface{}) {
+	lo, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, 0, errNotInteger
+	}
+	hi, err := strconv.Atoi(stop)
+	if err != nil {
+		return 0, 0, errNotInteger
+	}
+	if lo < 0 {
+		lo += n
+	}
+	if hi < 0 {
+		hi += n
+	}
+	if lo < 0 {
+		lo = 0
+	}
+	if hi >= n {
+		hi = n - 1
+	}
+	return lo, hi, nil
+}
+
+func cmdLRange(s *RedisServer, c *redisConn, args []string) interface{} {
+	v, err := s.typed(args[1], typeList, false)
+	if err != nil {
+		return err
+	}
+	values := []string{}
+	if v == nil {
+		return values
+	}
+	lo, hi, err := span(args[2], args[3], len(v.list))
+	if err != nil {
+		return err
+	}
+	for i := lo; i <= hi; i++ {
+		values = append(values, v.list[i])
+	}
+	return values
+}
+
+func cmdLLen(s *RedisServer, c *redisConn, args []string) interface{} {
+	v, err := s.typed(args[1], typeList, false)
+	if err != nil || v == nil {
+		return orZero(err)
+	}
+	return len(v.list)
+}
+
+func cmdSAdd(s *RedisServer, c *redisConn, args []string) interface{} {
+	v, err := s.typed(args[1], typeSet, true)
+	if err != nil {
+		return err
+	}
+	var n int
+	for _, member := range args[2:] {
+		if !v.set[member] {
+			v.set[member] = true
+			n++
+		}
+	}
+	s.changed(args[1], v)
+	return n
+}
+
+func cmdSRem(s *RedisServer, c *redisConn, args []string) interface{} {
+	v, err := s.typed(args[1], typeSet, false)
+	if err != nil || v == nil {
+		return orZero(err)
+	}
+	var n int
+	for _, member := range args[2:] {
+		if v.set[member] {
+			delete(v.set, member)
+			n++
+		}
+	}
+	s.changed(args[1], v)
+	return n
+}
+
+func cmdSMembers(s *RedisServer, c *redisConn, args []string) interface{} {
+	return cmdSUnion(s, c, args)
+}
+
+func cmdSIsMember(s *RedisServer, c *redisConn, args []string) interface{} {
+	v, err := s.typed(args[1], typeSet, false)
+	if err != nil || v == nil {
+		return orZero(err)
+	}
+	if v.set[args[2]] {
+		return 1
+	}
+	return 0
+}
+
+func cmdSCard(s *RedisServer, c *redisConn, args []string) interface{} {
+	v, err := s.typed(args[1], typeSet, false)
+	if err != nil || v == nil {
+		return orZero(err)
+	}
+	return len(v.set)
+}
+
+func cmdSUnion(s *RedisServer, c *redisConn, args []string) interface{} {
+	union := make(map[string]bool)
+	for _, key := range args[1:] {
+		v, err := s.typed(key, typeSet, false)
+		if err != nil {
+			return err
+		}
+		if v != nil {
+			for member := range v.set {
+				union[member] = true
+			}
+		}
+	}
+	members := make([]string, 0, len(union))
+	for member := range union {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+func cmdZAdd(s *RedisServer, c *redisConn, args []string) interface{} {
+	if len(args)%2 != 0 {
+		return errSyntax
+	}
+	scores := make([]float64, 0, len(args)/2)
+	for i := 2; i < len(args); i += 2 {
+		score, err := strconv.ParseFloat(args[i], 64)
+		if err != nil {
+			return errNotFloat
+		}
+		scores = append(scores, score)
+	}
+	v, err := s.typed(args[1], typeZSet, true)
+	if err != nil {
+		return err
+	}
+	var n int
+	for i, score := range scores {
+		member := args[3+2*i]
+		if _, has := v.zset[member]; !has {
+			n++
+		}
+		v.zset[member] = score
+	}
+	s.changed(args[1], v)
+	return n
+}
+
+func cmdZIncrBy(s *RedisServer, c *redisConn, args []string) interface{} {
+	step, err := strconv.ParseFloat(args[2], 64)
+	if err != nil {
+		return errNotFloat
+	}
+	v, rerr := s.typed(args[1], typeZSet, true)
+	if rerr != nil {
+		return rerr
+	}
+	v.zset[args[3]] += step
+	s.changed(args[1], v)
+	return formatFloat(v.zset[args[3]])
+}
+
+func cmdZRem(s *RedisServer, c *redisConn, args []string) interface{} {
+	v, err := s.typed(args[1], typeZSet, false)
+	if err != nil || v == nil {
+		return orZero(err)
+	}
+	var n int
+	for _, member := range args[2:] {
+		if _, has := v.zset[member]; has {
+			delete(v.zset, member)
+			n++
+		}
+	}
+	s.changed(args[1], v)
+	return n
+}
+
+func cmdZScore(s *RedisServer, c *redisConn, args []string) interface{} {
+	v, err := s.typed(args[1], typeZSet, false)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	if score, has := v.zset[args[2]]; has {
+		return formatFloat(score)
+	}
+	return nil
+}
+
+func cmdZCard(s *RedisServer, c *redisConn, args []string) interface{} {
+	v, err := s.typed(args[1], typeZSet, false)
+	if err != nil || v == nil {
+		return orZero(err)
+	}
+	return len(v.zset)
+}
+
+type scored struct {
+	member string
+	score  float64
+}
+
+// sorted returns the members of a sorted set by score, then member, reversed when rev is set.
+func sorted(v *redisValue, rev bool) []scored {
+	var members []scored
+	if v != nil {
+		for member, score := range v.zset {
+			members = append(members, scored{member, score})
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		a, b := members[i], members[j]
+		if rev {
+			a, b = b, a
+		}
+		if a.score != b.score {
+			return a.score < b.score
+		}
+		return a.member < b.member
+	})
+	return members
+}
+
+func withScores(members []scored, scores bool) []string {
+	v := []string{}
+	for _, m := range members {
+		v = append(v, m.member)
+		if scores {
+			v = append(v, formatFloat(m.score))
+		}
+	}
+	return v
+}
+
+func cmdZRange(s *RedisServer, c *redisConn, args []string) interface{} {
+	var scores bool
+	for _, option := range args[4:] {
+		if strings.ToUpper(option) != "WITHSCORES" {
+			return errSyntax
+		}
+		scores = true
+	}
+	v, err := s.typed(args[1], typeZSet, false)
+	if err != nil {
+		return err
+	}
+	members := sorted(v, args[0] == "ZREVRANGE")
+	lo, hi, err := span(args[2], args[3], len(members))
+	if err != nil {
+		return err
+	}
+	if lo > hi {
+		return []string{}
+	}
+	return withScores(members[lo:hi+1], scores)
+}
+
+// bound parses a score bound of ZRANGEBYSCORE, exclusive when it starts with "(".
+func bound(s string) (float64, bool, bool) {
+	exclusive := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+	switch strings.ToLower(s) {
+	case "-inf":
+		return math.Inf(-1), exclusive, true
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, exclusive, err == nil
+}
+
+func cmdZRangeByScore(s *RedisServer, c *redisConn, args []string) interface{} {
+	rev := args[0] == "ZREVRANGEBYSCORE"
+	min, max := args[2], args[3]
+	if rev {
+		min, max = max, min
+	}
+	lo, loEx, ok1 := bound(min)
+	hi, hiEx, ok2 := bound(max)
+	if !ok1 || !ok2 {
+		return redisError("ERR min or max is not a float")
+	}
+	var scores bool
+	offset, count := 0, -1
+	for i := 4; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			scores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return errSyntax
+			}
+			var err1, err2 error
+			offset, err1 = strconv.Atoi(args[i+1])
+			count, err2 = strconv.Atoi(args[i+2])
+			if err1 != nil || err2 != nil {
+				return errNotInteger
+			}
+			i += 2
+		default:
+			return errSyntax
+		}
+	}
+	v, err := s.typed(args[1], typeZSet, false)
+	if err != nil {
+		return err
+	}
+	var members []scored
+	for _, m := range sorted(v, rev) {
+		if m.score < lo || loEx && m.score == lo || m.score > hi || hiEx && m.score == hi {
+			continue
+		}
+		members = append(members, m)
+	}
+	if offset >= len(members) {
+		members = nil
+	} else {
+		members = members[offset:]
+	}
+	if count >= 0 && count < len(members) {
+		members = members[:count]
+	}
+	return withScores(members, scores)
+}
@@ -0,0 +1,561 @@
+// Package cachetest checks that cache.ICache implementations honor the
+// contract of the interface, so that every backend behaves the same. It also
+// provides an in-process Redis server to test the Redis backend offline.
+package cachetest
+
+import (
+	"bytes"
+	"context"
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/cache/namespace"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Opener returns an empty cache for a test, closing it once the test ends,
+// for instance with t.Cleanup.
+type Opener func(t *testing.T) cache.ICache
+
+// Run runs the conformance suite, each subtest against a cache open returns.
+func Run(t *testing.T, open Opener) {
+	t.Run("TypedGetters", func(t *testing.T) { testTypedGetters(t, open(t)) })
+	t.Run("TTL", func(t *testing.T) { testTTL(t, open(t)) })
+	t.Run("Expiry", func(t *testing.T) { testExpiry(t, open(t)) })
+	t.Run("Conditional", func(t *testing.T) { testConditional(t, open(t)) })
+	t.Run("Scans", func(t *testing.T) { testScans(t, open(t)) })
+	t.Run("Counters", func(t *testing.T) { testCounters(t, open(t)) })
+	t.Run("MGet", func(t *testing.T) { testMGet(t, open(t)) })
+	t.Run("Tags", func(t *testing.T) { testTags(t, open(t)) })
+	t.Run("Del", func(t *testing.T) { testDel(t, open(t)) })
+	t.Run("Collections", func(t *testing.T) { testCollections(t, open(t)) })
+	t.Run("CollectionScans", func(t *testing.T) { testCollectionScans(t, open(t)) })
+	t.Run("PubSub", func(t *testing.T) { testPubSub(t, open(t)) })
+	t.Run("Loads", func(t *testing.T) { testLoads(t, open(t)) })
+	t.Run("ViewLoads", func(t *testing.T) { testViewLoads(t, open(t)) })
+	t.Run("Chain", func(t *testing.T) { testChain(t, open) })
+}
+
+type record struct {
+	Name  string   `json:"name"`
+	Count int      `json:"count"`
+	Tags  []string `json:"tags"`
+}
+
+func testTypedGetters(t *testing.T, c cache.ICache) {
+	now := time.Now().UTC().Truncate(time.Second)
+	assert.Nil(t, c.Set("int", -42))
+	assert.Nil(t, c.Set("uint", 42))
+	assert.Nil(t, c.Set("float", 1.5))
+	assert.Nil(t, c.Set("string", "hello"))
+	assert.Nil(t, c.Set("bool", true))
+	assert.Nil(t, c.Set("time", now))
+	assert.Nil(t, c.Set("record", &record{Name: "a", Count: 2, Tags: []string{"x"}}))
+
+	assert.True(t, c.Has("int"))
+	assert.False(t, c.Has("missing"))
+	assert.Equal(t, -42, c.GetInt("int"))
+	assert.Equal(t, int64(-42), c.GetInt64("int"))
+	assert.Equal(t, uint(42), c.GetUint("uint"))
+	assert.Equal(t, uint8(42), c.GetUint8("uint"))
+	assert.Equal(t, 1.5, c.GetFloat("float"))
+	assert.Equal(t, float32(1.5), c.GetFloat32("float"))
+	assert.Equal(t, "hello", c.GetString("string"))
+	assert.True(t, c.GetBool("bool"))
+	assert.True(t, now.Equal(c.GetTime("time")))
+
+	var r record
+	assert.True(t, c.HasGet("record", &r))
+	assert.Equal(t, record{Name: "a", Count: 2, Tags: []string{"x"}}, r)
+
+	v, has := c.HasGetString("missing")
+	assert.False(t, has)
+	assert.Equal(t, "", v)
+	assert.Equal(t, 7, c.DefaultGetInt("missing", 7))
+	assert.Equal(t, -42, c.DefaultGetInt("int", 7))
+	assert.Equal(t, "default", c.DefaultGetString("missing", "default"))
+}
+
+func testTTL(t *testing.T, c cache.ICache) {
+	assert.Nil(t, c.Set("forever", 1))
+	ttl, has := c.TTL("forever")
+	assert.True(t, has)
+	assert.Equal(t, time.Duration(0), ttl)
+
+	assert.Nil(t, c.Set("minute", 1, time.Minute))
+	ttl, has = c.TTL("minute")
+	assert.True(t, has)
+	assert.True(t, ttl > 50*time.Second && ttl <= time.Minute, "ttl %v", ttl)
+
+	ttl, has = c.TTL("missing")
+	assert.False(t, has)
+	assert.Equal(t, time.Duration(0), ttl)
+
+	has, err := c.Expire("minute", time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, has)
+	ttl, _ = c.TTL("minute")
+	assert.True(t, ttl > time.Minute, "ttl %v", ttl)
+
+	has, err = c.Persist("minute")
+	assert.Nil(t, err)
+	assert.True(t, has)
+	ttl, has = c.TTL("minute")
+	assert.True(t, has)
+	assert.Equal(t, time.Duration(0), ttl)
+	assert.Equal(t, 1, c.GetInt("minute"))
+
+	has, err = c.Expire("missing", time.Hour)
+	assert.Nil(t, err)
+	assert.False(t, has)
+}
+
+func testExpiry(t *testing.T, c cache.ICache) {
+	assert.Nil(t, c.Set("short", "v", 50*time.Millisecond))
+	assert.Nil(t, c.Set("touched", "v", 100*time.Millisecond))
+	assert.Nil(t, c.Set("kept", "v"))
+	assert.True(t, c.Has("short"))
+
+	time.Sleep(60 * time.Millisecond)
+	has, err := c.Touch("touched")
+	assert.Nil(t, err)
+	assert.True(t, has)
+	time.Sleep(60 * time.Millisecond)
+
+	assert.False(t, c.Has("short"))
+	_, has = c.HasGetString("short")
+	assert.False(t, has)
+	assert.True(t, c.Has("touched"))
+	assert.True(t, c.Has("kept"))
+
+	has, err = c.ExpireAt("kept", time.Now().Add(-time.Second))
+	assert.Nil(t, err)
+	assert.True(t, has)
+	assert.False(t, c.Has("kept"))
+}
+
+func testConditional(t *testing.T, c cache.ICache) {
+	ok, err := c.SetXX("k", 1)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = c.SetNX("k", 1)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, _ = c.SetNX("k", 2)
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.GetInt("k"))
+	ok, _ = c.SetXX("k", 2)
+	assert.True(t, ok)
+
+	var old int
+	has, err := c.GetSet("k", 3, &old)
+	assert.Nil(t, err)
+	assert.True(t, has)
+	assert.Equal(t, 2, old)
+	has, err = c.GetSet("fresh", 1, &old)
+	assert.Nil(t, err)
+	assert.False(t, has)
+
+	ok, err = c.CompareAndSwap("k", 2, 4)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = c.CompareAndSwap("k", 3, 4)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 4, c.GetInt("k"))
+}
+
+func testScans(t *testing.T, c cache.ICache) {
+	for _, key := range []string{"user:1:name", "user:2:name", "user:1:mail", "order:1"} {
+		assert.Nil(t, c.Set(key, key))
+	}
+
+	found, err := c.HasPrefix("user:")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user:1:mail", "user:1:name", "user:2:name"}, keys(found))
+	assert.Equal(t, "user:1:name", found["user:1:name"])
+	found, err = c.HasSuffix(":name")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user:1:name", "user:2:name"}, keys(found))
+	found, err = c.Contains(":1:")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"user:1:mail", "user:1:name"}, keys(found))
+	found, err = c.HasPrefix("user:", 1)
+	assert.Nil(t, err)
+	assert.Len(t, found, 1)
+	found, err = c.HasPrefix("nobody")
+	assert.Nil(t, err)
+	assert.Len(t, found, 0)
+
+	var (
+		scanned []string
+		cursor  string
+	)
+	for i := 0; i < 100; i++ {
+		items, next, err := c.Scan("user:", cursor, 1)
+		if !assert.Nil(t, err) {
+			return
+		}
+		for _, item := range items {
+			scanned = append(scanned, item.Key)
+		}
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	sort.Strings(scanned)
+	assert.Equal(t, []string{"user:1:mail", "user:1:name", "user:2:name"}, scanned)
+}
+
+func keys(found map[string]string) []string {
+	v := make([]string, 0, len(found))
+	for key := range found {
+		v = append(v, key)
+	}
+	sort.Strings(v)
+	return v
+}
+
+func testCounters(t *testing.T, c cache.ICache) {
+	n, err := c.Incr("n")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = c.IncrBy("n", 9)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, n)
+	n, err = c.IncrBy("n", -3)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, n)
+	assert.Equal(t, 7, c.GetInt("n"))
+	assert.True(t, c.Has("n"))
+
+	f, err := c.IncrByFloat("f", 0.5)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.5, f)
+	f, err = c.IncrByFloat("f", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, f)
+	assert.Equal(t, 1.5, c.GetFloat("f"))
+
+	// counters keep counting from values that were set
+	assert.Nil(t, c.Set("set", 5))
+	n, err = c.Incr("set")
+	assert.Nil(t, err)
+	assert.Equal(t, 6, n)
+
+	// counters keep the expiration of the value they count from
+	assert.Nil(t, c.Set("expiring", 1, time.Minute))
+	n, err = c.Incr("expiring")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	_, err = c.IncrByFloat("expiring", 0.5)
+	assert.Nil(t, err)
+	ttl, has := c.TTL("expiring")
+	assert.True(t, has)
+	assert.True(t, ttl > 50*time.Second && ttl <= time.Minute, "ttl %v", ttl)
+
+	// concurrent increments are never lost
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				_, _ = c.Incr("concurrent")
+				_, _ = c.IncrByFloat("concurrent-float", 0.5)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 200, c.GetInt("concurrent"))
+	assert.Equal(t, float64(100), c.GetFloat("concurrent-float"))
+}
+
+func testMGet(t *testing.T, c cache.ICache) {
+	assert.Nil(t, c.MSet(map[string]interface{}{"a": 1, "b": "two"}, time.Minute))
+	items, err := c.MGet("a", "b", "missing")
+	assert.Nil(t, err)
+	assert.Len(t, items, 2)
+	var b string
+	if assert.Contains(t, items, "b") {
+		assert.Nil(t, items["b"].Bind(&b))
+		assert.Equal(t, "two", b)
+		assert.True(t, items["b"].TTL > 0 && items["b"].TTL <= time.Minute)
+	}
+	assert.Equal(t, 1, c.GetInt("a"))
+}
+
+func testTags(t *testing.T, c cache.ICache) {
+	assert.Nil(t, c.SetWithTags("a", 1, []string{"t1"}))
+	assert.Nil(t, c.SetWithTags("b", 2, []string{"t1", "t2"}))
+	assert.Nil(t, c.SetWithTags("c", 3, []string{"t2"}))
+	assert.Nil(t, c.Set("d", 4))
+
+	assert.Nil(t, c.InvalidateTags("t1"))
+	assert.False(t, c.Has("a"))
+	assert.False(t, c.Has("b"))
+	assert.True(t, c.Has("c"))
+	assert.True(t, c.Has("d"))
+	assert.Nil(t, c.InvalidateTags("unknown"))
+
+	// keys set again without a tag, or deleted then set again, lose it
+	assert.Nil(t, c.SetWithTags("reset", 1, []string{"t3"}))
+	assert.Nil(t, c.Set("reset", 2))
+	assert.Nil(t, c.SetWithTags("retagged", 1, []string{"t3", "t4"}))
+	assert.Nil(t, c.SetWithTags("retagged", 2, []string{"t4"}))
+	assert.Nil(t, c.SetWithTags("deleted", 1, []string{"t3"}))
+	assert.Nil(t, c.Del("deleted"))
+	assert.Nil(t, c.Set("deleted", 2))
+	assert.Nil(t, c.SetWithTags("kept", 1, []string{"t3"}))
+	assert.Nil(t, c.InvalidateTags("t3"))
+	assert.Equal(t, 2, c.GetInt("reset"))
+	assert.Equal(t, 2, c.GetInt("retagged"))
+	assert.Equal(t, 2, c.GetInt("deleted"))
+	assert.False(t, c.Has("kept"))
+	assert.Nil(t, c.InvalidateTags("t4"))
+	assert.False(t, c.Has("retagged"))
+}
+
+func testDel(t *testing.T, c cache.ICache) {
+	assert.Nil(t, c.Set("a", 1))
+	assert.Nil(t, c.Set("b", 2))
+	assert.Nil(t, c.Del("a", "b", "missing"))
+	assert.False(t, c.Has("a"))
+	assert.False(t, c.Has("b"))
+	assert.Nil(t, c.Del())
+}
+
+// testCollectionScans checks that MGet and key scans return the values only,
+// skipping the collections they cover.
+func testCollectionScans(t *testing.T, c cache.ICache) {
+	assert.Nil(t, c.Set("app:a", "a"))
+	_, err := c.HSet("app:h", map[string]interface{}{"f": 1})
+	assert.Nil(t, err)
+	_, err = c.RPush("app:l", "x")
+	assert.Nil(t, err)
+	_, err = c.SAdd("app:s", "x")
+	assert.Nil(t, err)
+
+	items, err := c.MGet("app:a", "app:h", "app:l")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(items))
+	assert.NotNil(t, items["app:a"])
+
+	scanned, cursor, err := c.Scan("app:", "", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "", cursor)
+	if assert.Equal(t, 1, len(scanned)) {
+		assert.Equal(t, "app:a", scanned[0].Key)
+	}
+	values, err := c.HasPrefix("app:")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"app:a": "a"}, values)
+
+	var b bytes.Buffer
+	n, err := cache.Dump(&b, c, "app:")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	// the collections are left as they were
+	v, has, err := c.HGet("app:h", "f")
+	assert.Nil(t, err)
+	assert.True(t, has)
+	assert.Equal(t, "1", v)
+}
+
+func testCollections(t *testing.T, c cache.ICache) {
+	n, err := c.HSet("h", map[string]interface{}{"a": 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	v, has, err := c.HGet("h", "a")
+	assert.Nil(t, err)
+	assert.True(t, has)
+	assert.Equal(t, "1", v)
+	n, _ = c.HDel("h", "a", "b")
+	assert.Equal(t, 1, n)
+
+	n, err = c.RPush("l", "a", "b")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, _ = c.LPush("l", "z")
+	assert.Equal(t, 3, n)
+	list, err := c.LRange("l", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"z", "a", "b"}, list)
+	v, has, _ = c.RPop("l")
+	assert.True(t, has)
+	assert.Equal(t, "b", v)
+
+	n, _ = c.SAdd("s", "a", "b", "a")
+	assert.Equal(t, 2, n)
+	is, err := c.SIsMember("s", "a")
+	assert.Nil(t, err)
+	assert.True(t, is)
+	members, _ := c.SMembers("s")
+	sort.Strings(members)
+	assert.Equal(t, []string{"a", "b"}, members)
+
+	n, _ = c.ZAdd("z", cache.Z{Member: "a", Score: 2}, cache.Z{Member: "b", Score: 1})
+	assert.Equal(t, 2, n)
+	score, err := c.ZIncrBy("z", 2, "b")
+	assert.Nil(t, err)
+	assert.Equal(t, float64(3), score)
+	zs, err := c.ZRange("z", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.Z{{Member: "a", Score: 2}, {Member: "b", Score: 3}}, zs)
+	zs, _ = c.ZRangeByScore("z", 2.5, 10)
+	assert.Equal(t, []cache.Z{{Member: "b", Score: 3}}, zs)
+
+	_, err = c.SAdd("l", "x")
+	assert.Equal(t, cache.ErrWrongType, err)
+}
+
+func testPubSub(t *testing.T, c cache.ICache) {
+	received := make(chan string, 1)
+	sub, err := c.PSubscribe([]string{"news.*"}, func(channel string, message string) {
+		received <- channel + ":" + message
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer sub.Close()
+	assert.Nil(t, c.Publish("news.sport", "goal"))
+	select {
+	case msg := <-received:
+		assert.Equal(t, "news.sport:goal", msg)
+	case <-time.After(time.Second):
+		t.Fatal("message not delivered")
+	}
+}
+
+// testLoads checks that concurrent loads of the same key in two namespaces
+// each run their own loader and store their own value.
+func testLoads(t *testing.T, c cache.ICache) {
+	a, err := namespace.NewNamespaceCache(c, "a")
+	if !assert.Nil(t, err) {
+		return
+	}
+	b, _ := namespace.NewNamespaceCache(c, "b")
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var va, vb string
+	doneA, doneB := make(chan error, 1), make(chan error, 1)
+	go func() {
+		doneA <- a.GetOrLoad("k", &va, time.Minute, func() (interface{}, error) {
+			close(started)
+			<-release
+			return "A", nil
+		})
+	}()
+	<-started
+	go func() {
+		doneB <- b.GetOrLoad("k", &vb, time.Minute, func() (interface{}, error) {
+			return "B", nil
+		})
+	}()
+	// b must not wait for the load of a
+	select {
+	case err := <-doneB:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		close(release)
+		t.Fatal("the load of b waited for the load of a")
+	}
+	close(release)
+	assert.Nil(t, <-doneA)
+
+	assert.Equal(t, "A", va)
+	assert.Equal(t, "B", vb)
+	assert.Equal(t, "A", a.GetString("k"))
+	assert.Equal(t, "B", b.GetString("k"))
+	assert.True(t, b.Has("k"))
+}
+
+// testViewLoads checks that concurrent loads of the same key through two
+// views of c returned by WithContext share a single loader call.
+func testViewLoads(t *testing.T, c cache.ICache) {
+	a, b := c.WithContext(context.Background()), c.WithContext(context.Background())
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls int32
+	var va, vb string
+	doneA, doneB := make(chan error, 1), make(chan error, 1)
+	go func() {
+		doneA <- a.GetOrLoad("view", &va, time.Minute, func() (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			close(started)
+			<-release
+			return "A", nil
+		})
+	}()
+	<-started
+	go func() {
+		doneB <- b.GetOrLoad("view", &vb, time.Minute, func() (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			return "B", nil
+		})
+	}()
+	// give b the time to join the load of a
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	assert.Nil(t, <-doneA)
+	assert.Nil(t, <-doneB)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, "A", va)
+	assert.Equal(t, "A", vb)
+}
+
+// testChain checks that a chain of two levels writes through and reads
+// through, backfilling the child level, and propagates deletions.
+func testChain(t *testing.T, open Opener) {
+	child, parent := open(t), open(t)
+	c, err := cache.NewCache([]cache.ICache{child, parent})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, parent, c.Parent())
+	assert.Equal(t, child, parent.Children())
+
+	// writes go through every level
+	assert.Nil(t, c.Set("a", 1, time.Minute))
+	assert.Equal(t, 1, child.Local().GetInt("a"))
+	assert.Equal(t, 1, parent.GetInt("a"))
+
+	// reads fall through to the parent and fill the child with its TTL
+	assert.Nil(t, parent.Set("b", "parent", time.Minute))
+	assert.False(t, child.Local().Has("b"))
+	assert.Equal(t, "parent", c.GetString("b"))
+	assert.True(t, child.Local().Has("b"))
+	ttl, has := child.Local().TTL("b")
+	assert.True(t, has)
+	assert.True(t, ttl > 0 && ttl <= time.Minute, "ttl %v", ttl)
+	assert.True(t, c.Has("b"))
+
+	items, err := c.MGet("a", "b", "missing")
+	assert.Nil(t, err)
+	assert.Len(t, items, 2)
+
+	// deletions reach every level
+	assert.Nil(t, c.Del("a", "b"))
+	assert.False(t, child.Local().Has("a"))
+	assert.False(t, parent.Has("a"))
+	assert.False(t, c.Has("b"))
+
+	// counters live at the top of the chain
+	n, err := c.Incr("n")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 1, parent.GetInt("n"))
+	assert.Equal(t, 1, c.GetInt("n"))
+	n, _ = c.Incr("n")
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 2, c.GetInt("n"))
+
+	// local views never reach the parent
+	assert.Nil(t, c.Local().Set("local", 1))
+	assert.False(t, parent.Has("local"))
+}
@@ -0,0 +1,497 @@
+package cache
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/motclub/common/json"
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	CodecJSON    = "json"
+	CodecMsgpack = "msgpack"
+	CodecGob     = "gob"
+	CodecRaw     = "raw"
+
+	CompressionNone   = ""
+	CompressionSnappy = "snappy"
+	CompressionZstd   = "zstd"
+)
+
+var (
+	ErrUnknownCodec       = errors.New(`mot: unknown codec`)
+	ErrUnknownCompression = errors.New(`mot: unknown compression`)
+	ErrInvalidEnvelope    = errors.New(`mot: invalid value envelope`)
+)
+
+// ICodec encodes the values stored by cache levels.
+type ICodec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, dst interface{}) error
+}
+
+// ICompressor compresses encoded values above the threshold of a level.
+type ICompressor interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	codecsMu    sync.RWMutex
+	codecs      = make(map[string]ICodec)
+	compressors = make(map[string]ICompressor)
+)
+
+func init() {
+	RegisterCodec(jsonCodec{})
+	RegisterCodec(msgpackCodec{})
+	RegisterCodec(gobCodec{})
+	RegisterCodec(rawCodec{})
+	RegisterCodec(collectionCodec{})
+	RegisterCompressor(snappyCompressor{})
+	RegisterCompressor(&zstdCompressor{})
+}
+
+// RegisterCodec makes a codec available by name, replacing any codec of the same name.
+func RegisterCodec(c ICodec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[c.Name()] = c
+}
+
+// LookupCodec returns the codec registered as name, the JSON codec for an empty name.
+func LookupCodec(name string) (ICodec, error) {
+	if name == "" {
+		name = CodecJSON
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	if c, has := codecs[name]; has {
+		return c, nil
+	}
+	return nil, ErrUnknownCodec
+}
+
+// RegisterCompressor makes a compressor available by name, replacing any compressor of the same name.
+func RegisterCompressor(c ICompressor) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	compressors[c.Name()] = c
+}
+
+func lookupCompressor(name string) (ICompressor, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	if c, has := compressors[name]; has {
+		return c, nil
+	}
+	return nil, ErrUnknownCompression
+}
+
+// Unmarshal decodes data encoded by the named codec into dst.
+func Unmarshal(codec string, data []byte, dst interface{}) error {
+	c, err := LookupCodec(codec)
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(data, dst)
+}
+
+// DataString returns data encoded by the named codec as HasPrefix and friends report it.
+func DataString(codec string, data []byte) string {
+	switch codec {
+	case "", CodecJSON:
+		return ValueString(data)
+	case CodecRaw:
+		return string(data)
+	}
+	var v interface{}
+	if err := Unmarshal(codec, data, &v); err != nil {
+		return string(data)
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+type CodecOptions struct {
+	// Codec encodes the values, JSON by default.
+	Codec string `json:"codec"`
+	// Compression compresses the encoded values of at least CompressThreshold bytes.
+	Compression       string `json:"compression"`
+	CompressThreshold int    `json:"compress_threshold"`
+}
+
+// Envelope is a stored value along with its expiration.
+type Envelope struct {
+	ExpiredDuration time.Duration
+	CreatedAt       time.Time
+	// Codec is the name of the codec Data is encoded with.
+	Codec string
+	Data  []byte
+	// Tags are the tags the value was set with, for the levels that record them with it.
+	Tags []string
+}
+
+// Remaining returns the time to live left at now, 0 when the value does not expire.
+func (e *Envelope) Remaining(now time.Time) time.Duration {
+	if e.ExpiredDuration <= 0 {
+		return 0
+	}
+	return e.CreatedAt.Add(e.ExpiredDuration).Sub(now)
+}
+
+// Expired reports whether the value has expired at now.
+func (e *Envelope) Expired(now time.Time) bool {
+	return e.ExpiredDuration > 0 && e.Remaining(now) <= 0
+}
+
+// Item returns the envelope as the item of key.
+func (e *Envelope) Item(key string, now time.Time) *Item {
+	return &Item{Key: key, Value: e.Data, Codec: e.Codec, TTL: e.Remaining(now)}
+}
+
+// Equal reports whether e holds old: either an *Item read earlier, compared as
+// it was encoded, or a value, compared once encoded with the codec of e.
+func (e *Envelope) Equal(old interface{}) (bool, error) {
+	if item, ok := old.(*Item); ok {
+		return codecName(item.Codec) == codecName(e.Codec) && bytes.Equal(item.Value, e.Data), nil
+	}
+	c, err := LookupCodec(e.Codec)
+	if err != nil {
+		return false, err
+	}
+	data, err := c.Marshal(old)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(data, e.Data), nil
+}
+
+func codecName(name string) string {
+	if name == "" {
+		return CodecJSON
+	}
+	return name
+}
+
+// envelopeMagic starts the binary envelopes. Earlier JSON envelopes start with '{'
+// and bare values written by INCR never start with a NUL byte.
+const (
+	envelopeMagic   = 0x00
+	envelopeVersion = 1
+	// envelopeTagsVersion is the version of the envelopes carrying tags.
+	envelopeTagsVersion = 2
+)
+
+// EnvelopeCodec writes values in a self-describing binary envelope:
+//
+//	magic, version, codec name, compression name, expiration, creation time, [tags,] data
+//
+// Names are length prefixed and the durations are varints, so that any level can
+// decode the entries written by any other, whatever their options. Tags are a
+// varint count followed by the tags, length prefixed as varints too, and are
+// only written by version 2, for the envelopes that carry some.
+type EnvelopeCodec struct {
+	codec      ICodec
+	compressor ICompressor
+	threshold  int
+}
+
+func NewEnvelopeCodec(o *CodecOptions) (*EnvelopeCodec, error) {
+	var opts CodecOptions
+	if o != nil {
+		opts = *o
+	}
+	codec, err := LookupCodec(opts.Codec)
+	if err != nil {
+		return nil, err
+	}
+	e := &EnvelopeCodec{codec: codec, threshold: opts.CompressThreshold}
+	if opts.Compression != CompressionNone {
+		if e.compressor, err = lookupCompressor(opts.Compression); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// Marshal encodes value with the codec of the level into a new envelope.
+func (c *EnvelopeCodec) Marshal(value interface{}, expiration time.Duration) (*Envelope, error) {
+	data, err := c.codec.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{ExpiredDuration: expiration, CreatedAt: time.Now(), Codec: c.codec.Name(), Data: data}, nil
+}
+
+// Encode returns the stored form of e, compressing its data above the threshold.
+func (c *EnvelopeCodec) Encode(e *Envelope) ([]byte, error) {
+	data, compression := e.Data, CompressionNone
+	if c.compressor != nil && len(data) >= c.threshold {
+		var err error
+		if data, err = c.compressor.Compress(data); err != nil {
+			return nil, err
+		}
+		compression = c.compressor.Name()
+	}
+	codec := e.Codec
+	if codec == "" {
+		codec = CodecJSON
+	}
+
+	version := byte(envelopeVersion)
+	if len(e.Tags) > 0 {
+		version = envelopeTagsVersion
+	}
+	b := make([]byte, 0, len(data)+len(codec)+len(compression)+24)
+	b = append(b, envelopeMagic, version)
+	b = append(b, byte(len(codec)))
+	b = append(b, codec...)
+	b = append(b, byte(len(compression)))
+	b = append(b, compression...)
+	b = appendVarint(b, int64(e.ExpiredDuration))
+	b = appendVarint(b, e.CreatedAt.UnixNano())
+	if len(e.Tags) > 0 {
+		b = appendVarint(b, int64(len(e.Tags)))
+		for _, tag := range e.Tags {
+			b = appendVarint(b, int64(len(tag)))
+			b = append(b, tag...)
+		}
+	}
+	return append(b, data...), nil
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutVarint(buf[:], v)]...)
+}
+
+// IsEnvelope reports whether data was written by an EnvelopeCodec.
+func IsEnvelope(data []byte) bool {
+	return len(data) > 1 && data[0] == envelopeMagic
+}
+
+// DecodeEnvelope reads data written by an EnvelopeCodec.
+func DecodeEnvelope(data []byte) (*Envelope, error) {
+	if !IsEnvelope(data) || data[1] != envelopeVersion && data[1] != envelopeTagsVersion {
+		return nil, ErrInvalidEnvelope
+	}
+	r := bytes.NewReader(data[2:])
+	codec, err := readName(r)
+	if err != nil {
+		return nil, err
+	}
+	compression, err := readName(r)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := binary.ReadVarint(r)
+	if err != nil {
+		return nil, ErrInvalidEnvelope
+	}
+	created, err := binary.ReadVarint(r)
+	if err != nil {
+		return nil, ErrInvalidEnvelope
+	}
+	var tags []string
+	if data[1] == envelopeTagsVersion {
+		if tags, err = readTags(r); err != nil {
+			return nil, err
+		}
+	}
+	payload := data[len(data)-r.Len():]
+	if compression != CompressionNone {
+		c, err := lookupCompressor(compression)
+		if err != nil {
+			return nil, err
+		}
+		if payload, err = c.Decompress(payload); err != nil {
+			return nil, err
+		}
+	} else {
+		// data may be a buffer its owner reuses
+		payload = append([]byte(nil), payload...)
+	}
+	return &Envelope{
+		ExpiredDuration: time.Duration(exp),
+		CreatedAt:       time.Unix(0, created),
+		Codec:           codec,
+		Data:            payload,
+		Tags:            tags,
+	}, nil
+}
+
+func readTags(r *bytes.Reader) ([]string, error) {
+	n, err := binary.ReadVarint(r)
+	if err != nil || n < 0 || n > int64(r.Len()) {
+		return nil, ErrInvalidEnvelope
+	}
+	tags := make([]string, n)
+	for i := range tags {
+		size, err := binary.ReadVarint(r)
+		if err != nil || size < 0 || size > int64(r.Len()) {
+			return nil, ErrInvalidEnvelope
+		}
+		b := make([]byte, size)
+		_, _ = r.Read(b)
+		tags[i] = string(b)
+	}
+	return tags, nil
+}
+
+func readName(r *bytes.Reader) (string, error) {
+	n, err := r.ReadByte()
+	if err != nil || int(n) > r.Len() {
+		return "", ErrInvalidEnvelope
+	}
+	b := make([]byte, n)
+	_, _ = r.Read(b)
+	return string(b), nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return CodecJSON
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.STD().Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, dst interface{}) error {
+	return json.STD().Unmarshal(data, dst)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return CodecMsgpack
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, dst interface{}) error {
+	return msgpack.Unmarshal(data, dst)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string {
+	return CodecGob
+}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, dst interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(dst)
+}
+
+// rawCodec stores bytes and strings as is, and other values in the form Redis would store them.
+type rawCodec struct{}
+
+func (rawCodec) Name() string {
+	return CodecRaw
+}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	if b, ok := v.([]byte); ok {
+		return b, nil
+	}
+	s, err := FormatArg(v)
+	return []byte(s), err
+}
+
+func (rawCodec) Unmarshal(data []byte, dst interface{}) error {
+	switch dst := dst.(type) {
+	case *[]byte:
+		*dst = append((*dst)[:0], data...)
+		return nil
+	case *string:
+		*dst = string(data)
+		return nil
+	case *bool:
+		v, err := strconv.ParseBool(string(data))
+		*dst = v
+		return err
+	case *time.Time:
+		v, err := time.Parse(time.RFC3339Nano, string(data))
+		*dst = v
+		return err
+	case encoding.BinaryUnmarshaler:
+		return dst.UnmarshalBinary(data)
+	}
+	// numbers and booleans read back as JSON
+	return json.STD().Unmarshal(data, dst)
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Name() string {
+	return CompressionSnappy
+}
+
+func (snappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (snappyCompressor) Decompress(data []byte) ([]byte, error) {
+	return snappy.Decode(nil, data)
+}
+
+// zstdCompressor shares one encoder and one decoder, created on first use,
+// whose EncodeAll and DecodeAll may be called concurrently.
+type zstdCompressor struct {
+	once    sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+	err     error
+}
+
+func (c *zstdCompressor) init() error {
+	c.once.Do(func() {
+		if c.encoder, c.err = zstd.NewWriter(nil); c.err == nil {
+			c.decoder, c.err = zstd.NewReader(nil)
+		}
+	})
+	return c.err
+}
+
+func (c *zstdCompressor) Name() string {
+	return CompressionZstd
+}
+
+func (c *zstdCompressor) Compress(data []byte) ([]byte, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return c.encoder.EncodeAll(data, nil), nil
+}
+
+func (c *zstdCompressor) Decompress(data []byte) ([]byte, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return c.decoder.DecodeAll(data, nil)
+}
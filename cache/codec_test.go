@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"bytes"
+	"compress/flate"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+type codecTestValue struct {
+	Name  string
+	Count int
+}
+
+func TestEnvelopeCodec(t *testing.T) {
+	for _, name := range []string{CodecJSON, CodecMsgpack, CodecGob} {
+		for _, compression := range []string{CompressionNone, CompressionSnappy, CompressionZstd} {
+			c, err := NewEnvelopeCodec(&CodecOptions{Codec: name, Compression: compression})
+			assert.Nil(t, err)
+
+			in := codecTestValue{Name: strings.Repeat("mot", 100), Count: 3}
+			v, err := c.Marshal(in, time.Minute)
+			assert.Nil(t, err)
+			data, err := c.Encode(v)
+			assert.Nil(t, err)
+			assert.True(t, IsEnvelope(data))
+
+			e, err := DecodeEnvelope(data)
+			assert.Nil(t, err)
+			assert.Equal(t, name, e.Codec)
+			assert.Equal(t, time.Minute, e.ExpiredDuration)
+			assert.Equal(t, v.CreatedAt.UnixNano(), e.CreatedAt.UnixNano())
+			var out codecTestValue
+			assert.Nil(t, e.Item("k", time.Now()).Bind(&out))
+			assert.Equal(t, in, out)
+		}
+	}
+
+	_, err := NewEnvelopeCodec(&CodecOptions{Codec: "xml"})
+	assert.Equal(t, ErrUnknownCodec, err)
+	_, err = NewEnvelopeCodec(&CodecOptions{Compression: "lz4"})
+	assert.Equal(t, ErrUnknownCompression, err)
+	assert.False(t, IsEnvelope([]byte(`{"data":1}`)))
+
+	// tags are only written by the envelopes carrying some
+	c, _ := NewEnvelopeCodec(nil)
+	v, _ := c.Marshal("mot", 0)
+	v.Tags = []string{"user:42", "tenant:7"}
+	data, err := c.Encode(v)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(envelopeTagsVersion), data[1])
+	e, err := DecodeEnvelope(data)
+	assert.Nil(t, err)
+	assert.Equal(t, v.Tags, e.Tags)
+	assert.Equal(t, v.Data, e.Data)
+	_, err = DecodeEnvelope(data[:len(data)-len(v.Data)-3])
+	assert.Equal(t, ErrInvalidEnvelope, err)
+}
+
+func TestRawCodec(t *testing.T) {
+	c, _ := LookupCodec(CodecRaw)
+	data, err := c.Marshal(42)
+	assert.Nil(t, err)
+	assert.Equal(t, "42", string(data))
+	var n int
+	assert.Nil(t, c.Unmarshal(data, &n))
+	assert.Equal(t, 42, n)
+
+	data, _ = c.Marshal(true)
+	var b bool
+	assert.Nil(t, c.Unmarshal(data, &b))
+	assert.True(t, b)
+
+	data, _ = c.Marshal("hello")
+	assert.Equal(t, "hello", DataString(CodecRaw, data))
+}
+
+type flateCompressor struct{}
+
+func (flateCompressor) Name() string {
+	return "flate"
+}
+
+func (flateCompressor) Compress(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w, _ := flate.NewWriter(&b, flate.BestSpeed)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (flateCompressor) Decompress(data []byte) ([]byte, error) {
+	return ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+}
+
+func TestRegisterCompressor(t *testing.T) {
+	RegisterCompressor(flateCompressor{})
+	c, err := NewEnvelopeCodec(&CodecOptions{Compression: "flate", CompressThreshold: 16})
+	assert.Nil(t, err)
+
+	in := codecTestValue{Name: strings.Repeat("mot", 100)}
+	v, _ := c.Marshal(in, 0)
+	data, err := c.Encode(v)
+	assert.Nil(t, err)
+	assert.True(t, len(data) < len(in.Name))
+
+	e, err := DecodeEnvelope(data)
+	assert.Nil(t, err)
+	var out codecTestValue
+	assert.Nil(t, e.Item("k", time.Now()).Bind(&out))
+	assert.Equal(t, in, out)
+}
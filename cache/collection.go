@@ -0,0 +1,355 @@
+package cache
+
+import (
+	"github.com/pkg/errors"
+	"sort"
+)
+
+const (
+	TypeHash = "hash"
+	TypeList = "list"
+	TypeSet  = "set"
+	TypeZSet = "zset"
+)
+
+var ErrWrongType = errors.New(`mot: operation against a key holding the wrong kind of value`)
+
+// ICollections are the hash, list, set and sorted set operations of a cache.
+// Like counters, collections live at the top level of the chain: levels with a
+// parent delegate to it and never keep a copy. Members and field values are
+// stored as FormatArg formats them.
+type ICollections interface {
+	// HSet sets the fields of the hash at key, returning the number of fields added.
+	HSet(key string, values map[string]interface{}) (int, error)
+	HGet(key, field string) (string, bool, error)
+	HGetAll(key string) (map[string]string, error)
+	// HDel deletes fields from the hash at key, returning the number of fields removed.
+	HDel(key string, fields ...string) (int, error)
+
+	// LPush and RPush insert values at the head or the tail of the list at key,
+	// returning the length of the list.
+	LPush(key string, values ...interface{}) (int, error)
+	RPush(key string, values ...interface{}) (int, error)
+	LPop(key string) (string, bool, error)
+	RPop(key string) (string, bool, error)
+	// LRange returns the elements from start to stop included, negative indexes counting from the tail.
+	LRange(key string, start, stop int) ([]string, error)
+
+	// SAdd and SRem add and remove members of the set at key, returning how many were added or removed.
+	SAdd(key string, members ...interface{}) (int, error)
+	SRem(key string, members ...interface{}) (int, error)
+	SIsMember(key string, member interface{}) (bool, error)
+	SMembers(key string) ([]string, error)
+
+	// ZAdd adds members to the sorted set at key or updates their score, returning the number of members added.
+	ZAdd(key string, members ...Z) (int, error)
+	ZIncrBy(key string, increment float64, member string) (float64, error)
+	ZRem(key string, members ...string) (int, error)
+	ZScore(key, member string) (float64, bool, error)
+	// ZRange and ZRevRange return the members from rank start to stop included,
+	// by ascending or descending score.
+	ZRange(key string, start, stop int) ([]Z, error)
+	ZRevRange(key string, start, stop int) ([]Z, error)
+	// ZRangeByScore returns the members scored between min and max included,
+	// by ascending score. Use math.Inf for open bounds.
+	ZRangeByScore(key string, min, max float64) ([]Z, error)
+}
+
+// Z is a member of a sorted set.
+type Z struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// Field is a field of a hash.
+type Field struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Collection is the encoded form levels without native collections store
+// hashes, lists, sets and sorted sets in. Its methods follow the semantics
+// of the Redis commands of the same name.
+type Collection struct {
+	Type string `json:"type"`
+	// Fields are the fields of a hash, by name.
+	Fields []Field `json:"fields,omitempty"`
+	// Members are the elements of a list in order, or the members of a set sorted.
+	Members []string `json:"members,omitempty"`
+	// Scores are the members of a sorted set, by score then member.
+	Scores []Z `json:"scores,omitempty"`
+}
+
+// CodecCollection is the codec of the collections that the levels without
+// native collections store as values. It encodes them as JSON, and tells them
+// apart from the values, which MGet and key scans skip them for.
+const CodecCollection = "collection"
+
+type collectionCodec struct {
+	jsonCodec
+}
+
+func (collectionCodec) Name() string {
+	return CodecCollection
+}
+
+// EncodeCollection encodes c with CodecCollection.
+func EncodeCollection(c *Collection) ([]byte, error) {
+	return collectionCodec{}.Marshal(c)
+}
+
+func NewCollection(typ string) *Collection {
+	return &Collection{Type: typ}
+}
+
+// DecodeCollection decodes the collection data holds, failing with ErrWrongType
+// unless it is a collection of type typ.
+func DecodeCollection(codec string, data []byte, typ string) (*Collection, error) {
+	var c Collection
+	if err := Unmarshal(codec, data, &c); err != nil || c.Type != typ {
+		return nil, ErrWrongType
+	}
+	return &c, nil
+}
+
+// Len returns the number of fields, elements or members of the collection.
+func (c *Collection) Len() int {
+	return len(c.Fields) + len(c.Members) + len(c.Scores)
+}
+
+func (c *Collection) field(name string) (int, bool) {
+	i := sort.Search(len(c.Fields), func(i int) bool {
+		return c.Fields[i].Name >= name
+	})
+	return i, i < len(c.Fields) && c.Fields[i].Name == name
+}
+
+func (c *Collection) HSet(fields map[string]string) int {
+	var n int
+	for name, value := range fields {
+		i, has := c.field(name)
+		if has {
+			c.Fields[i].Value = value
+			continue
+		}
+		c.Fields = append(c.Fields, Field{})
+		copy(c.Fields[i+1:], c.Fields[i:])
+		c.Fields[i] = Field{Name: name, Value: value}
+		n++
+	}
+	return n
+}
+
+func (c *Collection) HGet(name string) (string, bool) {
+	if i, has := c.field(name); has {
+		return c.Fields[i].Value, true
+	}
+	return "", false
+}
+
+func (c *Collection) HGetAll() map[string]string {
+	v := make(map[string]string, len(c.Fields))
+	for _, f := range c.Fields {
+		v[f.Name] = f.Value
+	}
+	return v
+}
+
+func (c *Collection) HDel(names ...string) int {
+	var n int
+	for _, name := range names {
+		if i, has := c.field(name); has {
+			c.Fields = append(c.Fields[:i], c.Fields[i+1:]...)
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Collection) LPush(values ...string) int {
+	members := make([]string, 0, len(values)+len(c.Members))
+	for i := len(values) - 1; i >= 0; i-- {
+		members = append(members, values[i])
+	}
+	c.Members = append(members, c.Members...)
+	return len(c.Members)
+}
+
+func (c *Collection) RPush(values ...string) int {
+	c.Members = append(c.Members, values...)
+	return len(c.Members)
+}
+
+func (c *Collection) LPop() (string, bool) {
+	if len(c.Members) == 0 {
+		return "", false
+	}
+	v := c.Members[0]
+	c.Members = c.Members[1:]
+	return v, true
+}
+
+func (c *Collection) RPop() (string, bool) {
+	if len(c.Members) == 0 {
+		return "", false
+	}
+	v := c.Members[len(c.Members)-1]
+	c.Members = c.Members[:len(c.Members)-1]
+	return v, true
+}
+
+func (c *Collection) LRange(start, stop int) []string {
+	from, to := rangeIndex(start, stop, len(c.Members))
+	return append([]string(nil), c.Members[from:to]...)
+}
+
+// rangeIndex returns the slice bounds of the inclusive range from start to stop
+// of n elements, where negative indexes count from the end.
+func rangeIndex(start, stop, n int) (int, int) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return 0, 0
+	}
+	return start, stop + 1
+}
+
+func (c *Collection) member(member string) (int, bool) {
+	i := sort.SearchStrings(c.Members, member)
+	return i, i < len(c.Members) && c.Members[i] == member
+}
+
+func (c *Collection) SAdd(members ...string) int {
+	var n int
+	for _, member := range members {
+		i, has := c.member(member)
+		if has {
+			continue
+		}
+		c.Members = append(c.Members, "")
+		copy(c.Members[i+1:], c.Members[i:])
+		c.Members[i] = member
+		n++
+	}
+	return n
+}
+
+func (c *Collection) SRem(members ...string) int {
+	var n int
+	for _, member := range members {
+		if i, has := c.member(member); has {
+			c.Members = append(c.Members[:i], c.Members[i+1:]...)
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Collection) SIsMember(member string) bool {
+	_, has := c.member(member)
+	return has
+}
+
+func (c *Collection) SMembers() []string {
+	return append([]string(nil), c.Members...)
+}
+
+func zless(a, b Z) bool {
+	return a.Score < b.Score || (a.Score == b.Score && a.Member < b.Member)
+}
+
+func (c *Collection) zindex(member string) int {
+	for i, z := range c.Scores {
+		if z.Member == member {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *Collection) zinsert(z Z) {
+	i := sort.Search(len(c.Scores), func(i int) bool {
+		return !zless(c.Scores[i], z)
+	})
+	c.Scores = append(c.Scores, Z{})
+	copy(c.Scores[i+1:], c.Scores[i:])
+	c.Scores[i] = z
+}
+
+func (c *Collection) ZAdd(members ...Z) int {
+	var n int
+	for _, z := range members {
+		if i := c.zindex(z.Member); i >= 0 {
+			c.Scores = append(c.Scores[:i], c.Scores[i+1:]...)
+		} else {
+			n++
+		}
+		c.zinsert(z)
+	}
+	return n
+}
+
+func (c *Collection) ZIncrBy(increment float64, member string) float64 {
+	z := Z{Member: member, Score: increment}
+	if i := c.zindex(member); i >= 0 {
+		z.Score += c.Scores[i].Score
+		c.Scores = append(c.Scores[:i], c.Scores[i+1:]...)
+	}
+	c.zinsert(z)
+	return z.Score
+}
+
+func (c *Collection) ZRem(members ...string) int {
+	var n int
+	for _, member := range members {
+		if i := c.zindex(member); i >= 0 {
+			c.Scores = append(c.Scores[:i], c.Scores[i+1:]...)
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Collection) ZScore(member string) (float64, bool) {
+	if i := c.zindex(member); i >= 0 {
+		return c.Scores[i].Score, true
+	}
+	return 0, false
+}
+
+func (c *Collection) ZRange(start, stop int) []Z {
+	from, to := rangeIndex(start, stop, len(c.Scores))
+	return append([]Z(nil), c.Scores[from:to]...)
+}
+
+func (c *Collection) ZRevRange(start, stop int) []Z {
+	from, to := rangeIndex(start, stop, len(c.Scores))
+	v := make([]Z, 0, to-from)
+	for i := from; i < to; i++ {
+		v = append(v, c.Scores[len(c.Scores)-1-i])
+	}
+	return v
+}
+
+func (c *Collection) ZRangeByScore(min, max float64) []Z {
+	var v []Z
+	for _, z := range c.Scores {
+		if z.Score > max {
+			break
+		}
+		if z.Score >= min {
+			v = append(v, z)
+		}
+	}
+	return v
+}
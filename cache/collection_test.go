@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCollection_List(t *testing.T) {
+	c := NewCollection(TypeList)
+	assert.Equal(t, 2, c.RPush("b", "c"))
+	assert.Equal(t, 4, c.LPush("x", "a"))
+	assert.Equal(t, []string{"a", "x", "b", "c"}, c.LRange(0, -1))
+	assert.Equal(t, []string{"b", "c"}, c.LRange(-2, 10))
+	assert.Equal(t, 0, len(c.LRange(3, 1)))
+
+	v, has := c.LPop()
+	assert.True(t, has)
+	assert.Equal(t, "a", v)
+	v, _ = c.RPop()
+	assert.Equal(t, "c", v)
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestCollection_ZSet(t *testing.T) {
+	c := NewCollection(TypeZSet)
+	assert.Equal(t, 3, c.ZAdd(Z{Member: "a", Score: 3}, Z{Member: "b", Score: 1}, Z{Member: "c", Score: 2}))
+	assert.Equal(t, 0, c.ZAdd(Z{Member: "b", Score: 4}))
+	assert.Equal(t, 4.5, c.ZIncrBy(2.5, "c"))
+
+	assert.Equal(t, []Z{{Member: "a", Score: 3}, {Member: "b", Score: 4}}, c.ZRange(0, 1))
+	assert.Equal(t, []Z{{Member: "c", Score: 4.5}, {Member: "b", Score: 4}}, c.ZRevRange(0, 1))
+	assert.Equal(t, []Z{{Member: "b", Score: 4}, {Member: "c", Score: 4.5}}, c.ZRangeByScore(4, 10))
+
+	assert.Equal(t, 1, c.ZRem("a", "missing"))
+	_, has := c.ZScore("a")
+	assert.False(t, has)
+}
+
+func TestDecodeCollection(t *testing.T) {
+	c := NewCollection(TypeSet)
+	assert.Equal(t, 2, c.SAdd("b", "a", "b"))
+	data, err := jsonCodec{}.Marshal(c)
+	assert.Nil(t, err)
+
+	decoded, err := DecodeCollection(CodecJSON, data, TypeSet)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, decoded.SMembers())
+	_, err = DecodeCollection(CodecJSON, data, TypeHash)
+	assert.Equal(t, ErrWrongType, err)
+	_, err = DecodeCollection(CodecJSON, []byte(`"text"`), TypeSet)
+	assert.Equal(t, ErrWrongType, err)
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/motclub/common/json"
+	"io"
+	"time"
+)
+
+// dumpPageSize is the number of keys read per Scan call while dumping.
+const dumpPageSize = 1000
+
+// IItemSetter is implemented by levels that can store items as they are,
+// keeping their codec. Like MSet, SetItems writes through to the parent levels.
+type IItemSetter interface {
+	SetItems(items ...*Item) error
+}
+
+// SetItems writes items to c, as they are when c is an IItemSetter, decoded
+// and re-encoded by c otherwise.
+func SetItems(c ICache, items ...*Item) error {
+	if s, ok := c.(IItemSetter); ok {
+		return s.SetItems(items...)
+	}
+	for _, item := range items {
+		var value interface{}
+		if item.Codec == "" || item.Codec == CodecJSON {
+			value = json.RawMessage(item.Value)
+		} else if err := item.Bind(&value); err != nil {
+			return err
+		}
+		if err := c.Set(item.Key, value, item.TTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dumpLine is a line of a dump. JSON values are written as is, the values of
+// other codecs are base64 encoded.
+type dumpLine struct {
+	Key string `json:"key"`
+	// TTL is the remaining time to live in milliseconds, 0 means no expiration.
+	TTL   int64           `json:"ttl"`
+	Codec string          `json:"codec,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Data  []byte          `json:"data,omitempty"`
+}
+
+// Dump writes the items of c whose keys start with prefix to w, one JSON
+// object per line, and returns the number of items written.
+func Dump(w io.Writer, c ICache, prefix string) (int, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.STD().NewEncoder(bw)
+	var n int
+	cursor := ""
+	for {
+		items, next, err := c.Scan(prefix, cursor, dumpPageSize)
+		if err != nil {
+			return n, err
+		}
+		for _, item := range items {
+			line := dumpLine{Key: item.Key, TTL: item.TTL.Milliseconds()}
+			if item.TTL > 0 && line.TTL == 0 {
+				// keep expiring below a millisecond
+				line.TTL = 1
+			}
+			if item.Codec == "" || item.Codec == CodecJSON {
+				line.Value = item.Value
+			} else {
+				line.Codec, line.Data = item.Codec, item.Value
+			}
+			if err := enc.Encode(&line); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	return n, bw.Flush()
+}
+
+// Restore writes the items dumped to r into c and returns the number of items
+// restored. To fill a single level, such as an empty L1, pass its Local view.
+func Restore(r io.Reader, c ICache) (int, error) {
+	br := bufio.NewReader(r)
+	var n int
+	var items []*Item
+	for {
+		data, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			if err == io.EOF {
+				break
+			}
+			continue
+		}
+		var line dumpLine
+		if err := json.STD().Unmarshal(data, &line); err != nil {
+			return n, err
+		}
+		item := &Item{Key: line.Key, TTL: time.Duration(line.TTL) * time.Millisecond, Codec: line.Codec, Value: line.Value}
+		if line.Codec != "" {
+			item.Value = line.Data
+		}
+		if items = append(items, item); len(items) == dumpPageSize {
+			if err := SetItems(c, items...); err != nil {
+				return n, err
+			}
+			n += len(items)
+			items = items[:0]
+		}
+	}
+	if err := SetItems(c, items...); err != nil {
+		return n, err
+	}
+	return n + len(items), nil
+}
@@ -0,0 +1,69 @@
+package cache_test
+
+import (
+	"bytes"
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/cache/leveldb"
+	"github.com/motclub/common/cache/memory"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDumpRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mot-dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src, err := leveldb.NewLevelDBCache(dir, nil, &leveldb.Options{CodecOptions: cache.CodecOptions{Codec: cache.CodecMsgpack}})
+	assert.Nil(t, err)
+	defer src.Close()
+
+	type user struct {
+		Name string
+	}
+	assert.Nil(t, src.Set("user:1", user{Name: "mot"}, time.Hour))
+	assert.Nil(t, src.Set("user:2", "two"))
+	assert.Nil(t, src.Set("order:1", 1))
+
+	var buf bytes.Buffer
+	n, err := cache.Dump(&buf, src, "user:")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 2, strings.Count(buf.String(), "\n"))
+
+	dst, _ := memory.NewMemoryCache()
+	n, err = cache.Restore(&buf, dst)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	var u user
+	assert.True(t, dst.HasGet("user:1", &u))
+	assert.Equal(t, "mot", u.Name)
+	assert.Equal(t, "two", dst.GetString("user:2"))
+	assert.False(t, dst.Has("order:1"))
+	ttl, _ := dst.TTL("user:1")
+	assert.True(t, ttl > 59*time.Minute && ttl <= time.Hour)
+	ttl, _ = dst.TTL("user:2")
+	assert.Equal(t, time.Duration(0), ttl)
+}
+
+func TestRestoreJSON(t *testing.T) {
+	dump := `{"key":"a","ttl":0,"value":{"n":1}}
+{"key":"b","ttl":60000,"value":"bee"}
+`
+	c, _ := memory.NewMemoryCache()
+	n, err := cache.Restore(strings.NewReader(dump), c)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	var v struct {
+		N int `json:"n"`
+	}
+	assert.True(t, c.HasGet("a", &v))
+	assert.Equal(t, 1, v.N)
+	assert.Equal(t, "bee", c.GetString("b"))
+}
@@ -0,0 +1,905 @@
+package encrypted
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/json"
+	"github.com/pkg/errors"
+	"time"
+)
+
+var (
+	ErrNoKeys        = errors.New(`mot: encrypted cache needs at least one key`)
+	ErrDuplicateKey  = errors.New(`mot: duplicate encryption key id`)
+	ErrUnknownKeyID  = errors.New(`mot: unknown encryption key id`)
+	ErrKeysHashed    = errors.New(`mot: keys are hashed, key scans and key events are unsupported`)
+	ErrInvalidSealed = errors.New(`mot: invalid encrypted value`)
+	ErrSwapConflict  = errors.New(`mot: encrypted value kept changing`)
+	ErrUnsupported   = errors.New(`mot: operation unsupported by the encrypted cache`)
+)
+
+// maxSwapRetries bounds the attempts of GetSet on a key that keeps changing meanwhile.
+const maxSwapRetries = 16
+
+// Key is an AES key of 16, 24 or 32 bytes, identified by ID in the values it encrypts.
+type Key struct {
+	ID     string `json:"id"`
+	Secret []byte `json:"secret"`
+}
+
+type Options struct {
+	// Keys is the key ring. Values are encrypted with the first key and
+	// decrypted with the key they name, so that rotating only takes
+	// prepending a new key; values are re-encrypted with it when read.
+	Keys []Key `json:"keys"`
+	// KeyHashSecret, when set, stores the keys as their HMAC-SHA256 under it,
+	// which hides them but leaves HasPrefix, HasSuffix, Contains and Scan unsupported.
+	KeyHashSecret []byte `json:"key_hash_secret"`
+	// AllowPlaintext reads the values that are not encrypted as they are, to
+	// migrate the values stored before the cache was encrypted; they are
+	// rejected as ErrInvalidSealed otherwise.
+	AllowPlaintext bool `json:"allow_plaintext"`
+}
+
+// NewEncryptedCache returns a view of c that encrypts values with AES-GCM.
+// Counters and collections are unsupported and pub/sub messages are not encrypted.
+func NewEncryptedCache(c cache.ICache, options ...*Options) (cache.ICache, error) {
+	var o Options
+	if len(options) > 0 && options[0] != nil {
+		o = *options[0]
+	}
+	if len(o.Keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	r := &keyRing{
+		aeads:          make(map[string]cipher.AEAD, len(o.Keys)),
+		primary:        o.Keys[0].ID,
+		allowPlaintext: o.AllowPlaintext,
+	}
+	for _, k := range o.Keys {
+		if _, has := r.aeads[k.ID]; has {
+			return nil, ErrDuplicateKey
+		}
+		block, err := aes.NewCipher(k.Secret)
+		if err != nil {
+			return nil, err
+		}
+		if r.aeads[k.ID], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	if len(o.KeyHashSecret) > 0 {
+		r.hashSecret = append([]byte(nil), o.KeyHashSecret...)
+	}
+	return newEncryptedCache(c, r), nil
+}
+
+type keyRing struct {
+	aeads          map[string]cipher.AEAD
+	primary        string
+	hashSecret     []byte
+	allowPlaintext bool
+}
+
+// sealed is how an encrypted value is stored in the wrapped cache.
+type sealed struct {
+	// K is the ID of the key the value is encrypted with.
+	K string `json:"k"`
+	// D is the nonce followed by the ciphertext of the JSON data.
+	D []byte `json:"d"`
+}
+
+type encryptedCache struct {
+	c    cache.ICache
+	keys *keyRing
+}
+
+func newEncryptedCache(c cache.ICache, keys *keyRing) *encryptedCache {
+	return &encryptedCache{c: c, keys: keys}
+}
+
+// key returns the key stored in the wrapped cache for key.
+func (e *encryptedCache) key(key string) string {
+	if e.keys.hashSecret == nil {
+		return key
+	}
+	h := hmac.New(sha256.New, e.keys.hashSecret)
+	h.Write([]byte(key))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (e *encryptedCache) mapKeys(keys []string) []string {
+	v := make([]string, len(keys))
+	for i, key := range keys {
+		v[i] = e.key(key)
+	}
+	return v
+}
+
+// seal encrypts the JSON encoding of value. The stored key is authenticated
+// along with it, so that a value copied under another key fails to decrypt.
+func (e *encryptedCache) seal(storedKey string, value interface{}) (*sealed, error) {
+	data, err := json.STD().Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	aead := e.keys.aeads[e.keys.primary]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &sealed{K: e.keys.primary, D: aead.Seal(nonce, nonce, data, []byte(storedKey))}, nil
+}
+
+func (e *encryptedCache) open(storedKey string, s *sealed) ([]byte, error) {
+	aead, has := e.keys.aeads[s.K]
+	if !has {
+		return nil, ErrUnknownKeyID
+	}
+	if len(s.D) < aead.NonceSize() {
+		return nil, ErrInvalidSealed
+	}
+	nonce, ciphertext := s.D[:aead.NonceSize()], s.D[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, []byte(storedKey))
+}
+
+// plaintext rejects a stored value that is not encrypted, unless AllowPlaintext is set.
+func (e *encryptedCache) plaintext() error {
+	if e.keys.allowPlaintext {
+		return nil
+	}
+	return ErrInvalidSealed
+}
+
+// read returns the JSON data of key, or nil with has set when the stored value
+// is not encrypted and AllowPlaintext is set.
+func (e *encryptedCache) read(storedKey string) (data []byte, has bool, err error) {
+	var s sealed
+	if has = e.c.HasGet(storedKey, &s); !has {
+		return nil, false, nil
+	}
+	if s.K == "" {
+		return nil, true, e.plaintext()
+	}
+	if data, err = e.open(storedKey, &s); err != nil {
+		return nil, true, err
+	}
+	if s.K != e.keys.primary {
+		e.rotate(storedKey, data)
+	}
+	return data, true, nil
+}
+
+// rotate re-encrypts the value of key with the primary key, keeping its TTL.
+// A write racing with it may be overwritten by the older value.
+func (e *encryptedCache) rotate(storedKey string, data []byte) {
+	ttl, has := e.c.TTL(storedKey)
+	if !has {
+		return
+	}
+	if s, err := e.seal(storedKey, json.RawMessage(data)); err == nil {
+		_ = e.c.Set(storedKey, s, ttl)
+	}
+}
+
+func (e *encryptedCache) Has(key string) bool {
+	return e.c.Has(e.key(key))
+}
+
+func (e *encryptedCache) HasGet(key string, dst interface{}) bool {
+	storedKey := e.key(key)
+	data, has, err := e.read(storedKey)
+	if !has || err != nil {
+		return false
+	}
+	if data == nil {
+		return e.c.HasGet(storedKey, dst)
+	}
+	_ = json.STD().Unmarshal(data, dst)
+	return true
+}
+
+func (e *encryptedCache) HasGetInt(key string) (int, bool) {
+	var v int
+	has := e.HasGet(key, &v)
+	return v, has
+}
+
+func (e *encryptedCache) HasGetFloat(key string) (float64, bool) {
+	var v float64
+	has := e.HasGet(key, &v)
+	return v, has
+}
+
+func (e *encryptedCache) HasGetString(key string) (string, bool) {
+	var v string
+	has := e.HasGet(key, &v)
+	return v, has
+}
+
+func (e *encryptedCache) HasGetBool(key string) (bool, bool) {
+	var v bool
+	has := e.HasGet(key, &v)
+	return v, has
+}
+
+func (e *encryptedCache) HasGetTime(key string) (time.Time, bool) {
+	var v time.Time
+	has := e.HasGet(key, &v)
+	return v, has
+}
+
+func (e *encryptedCache) HasGetInt8(key string) (int8, bool) {
+	v, has := e.HasGetInt(key)
+	return int8(v), has
+}
+
+func (e *encryptedCache) HasGetInt16(key string) (int16, bool) {
+	v, has := e.HasGetInt(key)
+	return int16(v), has
+}
+
+func (e *encryptedCache) HasGetInt32(key string) (int32, bool) {
+	v, has := e.HasGetInt(key)
+	return int32(v), has
+}
+
+func (e *encryptedCache) HasGetInt64(key string) (int64, bool) {
+	v, has := e.HasGetInt(key)
+	return int64(v), has
+}
+
+func (e *encryptedCache) HasGetUint(key string) (uint, bool) {
+	v, has := e.HasGetInt(key)
+	return uint(v), has
+}
+
+func (e *encryptedCache) HasGetUint8(key string) (uint8, bool) {
+	v, has := e.HasGetInt(key)
+	return uint8(v), has
+}
+
+func (e *encryptedCache) HasGetUint16(key string) (uint16, bool) {
+	v, has := e.HasGetInt(key)
+	return uint16(v), has
+}
+
+func (e *encryptedCache) HasGetUint32(key string) (uint32, bool) {
+	v, has := e.HasGetInt(key)
+	return uint32(v), has
+}
+
+func (e *encryptedCache) HasGetUint64(key string) (uint64, bool) {
+	v, has := e.HasGetInt(key)
+	return uint64(v), has
+}
+
+func (e *encryptedCache) HasGetFloat32(key string) (float32, bool) {
+	v, has := e.HasGetFloat(key)
+	return float32(v), has
+}
+
+func (e *encryptedCache) HasGetFloat64(key string) (float64, bool) {
+	return e.HasGetFloat(key)
+}
+
+func (e *encryptedCache) Get(key string, dst interface{}) {
+	_ = e.HasGet(key, dst)
+}
+
+func (e *encryptedCache) GetInt(key string) int {
+	v, _ := e.HasGetInt(key)
+	return v
+}
+
+func (e *encryptedCache) GetInt8(key string) int8 {
+	v, _ := e.HasGetInt8(key)
+	return v
+}
+
+func (e *encryptedCache) GetInt16(key string) int16 {
+	v, _ := e.HasGetInt16(key)
+	return v
+}
+
+func (e *encryptedCache) GetInt32(key string) int32 {
+	v, _ := e.HasGetInt32(key)
+	return v
+}
+
+func (e *encryptedCache) GetInt64(key string) int64 {
+	v, _ := e.HasGetInt64(key)
+	return v
+}
+
+func (e *encryptedCache) GetUint(key string) uint {
+	v, _ := e.HasGetUint(key)
+	return v
+}
+
+func (e *encryptedCache) GetUint8(key string) uint8 {
+	v, _ := e.HasGetUint8(key)
+	return v
+}
+
+func (e *encryptedCache) GetUint16(key string) uint16 {
+	v, _ := e.HasGetUint16(key)
+	return v
+}
+
+func (e *encryptedCache) GetUint32(key string) uint32 {
+	v, _ := e.HasGetUint32(key)
+	return v
+}
+
+func (e *encryptedCache) GetUint64(key string) uint64 {
+	v, _ := e.HasGetUint64(key)
+	return v
+}
+
+func (e *encryptedCache) GetFloat(key string) float64 {
+	v, _ := e.HasGetFloat(key)
+	return v
+}
+
+func (e *encryptedCache) GetFloat32(key string) float32 {
+	v, _ := e.HasGetFloat32(key)
+	return v
+}
+
+func (e *encryptedCache) GetFloat64(key string) float64 {
+	v, _ := e.HasGetFloat64(key)
+	return v
+}
+
+func (e *encryptedCache) GetString(key string) string {
+	v, _ := e.HasGetString(key)
+	return v
+}
+
+func (e *encryptedCache) GetBool(key string) bool {
+	v, _ := e.HasGetBool(key)
+	return v
+}
+
+func (e *encryptedCache) GetTime(key string) time.Time {
+	v, _ := e.HasGetTime(key)
+	return v
+}
+
+func (e *encryptedCache) DefaultGet(key string, dst interface{}, defaultValue interface{}) {
+	if !e.HasGet(key, dst) {
+		_ = json.Copy(defaultValue, dst)
+	}
+}
+
+func (e *encryptedCache) DefaultGetInt(key string, defaultValue int) int {
+	if v, has := e.HasGetInt(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (e *encryptedCache) DefaultGetInt8(key string, defaultValue int8) int8 {
+	if v, has := e.HasGetInt8(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (e *encryptedCache) DefaultGetInt16(key string, defaultValue int16) int16 {
+	if v, has := e.HasGetInt16(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (e *encryptedCache) DefaultGetInt32(key string, defaultValue int32) int32 {
+	if v, has := e.HasGetInt32(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (e *encryptedCache) DefaultGetInt64(key string, defaultValue int64) int64 {
+	if v, has := e.HasGetInt64(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (e *encryptedCache) DefaultGetUint(key string, defaultValue uint) uint {
+	if v, has := e.HasGetUint(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (e *encryptedCache) DefaultGetUint8(key string, defaultValue uint8) uint8 {
+	if v, has := e.HasGetUint8(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (e *encryptedCache) DefaultGetUint16(key string, defaultValue uint16) uint16 {
+	if v, has := e.HasGetUint16(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (e *encryptedCache) DefaultGetUint32(key string, defaultValue uint32) uint32 {
+	if v, has := e.HasGetUint32(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (e *encryptedCache) DefaultGetUint64(key string, defaultValue uint64) uint64 {
+	if v, has := e.HasGetUint64(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (e *encryptedCache) DefaultGetFloat(key string, defaultValue float64) float64 {
+	if v, has := e.HasGetFloat(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (e *encryptedCache) DefaultGetFloat32(key string, defaultValue float32) float32 {
+	if v, has := e.HasGetFloat32(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (e *encryptedCache) DefaultGetFloat64(key string, defaultValue float64) float64 {
+	if v, has := e.HasGetFloat64(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (e *encryptedCache) DefaultGetString(key string, defaultValue string) string {
+	if v, has := e.HasGetString(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (e *encryptedCache) DefaultGetBool(key string, defaultValue bool) bool {
+	if v, has := e.HasGetBool(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (e *encryptedCache) DefaultGetTime(key string, defaultValue time.Time) time.Time {
+	if v, has := e.HasGetTime(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (e *encryptedCache) TTL(key string) (time.Duration, bool) {
+	return e.c.TTL(e.key(key))
+}
+
+func (e *encryptedCache) Set(key string, value interface{}, expiration ...time.Duration) error {
+	storedKey := e.key(key)
+	s, err := e.seal(storedKey, value)
+	if err != nil {
+		return err
+	}
+	return e.c.Set(storedKey, s, expiration...)
+}
+
+func (e *encryptedCache) MGet(keys ...string) (map[string]*cache.Item, error) {
+	storedKeys := e.mapKeys(keys)
+	found, err := e.c.MGet(storedKeys...)
+	if err != nil {
+		return nil, err
+	}
+	items := make(map[string]*cache.Item, len(found))
+	for i, storedKey := range storedKeys {
+		item, has := found[storedKey]
+		if !has {
+			continue
+		}
+		if item, err = e.openItem(keys[i], item, true); err != nil {
+			return nil, err
+		}
+		items[keys[i]] = item
+	}
+	return items, nil
+}
+
+// openItem decrypts an item of the wrapped cache into the item of key, and
+// re-encrypts it with the primary key when rotate is set. Items that are not
+// encrypted are returned as they are when AllowPlaintext is set.
+func (e *encryptedCache) openItem(key string, item *cache.Item, rotate bool) (*cache.Item, error) {
+	var s sealed
+	if err := item.Bind(&s); err != nil || s.K == "" {
+		if err := e.plaintext(); err != nil {
+			return nil, err
+		}
+		return &cache.Item{Key: key, Value: item.Value, Codec: item.Codec, TTL: item.TTL}, nil
+	}
+	data, err := e.open(item.Key, &s)
+	if err != nil {
+		return nil, err
+	}
+	if rotate && s.K != e.keys.primary {
+		e.rotate(item.Key, data)
+	}
+	return &cache.Item{Key: key, Value: data, Codec: cache.CodecJSON, TTL: item.TTL}, nil
+}
+
+func (e *encryptedCache) MSet(values map[string]interface{}, expiration ...time.Duration) error {
+	sealedValues := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		storedKey := e.key(key)
+		s, err := e.seal(storedKey, value)
+		if err != nil {
+			return err
+		}
+		sealedValues[storedKey] = s
+	}
+	return e.c.MSet(sealedValues, expiration...)
+}
+
+func (e *encryptedCache) SetNX(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	storedKey := e.key(key)
+	s, err := e.seal(storedKey, value)
+	if err != nil {
+		return false, err
+	}
+	return e.c.SetNX(storedKey, s, expiration...)
+}
+
+func (e *encryptedCache) SetXX(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	storedKey := e.key(key)
+	s, err := e.seal(storedKey, value)
+	if err != nil {
+		return false, err
+	}
+	return e.c.SetXX(storedKey, s, expiration...)
+}
+
+// GetSet reads the previous value of key, then swaps it with CompareAndSwap,
+// retrying while it changes meanwhile, so that a previous value that is not
+// encrypted is returned as it is when AllowPlaintext is set.
+func (e *encryptedCache) GetSet(key string, value interface{}, dst interface{}) (bool, error) {
+	storedKey := e.key(key)
+	s, err := e.seal(storedKey, value)
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i < maxSwapRetries; i++ {
+		found, err := e.c.MGet(storedKey)
+		if err != nil {
+			return false, err
+		}
+		item, has := found[storedKey]
+		var (
+			old *cache.Item
+			ok  bool
+		)
+		if has {
+			if old, err = e.openItem(key, item, false); err != nil {
+				return false, err
+			}
+			ok, err = e.c.CompareAndSwap(storedKey, item, s)
+		} else {
+			ok, err = e.c.SetNX(storedKey, s)
+		}
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			continue
+		}
+		if !has {
+			return false, nil
+		}
+		return true, old.Bind(dst)
+	}
+	return false, ErrSwapConflict
+}
+
+// CompareAndSwap compares old with the decrypted value of key, then swaps it
+// provided the ciphertext it was compared with is still stored.
+func (e *encryptedCache) CompareAndSwap(key string, old, value interface{}, expiration ...time.Duration) (bool, error) {
+	storedKey := e.key(key)
+	found, err := e.c.MGet(storedKey)
+	if err != nil {
+		return false, err
+	}
+	item, has := found[storedKey]
+	if !has {
+		return false, nil
+	}
+	// rotating would change the ciphertext swapped below
+	current, err := e.openItem(key, item, false)
+	if err != nil {
+		return false, err
+	}
+	if ok, err := (&cache.Envelope{Codec: current.Codec, Data: current.Value}).Equal(old); err != nil || !ok {
+		return false, err
+	}
+	s, err := e.seal(storedKey, value)
+	if err != nil {
+		return false, err
+	}
+	return e.c.CompareAndSwap(storedKey, item, s, expiration...)
+}
+
+func (e *encryptedCache) Expire(key string, ttl time.Duration) (bool, error) {
+	return e.c.Expire(e.key(key), ttl)
+}
+
+func (e *encryptedCache) ExpireAt(key string, at time.Time) (bool, error) {
+	return e.c.ExpireAt(e.key(key), at)
+}
+
+func (e *encryptedCache) Persist(key string) (bool, error) {
+	return e.c.Persist(e.key(key))
+}
+
+func (e *encryptedCache) Touch(key string) (bool, error) {
+	return e.c.Touch(e.key(key))
+}
+
+func (e *encryptedCache) SetWithTags(key string, value interface{}, tags []string, expiration ...time.Duration) error {
+	storedKey := e.key(key)
+	s, err := e.seal(storedKey, value)
+	if err != nil {
+		return err
+	}
+	return e.c.SetWithTags(storedKey, s, e.mapKeys(tags), expiration...)
+}
+
+func (e *encryptedCache) InvalidateTags(tags ...string) error {
+	return e.c.InvalidateTags(e.mapKeys(tags)...)
+}
+
+// Scripter runs scripts on the scripter of the wrapped cache, the values they
+// read and write are not encrypted.
+func (e *encryptedCache) Scripter() (cache.IScripter, bool) {
+	return cache.Scripter(e.c)
+}
+
+func (e *encryptedCache) GetOrLoad(key string, dst interface{}, ttl time.Duration, loader cache.LoaderFunc) error {
+	return cache.GetOrLoad(e, key, dst, ttl, loader)
+}
+
+func (e *encryptedCache) HasPrefix(s string, limit ...int) (map[string]string, error) {
+	if e.keys.hashSecret != nil {
+		return nil, ErrKeysHashed
+	}
+	return e.values(e.c.HasPrefix(s, limit...))
+}
+
+func (e *encryptedCache) HasSuffix(s string, limit ...int) (map[string]string, error) {
+	if e.keys.hashSecret != nil {
+		return nil, ErrKeysHashed
+	}
+	return e.values(e.c.HasSuffix(s, limit...))
+}
+
+func (e *encryptedCache) Contains(s string, limit ...int) (map[string]string, error) {
+	if e.keys.hashSecret != nil {
+		return nil, ErrKeysHashed
+	}
+	return e.values(e.c.Contains(s, limit...))
+}
+
+// values replaces the encrypted values found by a key scan with their plaintext.
+func (e *encryptedCache) values(found map[string]string, err error) (map[string]string, error) {
+	if err != nil || len(found) == 0 {
+		return found, err
+	}
+	keys := make([]string, 0, len(found))
+	for key := range found {
+		keys = append(keys, key)
+	}
+	items, err := e.MGet(keys...)
+	if err != nil {
+		return nil, err
+	}
+	v := make(map[string]string, len(items))
+	for key, item := range items {
+		v[key] = cache.DataString(item.Codec, item.Value)
+	}
+	return v, nil
+}
+
+func (e *encryptedCache) Scan(prefix, cursor string, limit int) ([]*cache.Item, string, error) {
+	if e.keys.hashSecret != nil {
+		return nil, "", ErrKeysHashed
+	}
+	found, next, err := e.c.Scan(prefix, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	items := make([]*cache.Item, len(found))
+	for i, item := range found {
+		if items[i], err = e.openItem(item.Key, item, true); err != nil {
+			return nil, "", err
+		}
+	}
+	return items, next, nil
+}
+
+func (e *encryptedCache) Lock(key string, ttl time.Duration) (cache.ILock, error) {
+	return e.c.Lock(e.key(key), ttl)
+}
+
+func (e *encryptedCache) Incr(key string) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (e *encryptedCache) IncrBy(key string, step int) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (e *encryptedCache) IncrByFloat(key string, step float64) (float64, error) {
+	return 0, ErrUnsupported
+}
+
+func (e *encryptedCache) HSet(key string, values map[string]interface{}) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (e *encryptedCache) HGet(key, field string) (string, bool, error) {
+	return "", false, ErrUnsupported
+}
+
+func (e *encryptedCache) HGetAll(key string) (map[string]string, error) {
+	return nil, ErrUnsupported
+}
+
+func (e *encryptedCache) HDel(key string, fields ...string) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (e *encryptedCache) LPush(key string, values ...interface{}) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (e *encryptedCache) RPush(key string, values ...interface{}) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (e *encryptedCache) LPop(key string) (string, bool, error) {
+	return "", false, ErrUnsupported
+}
+
+func (e *encryptedCache) RPop(key string) (string, bool, error) {
+	return "", false, ErrUnsupported
+}
+
+func (e *encryptedCache) LRange(key string, start, stop int) ([]string, error) {
+	return nil, ErrUnsupported
+}
+
+func (e *encryptedCache) SAdd(key string, members ...interface{}) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (e *encryptedCache) SRem(key string, members ...interface{}) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (e *encryptedCache) SIsMember(key string, member interface{}) (bool, error) {
+	return false, ErrUnsupported
+}
+
+func (e *encryptedCache) SMembers(key string) ([]string, error) {
+	return nil, ErrUnsupported
+}
+
+func (e *encryptedCache) ZAdd(key string, members ...cache.Z) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (e *encryptedCache) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	return 0, ErrUnsupported
+}
+
+func (e *encryptedCache) ZRem(key string, members ...string) (int, error) {
+	return 0, ErrUnsupported
+}
+
+func (e *encryptedCache) ZScore(key, member string) (float64, bool, error) {
+	return 0, false, ErrUnsupported
+}
+
+func (e *encryptedCache) ZRange(key string, start, stop int) ([]cache.Z, error) {
+	return nil, ErrUnsupported
+}
+
+func (e *encryptedCache) ZRevRange(key string, start, stop int) ([]cache.Z, error) {
+	return nil, ErrUnsupported
+}
+
+func (e *encryptedCache) ZRangeByScore(key string, min, max float64) ([]cache.Z, error) {
+	return nil, ErrUnsupported
+}
+
+func (e *encryptedCache) Del(keys ...string) error {
+	return e.c.Del(e.mapKeys(keys)...)
+}
+
+func (e *encryptedCache) Local() cache.ICache {
+	return newEncryptedCache(e.c.Local(), e.keys)
+}
+
+// Identity identifies the cache by its keys and the cache it wraps.
+func (e *encryptedCache) Identity() interface{} {
+	return [2]interface{}{e.keys, cache.Identity(e.c)}
+}
+
+func (e *encryptedCache) Parent() cache.ICache {
+	return e.c.Parent()
+}
+
+func (e *encryptedCache) Children() cache.ICache {
+	return e.c.Children()
+}
+
+func (e *encryptedCache) SetParent(parent cache.ICache) {
+	e.c.SetParent(parent)
+}
+
+func (e *encryptedCache) SetChildren(children cache.ICache) {
+	e.c.SetChildren(children)
+}
+
+func (e *encryptedCache) Close() error {
+	return e.c.Close()
+}
+
+func (e *encryptedCache) Stats() cache.Stats {
+	return e.c.Stats()
+}
+
+func (e *encryptedCache) WithContext(ctx context.Context) cache.ICache {
+	return newEncryptedCache(e.c.WithContext(ctx), e.keys)
+}
+
+func (e *encryptedCache) OnExpire(pattern string, handler func(key string)) error {
+	if e.keys.hashSecret != nil {
+		return ErrKeysHashed
+	}
+	return e.c.OnExpire(pattern, handler)
+}
+
+func (e *encryptedCache) OnChange(pattern string, handler func(key, event string)) error {
+	if e.keys.hashSecret != nil {
+		return ErrKeysHashed
+	}
+	return e.c.OnChange(pattern, handler)
+}
+
+func (e *encryptedCache) Publish(channel string, message interface{}) error {
+	return e.c.Publish(channel, message)
+}
+
+func (e *encryptedCache) Subscribe(channels []string, handler func(string, string), options ...*cache.SubscribeOptions) (cache.ISubscription, error) {
+	return e.c.Subscribe(channels, handler, options...)
+}
+
+func (e *encryptedCache) PSubscribe(patterns []string, handler func(string, string), options ...*cache.SubscribeOptions) (cache.ISubscription, error) {
+	return e.c.PSubscribe(patterns, handler, options...)
+}
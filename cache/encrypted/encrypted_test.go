@@ -0,0 +1,160 @@
+package encrypted
+
+import (
+	"bytes"
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/cache/memory"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var (
+	oldKey = Key{ID: "2020-01", Secret: bytes.Repeat([]byte{1}, 32)}
+	newKey = Key{ID: "2020-02", Secret: bytes.Repeat([]byte{2}, 32)}
+)
+
+type user struct {
+	Email string
+}
+
+func TestEncryptedCache_SetGet(t *testing.T) {
+	inner, _ := memory.NewMemoryCache()
+	c, err := NewEncryptedCache(inner, &Options{Keys: []Key{oldKey}})
+	assert.Nil(t, err)
+
+	assert.Nil(t, c.Set("user:1", user{Email: "a@mot.club"}, time.Minute))
+	var u user
+	assert.True(t, c.HasGet("user:1", &u))
+	assert.Equal(t, "a@mot.club", u.Email)
+
+	// the wrapped cache only sees ciphertext
+	raw, _ := inner.HasPrefix("user:")
+	assert.NotContains(t, raw["user:1"], "a@mot.club")
+
+	values, err := c.HasPrefix("user:")
+	assert.Nil(t, err)
+	assert.Contains(t, values["user:1"], "a@mot.club")
+
+	// counters and collections would be stored in plaintext
+	_, err = c.Incr("visits")
+	assert.Equal(t, ErrUnsupported, err)
+	_, err = c.HSet("user:2", map[string]interface{}{"email": "b@mot.club"})
+	assert.Equal(t, ErrUnsupported, err)
+	_, err = c.SAdd("emails", "b@mot.club")
+	assert.Equal(t, ErrUnsupported, err)
+	assert.False(t, inner.Has("visits") || inner.Has("user:2") || inner.Has("emails"))
+
+	items, err := c.MGet("user:1", "missing")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(items))
+	assert.Nil(t, items["user:1"].Bind(&u))
+	assert.Equal(t, "a@mot.club", u.Email)
+}
+
+func TestEncryptedCache_Rotation(t *testing.T) {
+	inner, _ := memory.NewMemoryCache()
+	c, _ := NewEncryptedCache(inner, &Options{Keys: []Key{oldKey}})
+	assert.Nil(t, c.Set("k", "secret"))
+
+	rotated, _ := NewEncryptedCache(inner, &Options{Keys: []Key{newKey, oldKey}})
+	assert.Equal(t, "secret", rotated.GetString("k"))
+	var s sealed
+	assert.True(t, inner.HasGet("k", &s))
+	assert.Equal(t, newKey.ID, s.K)
+
+	// the old key alone no longer decrypts it
+	_, has := c.HasGetString("k")
+	assert.False(t, has)
+}
+
+func TestEncryptedCache_HashedKeys(t *testing.T) {
+	inner, _ := memory.NewMemoryCache()
+	c, _ := NewEncryptedCache(inner, &Options{Keys: []Key{oldKey}, KeyHashSecret: []byte("pepper")})
+	assert.Nil(t, c.Set("user:a@mot.club", 1))
+	assert.Equal(t, 1, c.GetInt("user:a@mot.club"))
+	assert.False(t, inner.Has("user:a@mot.club"))
+
+	_, _, err := c.Scan("user:", "", 10)
+	assert.Equal(t, ErrKeysHashed, err)
+
+	// a value moved under another key fails authentication
+	var s sealed
+	items, _, _ := inner.Scan("", "", 10)
+	assert.Nil(t, items[0].Bind(&s))
+	assert.Nil(t, inner.Set(c.(*encryptedCache).key("other"), &s))
+	_, has := c.HasGetInt("other")
+	assert.False(t, has)
+}
+
+func TestNewEncryptedCache(t *testing.T) {
+	inner, _ := memory.NewMemoryCache()
+	_, err := NewEncryptedCache(inner)
+	assert.Equal(t, ErrNoKeys, err)
+	_, err = NewEncryptedCache(inner, &Options{Keys: []Key{oldKey, oldKey}})
+	assert.Equal(t, ErrDuplicateKey, err)
+	_, err = NewEncryptedCache(inner, &Options{Keys: []Key{{ID: "short", Secret: []byte("x")}}})
+	assert.NotNil(t, err)
+	var _ cache.ICache = (*encryptedCache)(nil)
+}
+
+func TestEncryptedCache_CompareAndSwap(t *testing.T) {
+	inner, _ := memory.NewMemoryCache()
+	c, _ := NewEncryptedCache(inner, &Options{Keys: []Key{oldKey}})
+	assert.Nil(t, c.Set("k", user{Email: "a@mot.club"}))
+
+	ok, err := c.CompareAndSwap("k", user{Email: "b@mot.club"}, user{Email: "c@mot.club"})
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = c.CompareAndSwap("k", user{Email: "a@mot.club"}, user{Email: "c@mot.club"})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	var u user
+	has, err := c.GetSet("k", user{Email: "d@mot.club"}, &u)
+	assert.Nil(t, err)
+	assert.True(t, has)
+	assert.Equal(t, "c@mot.club", u.Email)
+}
+
+func TestEncryptedCache_GetSet(t *testing.T) {
+	inner, _ := memory.NewMemoryCache()
+	c, _ := NewEncryptedCache(inner, &Options{Keys: []Key{newKey, oldKey}})
+
+	// values stored before the cache was encrypted are rejected
+	assert.Nil(t, inner.Set("legacy", user{Email: "a@mot.club"}))
+	var u user
+	assert.False(t, c.HasGet("legacy", &u))
+	_, err := c.MGet("legacy")
+	assert.Equal(t, ErrInvalidSealed, err)
+	_, err = c.GetSet("legacy", user{Email: "b@mot.club"}, &u)
+	assert.Equal(t, ErrInvalidSealed, err)
+	assert.True(t, inner.HasGet("legacy", &u))
+	assert.Equal(t, "a@mot.club", u.Email)
+
+	// unless they are being migrated
+	migrating, _ := NewEncryptedCache(inner, &Options{Keys: []Key{newKey, oldKey}, AllowPlaintext: true})
+	assert.True(t, migrating.HasGet("legacy", &u))
+	has, err := migrating.GetSet("legacy", user{Email: "b@mot.club"}, &u)
+	assert.Nil(t, err)
+	assert.True(t, has)
+	assert.Equal(t, "a@mot.club", u.Email)
+	var s sealed
+	assert.True(t, inner.HasGet("legacy", &s))
+	assert.Equal(t, newKey.ID, s.K)
+
+	// values under an older key are swapped as well
+	old, _ := NewEncryptedCache(inner, &Options{Keys: []Key{oldKey}})
+	assert.Nil(t, old.Set("k", "a"))
+	var v string
+	has, err = c.GetSet("k", "b", &v)
+	assert.Nil(t, err)
+	assert.True(t, has)
+	assert.Equal(t, "a", v)
+	assert.Equal(t, "b", c.GetString("k"))
+
+	has, err = c.GetSet("missing", "c", &v)
+	assert.Nil(t, err)
+	assert.False(t, has)
+	assert.Equal(t, "c", c.GetString("missing"))
+}
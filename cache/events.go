@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// The events reported to OnChange handlers by levels without keyspace
+// notifications. Redis reports the events of its keyspace notifications,
+// which name the command instead of EventSet, such as hset or incrby.
+const (
+	EventSet     = "set"
+	EventDel     = "del"
+	EventExpire  = "expire"
+	EventPersist = "persist"
+	EventExpired = "expired"
+	EventEvicted = "evicted"
+)
+
+// KeyEvents dispatches the key events of levels without keyspace notifications.
+// Handlers run on their own goroutine, so that they may use the cache, and
+// the events of different keys may reach them in any order.
+type KeyEvents struct {
+	mu       sync.RWMutex
+	handlers []keyHandler
+	n        int32
+}
+
+type keyHandler struct {
+	pattern string
+	// expired restricts the handler to EventExpired.
+	expired bool
+	fn      func(key, event string)
+}
+
+func NewKeyEvents() *KeyEvents {
+	return &KeyEvents{}
+}
+
+func (e *KeyEvents) OnExpire(pattern string, handler func(key string)) {
+	e.add(keyHandler{pattern: pattern, expired: true, fn: func(key, _ string) {
+		handler(key)
+	}})
+}
+
+func (e *KeyEvents) OnChange(pattern string, handler func(key, event string)) {
+	e.add(keyHandler{pattern: pattern, fn: handler})
+}
+
+func (e *KeyEvents) add(h keyHandler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handlers = append(e.handlers, h)
+	atomic.StoreInt32(&e.n, int32(len(e.handlers)))
+}
+
+// Emit calls the handlers of event for the keys matching their pattern.
+func (e *KeyEvents) Emit(event string, keys ...string) {
+	if atomic.LoadInt32(&e.n) == 0 {
+		return
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, h := range e.handlers {
+		if h.expired && event != EventExpired {
+			continue
+		}
+		for _, key := range keys {
+			if Match(h.pattern, key) {
+				go h.fn(key, event)
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"encoding"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// FormatArg converts v to the string Redis would store for it, so that local
+// backends agree with Redis on pub/sub payloads and collection members.
+func FormatArg(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case encoding.BinaryMarshaler:
+		b, err := v.MarshalBinary()
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	default:
+		return "", fmt.Errorf("mot: can't marshal %T (implement encoding.BinaryMarshaler)", v)
+	}
+}
+
+// FormatArgs formats every value with FormatArg.
+func FormatArgs(values []interface{}) ([]string, error) {
+	v := make([]string, len(values))
+	for i, value := range values {
+		s, err := FormatArg(value)
+		if err != nil {
+			return nil, err
+		}
+		v[i] = s
+	}
+	return v, nil
+}
+
+// FormatFields formats the values of fields with FormatArg.
+func FormatFields(fields map[string]interface{}) (map[string]string, error) {
+	v := make(map[string]string, len(fields))
+	for name, value := range fields {
+		s, err := FormatArg(value)
+		if err != nil {
+			return nil, err
+		}
+		v[name] = s
+	}
+	return v, nil
+}
@@ -0,0 +1,21 @@
+package cache
+
+import (
+	"time"
+)
+
+// Item is a cached value as returned by batch reads.
+type Item struct {
+	Key string `json:"key"`
+	// Value is the encoded data.
+	Value []byte `json:"value"`
+	// Codec is the name of the codec Value is encoded with, JSON when empty.
+	Codec string `json:"codec,omitempty"`
+	// TTL is the remaining time to live, 0 means no expiration.
+	TTL time.Duration `json:"ttl"`
+}
+
+// Bind decodes the value of the item into dst.
+func (i *Item) Bind(dst interface{}) error {
+	return Unmarshal(i.Codec, i.Value, dst)
+}
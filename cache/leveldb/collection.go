@@ -0,0 +1,341 @@
+package leveldb
+
+import (
+	"github.com/motclub/common/cache"
+	"github.com/syndtr/goleveldb/leveldb"
+	"time"
+)
+
+// collection returns the collection of type typ stored at key, an empty one when there is none.
+func (l *levelDBCache) collection(key, typ string) (*cache.Collection, error) {
+	v, has := l.hasGet(key)
+	if !has {
+		return cache.NewCollection(typ), nil
+	}
+	return cache.DecodeCollection(v.Codec, v.Data, typ)
+}
+
+// modify applies fn to the collection of type typ stored at key, keeping its
+// expiration, and deletes key once the collection is empty.
+func (l *levelDBCache) modify(key, typ string, fn func(c *cache.Collection)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c := cache.NewCollection(typ)
+	v, has := l.hasGet(key)
+	if has {
+		var err error
+		if c, err = cache.DecodeCollection(v.Codec, v.Data, typ); err != nil {
+			return err
+		}
+	}
+	fn(c)
+	batch := new(leveldb.Batch)
+	if c.Len() == 0 {
+		if !has {
+			return nil
+		}
+		if err := l.untag(batch, key); err != nil {
+			return err
+		}
+		batch.Delete([]byte(key))
+		if err := l.commit(batch, 0); err != nil {
+			return err
+		}
+		l.stats.Delete(1)
+		l.events.Emit(cache.EventDel, key)
+		return nil
+	}
+	collection, err := cache.EncodeCollection(c)
+	if err != nil {
+		return err
+	}
+	e := &cache.Envelope{CreatedAt: time.Now(), Codec: cache.CodecCollection, Data: collection}
+	if has {
+		e.CreatedAt = v.CreatedAt
+		e.ExpiredDuration = v.ExpiredDuration
+	}
+	data, err := l.codec.Encode(e)
+	if err != nil {
+		return err
+	}
+	batch.Put([]byte(key), data)
+	indexExpiry(batch, key, e)
+	if err := l.commit(batch, 1); err != nil {
+		return err
+	}
+	l.events.Emit(cache.EventSet, key)
+	return nil
+}
+
+func (l *levelDBCache) HSet(key string, values map[string]interface{}) (int, error) {
+	if l.parent != nil {
+		return l.parent.HSet(key, values)
+	}
+
+	fields, err := cache.FormatFields(values)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = l.modify(key, cache.TypeHash, func(c *cache.Collection) {
+		n = c.HSet(fields)
+	})
+	return n, err
+}
+
+func (l *levelDBCache) HGet(key, field string) (string, bool, error) {
+	if l.parent != nil {
+		return l.parent.HGet(key, field)
+	}
+
+	c, err := l.collection(key, cache.TypeHash)
+	if err != nil {
+		return "", false, err
+	}
+	v, has := c.HGet(field)
+	return v, has, nil
+}
+
+func (l *levelDBCache) HGetAll(key string) (map[string]string, error) {
+	if l.parent != nil {
+		return l.parent.HGetAll(key)
+	}
+
+	c, err := l.collection(key, cache.TypeHash)
+	if err != nil {
+		return nil, err
+	}
+	return c.HGetAll(), nil
+}
+
+func (l *levelDBCache) HDel(key string, fields ...string) (int, error) {
+	if l.parent != nil {
+		return l.parent.HDel(key, fields...)
+	}
+
+	var n int
+	err := l.modify(key, cache.TypeHash, func(c *cache.Collection) {
+		n = c.HDel(fields...)
+	})
+	return n, err
+}
+
+func (l *levelDBCache) LPush(key string, values ...interface{}) (int, error) {
+	if l.parent != nil {
+		return l.parent.LPush(key, values...)
+	}
+
+	members, err := cache.FormatArgs(values)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = l.modify(key, cache.TypeList, func(c *cache.Collection) {
+		n = c.LPush(members...)
+	})
+	return n, err
+}
+
+func (l *levelDBCache) RPush(key string, values ...interface{}) (int, error) {
+	if l.parent != nil {
+		return l.parent.RPush(key, values...)
+	}
+
+	members, err := cache.FormatArgs(values)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = l.modify(key, cache.TypeList, func(c *cache.Collection) {
+		n = c.RPush(members...)
+	})
+	return n, err
+}
+
+func (l *levelDBCache) LPop(key string) (string, bool, error) {
+	if l.parent != nil {
+		return l.parent.LPop(key)
+	}
+
+	var (
+		v   string
+		has bool
+	)
+	err := l.modify(key, cache.TypeList, func(c *cache.Collection) {
+		v, has = c.LPop()
+	})
+	return v, has, err
+}
+
+func (l *levelDBCache) RPop(key string) (string, bool, error) {
+	if l.parent != nil {
+		return l.parent.RPop(key)
+	}
+
+	var (
+		v   string
+		has bool
+	)
+	err := l.modify(key, cache.TypeList, func(c *cache.Collection) {
+		v, has = c.RPop()
+	})
+	return v, has, err
+}
+
+func (l *levelDBCache) LRange(key string, start, stop int) ([]string, error) {
+	if l.parent != nil {
+		return l.parent.LRange(key, start, stop)
+	}
+
+	c, err := l.collection(key, cache.TypeList)
+	if err != nil {
+		return nil, err
+	}
+	return c.LRange(start, stop), nil
+}
+
+func (l *levelDBCache) SAdd(key string, members ...interface{}) (int, error) {
+	if l.parent != nil {
+		return l.parent.SAdd(key, members...)
+	}
+
+	v, err := cache.FormatArgs(members)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = l.modify(key, cache.TypeSet, func(c *cache.Collection) {
+		n = c.SAdd(v...)
+	})
+	return n, err
+}
+
+func (l *levelDBCache) SRem(key string, members ...interface{}) (int, error) {
+	if l.parent != nil {
+		return l.parent.SRem(key, members...)
+	}
+
+	v, err := cache.FormatArgs(members)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = l.modify(key, cache.TypeSet, func(c *cache.Collection) {
+		n = c.SRem(v...)
+	})
+	return n, err
+}
+
+func (l *levelDBCache) SIsMember(key string, member interface{}) (bool, error) {
+	if l.parent != nil {
+		return l.parent.SIsMember(key, member)
+	}
+
+	v, err := cache.FormatArg(member)
+	if err != nil {
+		return false, err
+	}
+	c, err := l.collection(key, cache.TypeSet)
+	if err != nil {
+		return false, err
+	}
+	return c.SIsMember(v), nil
+}
+
+func (l *levelDBCache) SMembers(key string) ([]string, error) {
+	if l.parent != nil {
+		return l.parent.SMembers(key)
+	}
+
+	c, err := l.collection(key, cache.TypeSet)
+	if err != nil {
+		return nil, err
+	}
+	return c.SMembers(), nil
+}
+
+func (l *levelDBCache) ZAdd(key string, members ...cache.Z) (int, error) {
+	if l.parent != nil {
+		return l.parent.ZAdd(key, members...)
+	}
+
+	var n int
+	err := l.modify(key, cache.TypeZSet, func(c *cache.Collection) {
+		n = c.ZAdd(members...)
+	})
+	return n, err
+}
+
+func (l *levelDBCache) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	if l.parent != nil {
+		return l.parent.ZIncrBy(key, increment, member)
+	}
+
+	var v float64
+	err := l.modify(key, cache.TypeZSet, func(c *cache.Collection) {
+		v = c.ZIncrBy(increment, member)
+	})
+	return v, err
+}
+
+func (l *levelDBCache) ZRem(key string, members ...string) (int, error) {
+	if l.parent != nil {
+		return l.parent.ZRem(key, members...)
+	}
+
+	var n int
+	err := l.modify(key, cache.TypeZSet, func(c *cache.Collection) {
+		n = c.ZRem(members...)
+	})
+	return n, err
+}
+
+func (l *levelDBCache) ZScore(key, member string) (float64, bool, error) {
+	if l.parent != nil {
+		return l.parent.ZScore(key, member)
+	}
+
+	c, err := l.collection(key, cache.TypeZSet)
+	if err != nil {
+		return 0, false, err
+	}
+	v, has := c.ZScore(member)
+	return v, has, nil
+}
+
+func (l *levelDBCache) ZRange(key string, start, stop int) ([]cache.Z, error) {
+	if l.parent != nil {
+		return l.parent.ZRange(key, start, stop)
+	}
+
+	c, err := l.collection(key, cache.TypeZSet)
+	if err != nil {
+		return nil, err
+	}
+	return c.ZRange(start, stop), nil
+}
+
+func (l *levelDBCache) ZRevRange(key string, start, stop int) ([]cache.Z, error) {
+	if l.parent != nil {
+		return l.parent.ZRevRange(key, start, stop)
+	}
+
+	c, err := l.collection(key, cache.TypeZSet)
+	if err != nil {
+		return nil, err
+	}
+	return c.ZRevRange(start, stop), nil
+}
+
+func (l *levelDBCache) ZRangeByScore(key string, min, max float64) ([]cache.Z, error) {
+	if l.parent != nil {
+		return l.parent.ZRangeByScore(key, min, max)
+	}
+
+	c, err := l.collection(key, cache.TypeZSet)
+	if err != nil {
+		return nil, err
+	}
+	return c.ZRangeByScore(min, max), nil
+}
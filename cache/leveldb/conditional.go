@@ -0,0 +1,182 @@
+package leveldb
+
+import (
+	"github.com/motclub/common/cache"
+	"github.com/syndtr/goleveldb/leveldb"
+	"time"
+)
+
+// swap writes value at key when cond, given the current entry of key, holds.
+func (l *levelDBCache) swap(key string, value interface{}, expiration time.Duration, cond func(v *cache.Envelope, has bool) (bool, error)) (bool, error) {
+	e, data, err := l.encode(value, expiration)
+	if err != nil {
+		return false, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	v, has := l.hasGet(key)
+	if ok, err := cond(v, has); err != nil || !ok {
+		return false, err
+	}
+	batch := new(leveldb.Batch)
+	if err := l.untag(batch, key); err != nil {
+		return false, err
+	}
+	batch.Put([]byte(key), data)
+	indexExpiry(batch, key, e)
+	if err := l.commit(batch, 1); err != nil {
+		return false, err
+	}
+	l.events.Emit(cache.EventSet, key)
+	return true, nil
+}
+
+// retime rewrites the entry of key as fn changes it, deleting the entry when
+// fn returns false, and reports whether key exists. The rewrite emits event.
+func (l *levelDBCache) retime(key, event string, fn func(v *cache.Envelope) bool) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	v, has := l.hasGet(key)
+	if !has {
+		return false, nil
+	}
+	batch := new(leveldb.Batch)
+	if !fn(v) {
+		if err := l.untag(batch, key); err != nil {
+			return true, err
+		}
+		batch.Delete([]byte(key))
+		if err := l.commit(batch, 0); err != nil {
+			return true, err
+		}
+		l.stats.Delete(1)
+		l.events.Emit(cache.EventDel, key)
+		return true, nil
+	}
+	data, err := l.codec.Encode(v)
+	if err != nil {
+		return true, err
+	}
+	batch.Put([]byte(key), data)
+	indexExpiry(batch, key, v)
+	if err := l.commit(batch, 1); err != nil {
+		return true, err
+	}
+	l.events.Emit(event, key)
+	return true, nil
+}
+
+func (l *levelDBCache) SetNX(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	var exp time.Duration
+	if len(expiration) > 0 {
+		exp = expiration[0]
+	}
+	if l.parent != nil {
+		ok, err := l.parent.SetNX(key, value, expiration...)
+		if ok && err == nil {
+			err = l.set(key, value, exp)
+		}
+		return ok, err
+	}
+
+	return l.swap(key, value, exp, func(_ *cache.Envelope, has bool) (bool, error) {
+		return !has, nil
+	})
+}
+
+func (l *levelDBCache) SetXX(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	var exp time.Duration
+	if len(expiration) > 0 {
+		exp = expiration[0]
+	}
+	if l.parent != nil {
+		ok, err := l.parent.SetXX(key, value, expiration...)
+		if ok && err == nil {
+			err = l.set(key, value, exp)
+		}
+		return ok, err
+	}
+
+	return l.swap(key, value, exp, func(_ *cache.Envelope, has bool) (bool, error) {
+		return has, nil
+	})
+}
+
+func (l *levelDBCache) GetSet(key string, value interface{}, dst interface{}) (bool, error) {
+	if l.parent != nil {
+		has, err := l.parent.GetSet(key, value, dst)
+		if err == nil {
+			err = l.set(key, value, 0)
+		}
+		return has, err
+	}
+
+	var old *cache.Envelope
+	_, err := l.swap(key, value, 0, func(v *cache.Envelope, _ bool) (bool, error) {
+		old = v
+		return true, nil
+	})
+	if err != nil || old == nil {
+		return false, err
+	}
+	return true, cache.Unmarshal(old.Codec, old.Data, dst)
+}
+
+func (l *levelDBCache) CompareAndSwap(key string, old, value interface{}, expiration ...time.Duration) (bool, error) {
+	var exp time.Duration
+	if len(expiration) > 0 {
+		exp = expiration[0]
+	}
+	if l.parent != nil {
+		ok, err := l.parent.CompareAndSwap(key, old, value, expiration...)
+		if ok && err == nil {
+			err = l.set(key, value, exp)
+		}
+		return ok, err
+	}
+
+	return l.swap(key, value, exp, func(v *cache.Envelope, has bool) (bool, error) {
+		if !has {
+			return false, nil
+		}
+		return v.Equal(old)
+	})
+}
+
+func (l *levelDBCache) Expire(key string, ttl time.Duration) (bool, error) {
+	has, err := l.retime(key, cache.EventExpire, func(v *cache.Envelope) bool {
+		v.CreatedAt = time.Now()
+		v.ExpiredDuration = ttl
+		return ttl > 0
+	})
+	if err == nil && l.parent != nil {
+		return l.parent.Expire(key, ttl)
+	}
+	return has, err
+}
+
+func (l *levelDBCache) ExpireAt(key string, at time.Time) (bool, error) {
+	return l.Expire(key, time.Until(at))
+}
+
+func (l *levelDBCache) Persist(key string) (bool, error) {
+	has, err := l.retime(key, cache.EventPersist, func(v *cache.Envelope) bool {
+		v.ExpiredDuration = 0
+		return true
+	})
+	if err == nil && l.parent != nil {
+		return l.parent.Persist(key)
+	}
+	return has, err
+}
+
+func (l *levelDBCache) Touch(key string) (bool, error) {
+	has, err := l.retime(key, cache.EventExpire, func(v *cache.Envelope) bool {
+		v.CreatedAt = time.Now()
+		return true
+	})
+	if err == nil && l.parent != nil {
+		return l.parent.Touch(key)
+	}
+	return has, err
+}
@@ -0,0 +1,45 @@
+package leveldb
+
+import (
+	"github.com/motclub/common/cache"
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"net/url"
+)
+
+var ErrMissingPath = errors.New(`mot: missing leveldb cache path`)
+
+func init() {
+	cache.Register("leveldb", Open)
+}
+
+// Open opens a LevelDB cache from a URI such as
+// "leveldb:///var/cache/app?persistent&sweep_interval=1m&codec=msgpack",
+// which also accepts the write_buffer and block_cache_capacity sizes of LevelDB.
+func Open(u *url.URL) (cache.ICache, error) {
+	path := u.Path
+	if u.Host != "" {
+		// a relative path, as in leveldb://cache/app
+		path = u.Host + u.Path
+	}
+	if path == "" {
+		return nil, ErrMissingPath
+	}
+	q := cache.NewURIOptions(u)
+	o := &Options{
+		Persistent:    q.Bool("persistent"),
+		SweepInterval: q.Duration("sweep_interval"),
+		CodecOptions:  q.CodecOptions(),
+	}
+	var dbo *opt.Options
+	if q.Has("write_buffer") || q.Has("block_cache_capacity") {
+		dbo = &opt.Options{
+			WriteBuffer:        q.Int("write_buffer"),
+			BlockCacheCapacity: q.Int("block_cache_capacity"),
+		}
+	}
+	if err := q.Err(); err != nil {
+		return nil, err
+	}
+	return NewLevelDBCache(path, dbo, o)
+}
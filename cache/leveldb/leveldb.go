@@ -2,27 +2,59 @@ package leveldb
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"github.com/buger/jsonparser"
 	"github.com/motclub/common/cache"
 	"github.com/motclub/common/json"
-	"github.com/motclub/common/std"
 	"github.com/pkg/errors"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
-var ErrCacheUnsupportedPubSub = errors.New(`mot: unsupported Publish/Subscribe messages`)
+const (
+	// internalPrefix starts the keys the cache keeps for itself.
+	internalPrefix = "\x00mot\x00"
+	tagIndexPrefix = internalPrefix + "tag\x00"
+	// keyTagsPrefix starts the entries listing the tags of each tagged key,
+	// which the index entries of a key are dropped with when it is overwritten.
+	keyTagsPrefix = internalPrefix + "tags\x00"
+	// expiryPrefix starts the expiry index, see expiryKey.
+	expiryPrefix = internalPrefix + "exp\x00"
+)
+
+var (
+	ErrCacheNotInteger = errors.New(`mot: value is not an integer or out of range`)
+	ErrCacheNotFloat   = errors.New(`mot: value is not a valid float`)
+)
 
-func NewLevelDBCache(path string, o *opt.Options) (cache.ICache, error) {
+type Options struct {
+	// Persistent keeps the data already stored at path, instead of starting with an empty cache.
+	Persistent bool `json:"persistent"`
+	// SweepInterval is how often expired entries are removed in the background, 0 disables it.
+	SweepInterval time.Duration `json:"sweep_interval"`
+	// CodecOptions select how values are encoded and compressed.
+	cache.CodecOptions
+}
+
+func NewLevelDBCache(path string, o *opt.Options, options ...*Options) (cache.ICache, error) {
+	lo := resolveOptions(options)
+	codec, err := cache.NewEnvelopeCodec(&lo.CodecOptions)
+	if err != nil {
+		return nil, err
+	}
 	if fi, err := os.Stat(path); err == nil {
 		if !fi.IsDir() {
 			return nil, fmt.Errorf("leveldb/storage: open %s: not a directory", path)
 		}
-		if err := os.RemoveAll(path); err != nil {
-			return nil, err
+		if !lo.Persistent {
+			if err := os.RemoveAll(path); err != nil {
+				return nil, err
+			}
 		}
 	}
 
@@ -30,74 +62,174 @@ func NewLevelDBCache(path string, o *opt.Options) (cache.ICache, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &levelDBCache{db: db}, nil
+	l := &levelDBCache{
+		db:            db,
+		stats:         cache.NewStatsRecorder("leveldb"),
+		locks:         cache.NewLocalLocks(),
+		codec:         codec,
+		sweeper:       new(sweeper),
+		events:        cache.NewKeyEvents(),
+		broker:        cache.NewBroker(),
+		mu:            new(sync.Mutex),
+		sweepInterval: lo.SweepInterval,
+	}
+	if lo.Persistent {
+		// drop the entries that expired while the cache was closed, and
+		// index the ones stored before there was an expiry index
+		if err := l.sweepAll(true); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+	if lo.SweepInterval > 0 {
+		l.startSweeper()
+	}
+	return l, nil
+}
+
+func resolveOptions(options []*Options) *Options {
+	var o Options
+	if len(options) > 0 && options[0] != nil {
+		o = *options[0]
+	}
+	return &o
 }
 
+// levelDBCacheValue is the JSON envelope written before values carried a codec header.
 type levelDBCacheValue struct {
 	ExpiredDuration time.Duration `json:"expired_duration"`
 	CreatedAt       time.Time     `json:"created_at"`
 	Data            []byte        `json:"data"`
 }
 
+// decode reads a stored value, in either the current or the legacy JSON envelope.
+func decode(data []byte) (*cache.Envelope, error) {
+	if cache.IsEnvelope(data) {
+		return cache.DecodeEnvelope(data)
+	}
+	var v levelDBCacheValue
+	if err := json.STD().Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return &cache.Envelope{
+		ExpiredDuration: v.ExpiredDuration,
+		CreatedAt:       v.CreatedAt,
+		Codec:           cache.CodecJSON,
+		Data:            v.Data,
+	}, nil
+}
+
 type levelDBCache struct {
-	db       *leveldb.DB
-	parent   cache.ICache
-	children cache.ICache
+	db      *leveldb.DB
+	locks   *cache.LocalLocks
+	stats   *cache.StatsRecorder
+	codec   *cache.EnvelopeCodec
+	sweeper *sweeper
+	events  *cache.KeyEvents
+	// broker delivers the pub/sub messages when there is no parent level.
+	broker *cache.Broker
+	// mu serializes writes with the read-modify-write updates, such as
+	// collections and conditional sets.
+	mu            *sync.Mutex
+	sweepInterval time.Duration
+	parent        cache.ICache
+	children      cache.ICache
+}
+
+func (l *levelDBCache) WithContext(ctx context.Context) cache.ICache {
+	c := *l
+	if l.parent != nil {
+		c.parent = l.parent.WithContext(ctx)
+	}
+	return &c
+}
+
+func (l *levelDBCache) OnExpire(pattern string, handler func(key string)) error {
+	if l.parent != nil {
+		return l.parent.OnExpire(pattern, handler)
+	}
+	l.events.OnExpire(pattern, handler)
+	l.startSweeper()
+	return nil
+}
+
+func (l *levelDBCache) OnChange(pattern string, handler func(key, event string)) error {
+	if l.parent != nil {
+		return l.parent.OnChange(pattern, handler)
+	}
+	l.events.OnChange(pattern, handler)
+	l.startSweeper()
+	return nil
 }
 
 func (l *levelDBCache) Publish(channel string, message interface{}) error {
-	if l.parent == nil {
-		return ErrCacheUnsupportedPubSub
+	if l.parent != nil {
+		return l.parent.Publish(channel, message)
 	}
-	return l.parent.Publish(channel, message)
+	return l.broker.Publish(channel, message)
 }
 
-func (l *levelDBCache) Subscribe(channels []string, handler func(string, string)) error {
-	if l.parent == nil {
-		return ErrCacheUnsupportedPubSub
+func (l *levelDBCache) Subscribe(channels []string, handler func(string, string), options ...*cache.SubscribeOptions) (cache.ISubscription, error) {
+	if l.parent != nil {
+		return l.parent.Subscribe(channels, handler, options...)
 	}
-	return l.parent.Subscribe(channels, handler)
+	return l.broker.Subscribe(channels, handler, options...), nil
 }
 
-func (l *levelDBCache) PSubscribe(patterns []string, handler func(string, string)) error {
-	if l.parent == nil {
-		return ErrCacheUnsupportedPubSub
+func (l *levelDBCache) PSubscribe(patterns []string, handler func(string, string), options ...*cache.SubscribeOptions) (cache.ISubscription, error) {
+	if l.parent != nil {
+		return l.parent.PSubscribe(patterns, handler, options...)
 	}
-	return l.parent.PSubscribe(patterns, handler)
+	return l.broker.PSubscribe(patterns, handler, options...), nil
 }
 
-func (l *levelDBCache) hasGet(path string) (*levelDBCacheValue, bool) {
-	var v levelDBCacheValue
+func (l *levelDBCache) Stats() cache.Stats {
+	return l.stats.Stats()
+}
+
+func (l *levelDBCache) hasGet(path string) (*cache.Envelope, bool) {
+	defer l.stats.Observe(cache.OpGet, time.Now())
 	data, err := l.db.Get([]byte(path), nil)
-	if err == nil {
-		err = json.STD().Unmarshal(data, &v)
-		if v.ExpiredDuration > 0 {
-			expiredAt := v.CreatedAt.Add(v.ExpiredDuration)
-			if time.Now().After(expiredAt) {
-				err = l.db.Delete([]byte(path), nil)
-				return nil, false
-			}
-		} else {
-			err = l.db.Delete([]byte(path), nil)
-			return nil, false
+	if err != nil {
+		if err != leveldb.ErrNotFound {
+			l.stats.Error()
 		}
+		l.stats.Miss()
+		return nil, false
+	}
+	v, err := decode(data)
+	if err != nil {
+		l.stats.Error()
+		l.stats.Miss()
+		return nil, false
 	}
-	return &v, err != leveldb.ErrNotFound
+	if v.Expired(time.Now()) {
+		if l.expire([]byte(path)) {
+			l.stats.Expire(1)
+			l.events.Emit(cache.EventExpired, path)
+		}
+		l.stats.Miss()
+		return nil, false
+	}
+	l.stats.Hit()
+	return v, true
 }
 
 func (l *levelDBCache) TTL(path string) (time.Duration, bool) {
 	v, has := l.hasGet(path)
 	if !has {
-		return 0, has
+		if l.parent != nil {
+			return l.parent.TTL(path)
+		}
+		return 0, false
 	}
-	expiredAt := v.CreatedAt.Add(v.ExpiredDuration)
-	dur := time.Now().Sub(expiredAt)
-	return dur, has
+	return v.Remaining(time.Now()), true
 }
 
 func (l *levelDBCache) Has(path string) bool {
 	_, has := l.hasGet(path)
 	if !has && l.parent != nil {
+		l.stats.Fallthrough()
 		has = l.parent.Has(path)
 	}
 	return has
@@ -106,34 +238,21 @@ func (l *levelDBCache) Has(path string) bool {
 func (l *levelDBCache) HasGet(path string, dst interface{}) bool {
 	cv, has := l.hasGet(path)
 	if has {
-		_ = json.STD().Unmarshal(cv.Data, dst)
+		_ = cache.Unmarshal(cv.Codec, cv.Data, dst)
 	} else if l.parent != nil {
-		has = l.parent.HasGet(path, dst)
-		var ttl time.Duration
-		ttl, has = l.parent.TTL(path)
-		if has {
-			_ = l.Set(path, dst, ttl)
+		l.stats.Fallthrough()
+		if has = l.parent.HasGet(path, dst); has {
+			ttl, _ := l.parent.TTL(path)
+			_ = l.set(path, dst, ttl)
 		}
 	}
 	return has
 }
 
 func (l *levelDBCache) HasGetInt(path string) (int, bool) {
-	cv, has := l.hasGet(path)
-	if has {
-		v, _ := jsonparser.ParseInt(cv.Data)
-		return int(v), has
-	} else if l.parent != nil {
-		var v int
-		v, has = l.parent.HasGetInt(path)
-		var ttl time.Duration
-		ttl, has = l.parent.TTL(path)
-		if has {
-			_ = l.Set(path, v, ttl)
-		}
-		return v, has
-	}
-	return 0, has
+	var v int
+	has := l.HasGet(path, &v)
+	return v, has
 }
 
 func (l *levelDBCache) HasGetInt8(path string) (int8, bool) {
@@ -182,21 +301,9 @@ func (l *levelDBCache) HasGetUint64(path string) (uint64, bool) {
 }
 
 func (l *levelDBCache) HasGetFloat(path string) (float64, bool) {
-	cv, has := l.hasGet(path)
-	if has {
-		v, _ := jsonparser.ParseFloat(cv.Data)
-		return v, has
-	} else if l.parent != nil {
-		var v float64
-		v, has = l.parent.HasGetFloat(path)
-		var ttl time.Duration
-		ttl, has = l.parent.TTL(path)
-		if has {
-			_ = l.Set(path, v, ttl)
-		}
-		return v, has
-	}
-	return 0, has
+	var v float64
+	has := l.HasGet(path, &v)
+	return v, has
 }
 
 func (l *levelDBCache) HasGetFloat32(path string) (float32, bool) {
@@ -209,58 +316,21 @@ func (l *levelDBCache) HasGetFloat64(path string) (float64, bool) {
 }
 
 func (l *levelDBCache) HasGetString(path string) (string, bool) {
-	cv, has := l.hasGet(path)
-	if has {
-		v, _ := jsonparser.ParseString(cv.Data)
-		return v, has
-	} else if l.parent != nil {
-		var v string
-		v, has = l.parent.HasGetString(path)
-		var ttl time.Duration
-		ttl, has = l.parent.TTL(path)
-		if has {
-			_ = l.Set(path, v, ttl)
-		}
-		return v, has
-	}
-	return "", has
+	var v string
+	has := l.HasGet(path, &v)
+	return v, has
 }
 
 func (l *levelDBCache) HasGetBool(path string) (bool, bool) {
-	cv, has := l.hasGet(path)
-	if has {
-		v, _ := jsonparser.ParseBoolean(cv.Data)
-		return v, has
-	} else if l.parent != nil {
-		var v bool
-		v, has = l.parent.HasGetBool(path)
-		var ttl time.Duration
-		ttl, has = l.parent.TTL(path)
-		if has {
-			_ = l.Set(path, v, ttl)
-		}
-		return v, has
-	}
-	return false, has
+	var v bool
+	has := l.HasGet(path, &v)
+	return v, has
 }
 
 func (l *levelDBCache) HasGetTime(path string) (time.Time, bool) {
-	cv, has := l.hasGet(path)
-	if has {
-		var v struct{ Data time.Time }
-		_ = json.Parse(fmt.Sprintf(`{"data":"%s"}`, string(cv.Data)), &v)
-		return v.Data, has
-	} else if l.parent != nil {
-		var v time.Time
-		v, has = l.parent.HasGetTime(path)
-		var ttl time.Duration
-		ttl, has = l.parent.TTL(path)
-		if has {
-			_ = l.Set(path, v, ttl)
-		}
-		return v, has
-	}
-	return time.Time{}, has
+	var v time.Time
+	has := l.HasGet(path, &v)
+	return v, has
 }
 
 func (l *levelDBCache) Get(path string, dst interface{}) {
@@ -466,36 +536,258 @@ func (l *levelDBCache) DefaultGetTime(path string, defaultValue time.Time) time.
 }
 
 func (l *levelDBCache) Set(key string, value interface{}, expiration ...time.Duration) error {
-	s := json.Stringify(std.D{"data": value}, false)
-	raw, _, _, err := jsonparser.Get([]byte(s), "data")
+	var exp time.Duration
+	if len(expiration) > 0 {
+		exp = expiration[0]
+	}
+	err := l.set(key, value, exp)
+	if err == nil && l.parent != nil {
+		err = l.parent.Set(key, value, expiration...)
+	}
+	return err
+}
+
+func (l *levelDBCache) set(key string, value interface{}, expiration time.Duration, tags ...string) error {
+	v, data, err := l.encode(value, expiration)
 	if err != nil {
 		return err
 	}
+	batch := new(leveldb.Batch)
+	batch.Put([]byte(key), data)
+	indexExpiry(batch, key, v)
+	for _, tag := range tags {
+		batch.Put(tagIndexKey(tag, key), nil)
+	}
+	if len(tags) > 0 {
+		batch.Put(keyTagsKey(key), []byte(strings.Join(tags, "\x00")))
+	}
+	if err := l.write(batch, key); err != nil {
+		return err
+	}
+	l.events.Emit(cache.EventSet, key)
+	return nil
+}
+
+// tagIndexKey returns the index entry marking key with tag. Index entries live
+// under internalPrefix, which is hidden from key scans.
+func tagIndexKey(tag, key string) []byte {
+	return []byte(tagIndexPrefix + tag + "\x00" + key)
+}
 
+// keyTagsKey returns the entry listing the tags of key.
+func keyTagsKey(key string) []byte {
+	return []byte(keyTagsPrefix + key)
+}
+
+// untag adds to batch the deletion of the tag index entries of keys, so that
+// invalidating their former tags leaves them alone. The caller holds l.mu.
+func (l *levelDBCache) untag(batch *leveldb.Batch, keys ...string) error {
+	for _, key := range keys {
+		data, err := l.db.Get(keyTagsKey(key), nil)
+		if err == leveldb.ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		for _, tag := range strings.Split(string(data), "\x00") {
+			batch.Delete(tagIndexKey(tag, key))
+		}
+		batch.Delete(keyTagsKey(key))
+	}
+	return nil
+}
+
+func (l *levelDBCache) SetWithTags(key string, value interface{}, tags []string, expiration ...time.Duration) error {
 	var exp time.Duration
 	if len(expiration) > 0 {
 		exp = expiration[0]
 	}
-	cv := &levelDBCacheValue{
-		ExpiredDuration: exp,
-		CreatedAt:       time.Now(),
-		Data:            raw,
+	err := l.set(key, value, exp, tags...)
+	if err == nil && l.parent != nil {
+		err = l.parent.SetWithTags(key, value, tags, expiration...)
 	}
-	data, err := json.STD().Marshal(cv)
+	return err
+}
+
+func (l *levelDBCache) InvalidateTags(tags ...string) error {
+	start := time.Now()
+	l.mu.Lock()
+	var keys []string
+	for _, tag := range tags {
+		prefix := tagIndexKey(tag, "")
+		iter := l.db.NewIterator(util.BytesPrefix(prefix), nil)
+		for iter.Next() {
+			keys = append(keys, string(iter.Key()[len(prefix):]))
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			l.mu.Unlock()
+			return err
+		}
+	}
+	batch := new(leveldb.Batch)
+	err := l.untag(batch, keys...)
+	if err == nil {
+		for _, key := range keys {
+			batch.Delete([]byte(key))
+		}
+		err = l.db.Write(batch, nil)
+	}
+	l.mu.Unlock()
+	if err != nil {
+		l.stats.Error()
+	} else {
+		l.stats.Delete(len(keys))
+		l.events.Emit(cache.EventDel, keys...)
+	}
+	l.stats.Observe(cache.OpDel, start)
+	if err == nil && l.parent != nil {
+		err = l.parent.InvalidateTags(tags...)
+	}
+	return err
+}
+
+// encode returns the envelope of value and its stored form.
+func (l *levelDBCache) encode(value interface{}, expiration time.Duration) (*cache.Envelope, []byte, error) {
+	v, err := l.codec.Marshal(value, expiration)
 	if err != nil {
+		return nil, nil, err
+	}
+	data, err := l.codec.Encode(v)
+	return v, data, err
+}
+
+// write applies batch, which sets keys, serialized with the read-modify-write
+// updates. The tag index entries of keys are dropped first.
+func (l *levelDBCache) write(batch *leveldb.Batch, keys ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := new(leveldb.Batch)
+	if err := l.untag(b, keys...); err != nil {
+		return err
+	}
+	if err := batch.Replay(b); err != nil {
 		return err
 	}
-	err = l.db.Put([]byte(key), data, nil)
+	return l.commit(b, len(keys))
+}
+
+// commit applies batch, the caller holds l.mu.
+func (l *levelDBCache) commit(batch *leveldb.Batch, n int) error {
+	defer l.stats.Observe(cache.OpSet, time.Now())
+	l.sweeper.mu.RLock()
+	defer l.sweeper.mu.RUnlock()
+	if err := l.db.Write(batch, nil); err != nil {
+		l.stats.Error()
+		return err
+	}
+	l.stats.Set(n)
+	return nil
+}
+
+func (l *levelDBCache) MGet(keys ...string) (map[string]*cache.Item, error) {
+	items := make(map[string]*cache.Item, len(keys))
+	var missing []string
+	for _, key := range keys {
+		if cv, has := l.hasGet(key); has && cv.Codec == cache.CodecCollection {
+			// collections are not values
+			continue
+		} else if has {
+			items[key] = cv.Item(key, time.Now())
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 || l.parent == nil {
+		return items, nil
+	}
+
+	l.stats.Fallthrough()
+	found, err := l.parent.MGet(missing...)
+	if err != nil || len(found) == 0 {
+		return items, err
+	}
+	backfill := make([]*cache.Item, 0, len(found))
+	for key, item := range found {
+		items[key] = item
+		backfill = append(backfill, item)
+	}
+	return items, l.setItems(backfill)
+}
+
+func (l *levelDBCache) SetItems(items ...*cache.Item) error {
+	err := l.setItems(items)
 	if err == nil && l.parent != nil {
-		err = l.parent.Set(key, value, expiration...)
+		err = cache.SetItems(l.parent, items...)
 	}
 	return err
 }
 
+// setItems stores items in this level as they are. The envelope records
+// their codec, which may differ from the codec of this level.
+func (l *levelDBCache) setItems(items []*cache.Item) error {
+	now := time.Now()
+	batch := new(leveldb.Batch)
+	keys := make([]string, len(items))
+	for i, item := range items {
+		v := &cache.Envelope{
+			ExpiredDuration: item.TTL,
+			CreatedAt:       now,
+			Codec:           item.Codec,
+			Data:            item.Value,
+		}
+		data, err := l.codec.Encode(v)
+		if err != nil {
+			return err
+		}
+		batch.Put([]byte(item.Key), data)
+		indexExpiry(batch, item.Key, v)
+		keys[i] = item.Key
+	}
+	if err := l.write(batch, keys...); err != nil {
+		return err
+	}
+	for _, item := range items {
+		l.events.Emit(cache.EventSet, item.Key)
+	}
+	return nil
+}
+
+func (l *levelDBCache) MSet(values map[string]interface{}, expiration ...time.Duration) error {
+	var exp time.Duration
+	if len(expiration) > 0 {
+		exp = expiration[0]
+	}
+	batch := new(leveldb.Batch)
+	keys := make([]string, 0, len(values))
+	for key, value := range values {
+		v, data, err := l.encode(value, exp)
+		if err != nil {
+			return err
+		}
+		batch.Put([]byte(key), data)
+		indexExpiry(batch, key, v)
+		keys = append(keys, key)
+	}
+	err := l.write(batch, keys...)
+	if err == nil {
+		for key := range values {
+			l.events.Emit(cache.EventSet, key)
+		}
+	}
+	if err == nil && l.parent != nil {
+		err = l.parent.MSet(values, expiration...)
+	}
+	return err
+}
+
+func (l *levelDBCache) GetOrLoad(key string, dst interface{}, ttl time.Duration, loader cache.LoaderFunc) error {
+	return cache.GetOrLoad(l, key, dst, ttl, loader)
+}
+
 func (l *levelDBCache) HasPrefix(s string, limit ...int) (map[string]string, error) {
-	keyword := []byte(s)
-	v, err := l.filter(func(key, value []byte) bool {
-		return bytes.HasPrefix(key, keyword)
+	v, err := l.filter(util.BytesPrefix([]byte(s)), func(key []byte) bool {
+		return true
 	}, limit...)
 
 	if err == nil && len(v) == 0 && l.parent != nil {
@@ -507,7 +799,7 @@ func (l *levelDBCache) HasPrefix(s string, limit ...int) (map[string]string, err
 
 func (l *levelDBCache) HasSuffix(s string, limit ...int) (map[string]string, error) {
 	keyword := []byte(s)
-	v, err := l.filter(func(key, value []byte) bool {
+	v, err := l.filter(nil, func(key []byte) bool {
 		return bytes.HasSuffix(key, keyword)
 	}, limit...)
 
@@ -520,7 +812,7 @@ func (l *levelDBCache) HasSuffix(s string, limit ...int) (map[string]string, err
 
 func (l *levelDBCache) Contains(s string, limit ...int) (map[string]string, error) {
 	keyword := []byte(s)
-	v, err := l.filter(func(key, value []byte) bool {
+	v, err := l.filter(nil, func(key []byte) bool {
 		return bytes.Contains(key, keyword)
 	}, limit...)
 
@@ -531,33 +823,131 @@ func (l *levelDBCache) Contains(s string, limit ...int) (map[string]string, erro
 	return v, err
 }
 
-func (l *levelDBCache) filter(filter func(key, value []byte) bool, limit ...int) (map[string]string, error) {
+func (l *levelDBCache) filter(slice *util.Range, filter func(key []byte) bool, limit ...int) (map[string]string, error) {
 	var max int
 	if len(limit) > 0 {
 		max = limit[0]
 	}
 
-	var v = make(map[string]string)
-	iter := l.db.NewIterator(nil, nil)
+	v := make(map[string]string)
+	err := l.iterate(slice, func(key []byte, cv *cache.Envelope) bool {
+		if filter(key) {
+			v[string(key)] = cache.DataString(cv.Codec, cv.Data)
+		}
+		return max <= 0 || len(v) < max
+	})
+	return v, err
+}
+
+// iterate calls fn in key order with the live values of slice, a nil slice
+// covering the whole database, until fn returns false. Collections are skipped.
+func (l *levelDBCache) iterate(slice *util.Range, fn func(key []byte, cv *cache.Envelope) bool) error {
+	now := time.Now()
+	iter := l.db.NewIterator(slice, nil)
+	defer iter.Release()
 	for iter.Next() {
 		key := iter.Key()
-		value := iter.Value()
-		if filter(key, value) {
-			v[string(key)] = string(value)
+		if bytes.HasPrefix(key, []byte(internalPrefix)) {
+			continue
+		}
+		cv, err := decode(iter.Value())
+		if err != nil || cv.Expired(now) || cv.Codec == cache.CodecCollection {
+			continue
 		}
-		if max > 0 && len(v) >= max {
+		if !fn(key, cv) {
 			break
 		}
 	}
-	iter.Release()
-	return v, iter.Error()
+	return iter.Error()
+}
+
+func (l *levelDBCache) Scan(prefix, cursor string, limit int) ([]*cache.Item, string, error) {
+	if l.parent != nil {
+		return l.parent.Scan(prefix, cursor, limit)
+	}
+
+	slice := util.BytesPrefix([]byte(prefix))
+	if cursor != "" {
+		if !strings.HasPrefix(cursor, prefix) {
+			return nil, "", cache.ErrInvalidCursor
+		}
+		// resume right after the cursor key
+		slice.Start = append([]byte(cursor), 0)
+	}
+	now := time.Now()
+	var items []*cache.Item
+	var more bool
+	err := l.iterate(slice, func(key []byte, cv *cache.Envelope) bool {
+		if limit > 0 && len(items) == limit {
+			more = true
+			return false
+		}
+		items = append(items, cv.Item(string(key), now))
+		return true
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if !more {
+		return items, "", nil
+	}
+	return items, items[len(items)-1].Key, nil
+}
+
+func (l *levelDBCache) Lock(key string, ttl time.Duration) (cache.ILock, error) {
+	if l.parent != nil {
+		return l.parent.Lock(key, ttl)
+	}
+
+	return l.locks.Lock(key, ttl)
+}
+
+// update atomically replaces the value of key with the one fn returns, keeping its expiration.
+func (l *levelDBCache) update(key string, fn func(v *cache.Envelope, has bool) (interface{}, error)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	v, has := l.hasGet(key)
+	value, err := fn(v, has)
+	if err != nil {
+		return err
+	}
+	e, err := l.codec.Marshal(value, 0)
+	if err != nil {
+		return err
+	}
+	if has {
+		e.CreatedAt = v.CreatedAt
+		e.ExpiredDuration = v.ExpiredDuration
+	}
+	data, err := l.codec.Encode(e)
+	if err != nil {
+		return err
+	}
+	batch := new(leveldb.Batch)
+	batch.Put([]byte(key), data)
+	indexExpiry(batch, key, e)
+	if err := l.commit(batch, 1); err != nil {
+		return err
+	}
+	l.events.Emit(cache.EventSet, key)
+	return nil
 }
 
 func (l *levelDBCache) incr(key string, step int) (int, error) {
-	v := l.GetInt(key)
-	v = v + step
-	err := l.Set(key, v)
-	return v, err
+	var n int
+	err := l.update(key, func(v *cache.Envelope, has bool) (interface{}, error) {
+		if has && cache.Unmarshal(v.Codec, v.Data, &n) != nil {
+			return nil, ErrCacheNotInteger
+		}
+		n += step
+		return n, nil
+	})
+	if err == nil {
+		// the copies held by the child levels never update, evict them
+		cache.EvictChildren(l, key)
+	}
+	return n, err
 }
 
 func (l *levelDBCache) Incr(key string) (int, error) {
@@ -581,26 +971,57 @@ func (l *levelDBCache) IncrByFloat(key string, step float64) (float64, error) {
 		return l.parent.IncrByFloat(key, step)
 	}
 
-	v := l.GetFloat(key)
-	v = v + step
-	err := l.Set(key, v)
-	return v, err
+	var f float64
+	err := l.update(key, func(v *cache.Envelope, has bool) (interface{}, error) {
+		if has && cache.Unmarshal(v.Codec, v.Data, &f) != nil {
+			return nil, ErrCacheNotFloat
+		}
+		f += step
+		return f, nil
+	})
+	if err == nil {
+		cache.EvictChildren(l, key)
+	}
+	return f, err
 }
 
 func (l *levelDBCache) Del(keys ...string) error {
-	var err error
-	for _, key := range keys {
-		e := l.db.Delete([]byte(key), nil)
-		if err == nil && e != nil {
-			err = e
+	start := time.Now()
+	batch := new(leveldb.Batch)
+	l.mu.Lock()
+	err := l.untag(batch, keys...)
+	if err == nil {
+		for _, key := range keys {
+			batch.Delete([]byte(key))
 		}
+		err = l.db.Write(batch, nil)
 	}
+	l.mu.Unlock()
+	if err != nil {
+		l.stats.Error()
+	} else {
+		l.stats.Delete(len(keys))
+		l.events.Emit(cache.EventDel, keys...)
+	}
+	l.stats.Observe(cache.OpDel, start)
 	if l.parent != nil {
 		err = l.parent.Del(keys...)
 	}
 	return err
 }
 
+func (l *levelDBCache) Local() cache.ICache {
+	c := *l
+	c.parent = nil
+	c.children = nil
+	return &c
+}
+
+// Identity identifies the cache by its database and its parent level.
+func (l *levelDBCache) Identity() interface{} {
+	return [2]interface{}{l.db, cache.Identity(l.parent)}
+}
+
 func (l *levelDBCache) Parent() cache.ICache {
 	return l.parent
 }
@@ -622,5 +1043,7 @@ func (l *levelDBCache) SetChildren(children cache.ICache) {
 }
 
 func (l *levelDBCache) Close() error {
+	l.sweeper.Stop()
+	l.broker.Close()
 	return l.db.Close()
 }
@@ -0,0 +1,350 @@
+package leveldb
+
+import (
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/cache/cachetest"
+	"github.com/motclub/common/cache/memory"
+	"github.com/motclub/common/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestCache(t *testing.T) cache.ICache {
+	dir, err := ioutil.TempDir("", "mot-leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	c, err := NewLevelDBCache(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestLevelDBCache_SetGet(t *testing.T) {
+	c := newTestCache(t)
+
+	assert.Nil(t, c.Set("int", 10))
+	assert.Nil(t, c.Set("string", "hello", time.Minute))
+	assert.Equal(t, 10, c.GetInt("int"))
+	assert.Equal(t, "hello", c.GetString("string"))
+
+	var s string
+	assert.True(t, c.HasGet("string", &s))
+	assert.Equal(t, "hello", s)
+
+	assert.Nil(t, c.Del("int", "string"))
+	assert.False(t, c.Has("int"))
+	assert.False(t, c.Has("string"))
+}
+
+func TestLevelDBCache_MGet(t *testing.T) {
+	l1 := newTestCache(t)
+	l2, _ := memory.NewMemoryCache()
+	c, _ := cache.NewCache([]cache.ICache{l1, l2})
+
+	assert.Nil(t, c.MSet(map[string]interface{}{"a": 1, "b": "two"}, time.Minute))
+	assert.Nil(t, l2.Set("c", 3))
+
+	items, err := c.MGet("a", "b", "c", "d")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(items))
+	assert.True(t, items["a"].TTL > 0)
+
+	// "c" was only in the parent and has been backfilled
+	assert.Nil(t, l2.Del("c"))
+	assert.Equal(t, 3, l1.GetInt("c"))
+}
+
+func TestLevelDBCache_InvalidateTags(t *testing.T) {
+	c := newTestCache(t)
+
+	assert.Nil(t, c.SetWithTags("a", 1, []string{"t1"}))
+	assert.Nil(t, c.SetWithTags("b", 2, []string{"t1", "t2"}))
+	assert.Nil(t, c.SetWithTags("c", 3, []string{"t2"}))
+
+	assert.Nil(t, c.InvalidateTags("t1"))
+	assert.False(t, c.Has("a"))
+	assert.False(t, c.Has("b"))
+	assert.True(t, c.Has("c"))
+
+	// tag index entries are hidden from key scans
+	v, err := c.Contains("t2")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(v))
+}
+
+func TestLevelDBCache_Persistent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mot-leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := NewLevelDBCache(dir, nil, &Options{Persistent: true})
+	assert.Nil(t, err)
+	assert.Nil(t, c.Set("kept", "hello"))
+	assert.Nil(t, c.Set("expired", "bye", 10*time.Millisecond))
+	assert.Nil(t, c.Close())
+	time.Sleep(20 * time.Millisecond)
+
+	c, err = NewLevelDBCache(dir, nil, &Options{Persistent: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", c.GetString("kept"))
+	assert.Equal(t, uint64(1), c.Stats().Expirations)
+	assert.False(t, c.Has("expired"))
+	assert.Nil(t, c.Close())
+
+	c, err = NewLevelDBCache(dir, nil)
+	assert.Nil(t, err)
+	assert.False(t, c.Has("kept"))
+	assert.Nil(t, c.Close())
+}
+
+func TestLevelDBCache_Sweep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mot-leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, err := NewLevelDBCache(dir, nil, &Options{SweepInterval: 20 * time.Millisecond})
+	assert.Nil(t, err)
+	defer c.Close()
+
+	assert.Nil(t, c.Set("kept", "hello"))
+	assert.Nil(t, c.SetWithTags("expired", "bye", []string{"t"}, 10*time.Millisecond))
+	time.Sleep(50 * time.Millisecond)
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(1), stats.Expirations)
+	assert.Equal(t, int64(1), stats.Keys)
+	assert.True(t, stats.Bytes > 0)
+	assert.Equal(t, "hello", c.GetString("kept"))
+
+	// the tag index entries went along with the expired entry
+	iter := c.(*levelDBCache).db.NewIterator(util.BytesPrefix([]byte(internalPrefix)), nil)
+	defer iter.Release()
+	assert.False(t, iter.Next())
+}
+
+func TestLevelDBCache_ExpiryIndex(t *testing.T) {
+	c := newTestCache(t)
+	l := c.(*levelDBCache)
+
+	assert.Nil(t, c.Set("expired", 1, time.Millisecond))
+	assert.Nil(t, c.Set("rewritten", 1, time.Millisecond))
+	assert.Nil(t, c.Set("rewritten", 2))
+	assert.Nil(t, c.Set("later", 1, time.Hour))
+	// an entry written before there was an expiry index
+	v, _, _ := l.encode(1, time.Millisecond)
+	v.CreatedAt = v.CreatedAt.Add(-time.Second)
+	data, _ := l.codec.Encode(v)
+	assert.Nil(t, l.db.Put([]byte("unindexed"), data, nil))
+	time.Sleep(5 * time.Millisecond)
+
+	// sweeps only read the expiry index up to now
+	assert.Nil(t, l.sweep())
+	assert.Equal(t, uint64(1), c.Stats().Expirations)
+	assert.Equal(t, 2, c.GetInt("rewritten"))
+	has, _ := l.db.Has([]byte("unindexed"), nil)
+	assert.True(t, has)
+	iter := l.db.NewIterator(util.BytesPrefix([]byte(expiryPrefix)), nil)
+	assert.True(t, iter.Next())
+	assert.Equal(t, "later", string(iter.Key()[len(expiryPrefix)+8:]))
+	assert.False(t, iter.Next())
+	iter.Release()
+
+	assert.Nil(t, l.sweepAll(false))
+	assert.Equal(t, uint64(2), c.Stats().Expirations)
+	assert.Equal(t, int64(2), c.Stats().Keys)
+}
+
+func TestLevelDBCache_Scan(t *testing.T) {
+	c := newTestCache(t)
+	for _, key := range []string{"user:3", "user:1", "user:2", "order:1"} {
+		assert.Nil(t, c.Set(key, key))
+	}
+	assert.Nil(t, c.SetWithTags("user:4", 4, []string{"t"}, time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+
+	items, cursor, err := c.Scan("user:", "", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "user:2", cursor)
+	assert.Equal(t, 2, len(items))
+	assert.Equal(t, "user:1", items[0].Key)
+
+	items, cursor, err = c.Scan("user:", cursor, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "", cursor)
+	assert.Equal(t, 1, len(items))
+	var v string
+	assert.Nil(t, items[0].Bind(&v))
+	assert.Equal(t, "user:3", v)
+
+	values, err := c.HasPrefix("user:")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(values))
+	assert.Equal(t, "user:1", values["user:1"])
+}
+
+func TestLevelDBCache_Codec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mot-leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, err := NewLevelDBCache(dir, nil, &Options{CodecOptions: cache.CodecOptions{
+		Codec:             cache.CodecMsgpack,
+		Compression:       cache.CompressionSnappy,
+		CompressThreshold: 16,
+	}})
+	assert.Nil(t, err)
+	defer c.Close()
+
+	type user struct {
+		Name string
+	}
+	assert.Nil(t, c.Set("user", user{Name: "mot"}))
+	var u user
+	assert.True(t, c.HasGet("user", &u))
+	assert.Equal(t, "mot", u.Name)
+
+	// entries written before the codec header still decode
+	legacy, _ := json.STD().Marshal(&levelDBCacheValue{CreatedAt: time.Now(), Data: []byte(`"old"`)})
+	assert.Nil(t, c.(*levelDBCache).db.Put([]byte("legacy"), legacy, nil))
+	assert.Equal(t, "old", c.GetString("legacy"))
+
+	items, err := c.MGet("user", "legacy")
+	assert.Nil(t, err)
+	assert.Equal(t, cache.CodecMsgpack, items["user"].Codec)
+	assert.Nil(t, items["user"].Bind(&u))
+	assert.Equal(t, "mot", u.Name)
+}
+
+func TestLevelDBCache_Collections(t *testing.T) {
+	c := newTestCache(t)
+
+	n, err := c.RPush("queue", "a", "b", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	v, has, err := c.LPop("queue")
+	assert.Nil(t, err)
+	assert.True(t, has)
+	assert.Equal(t, "a", v)
+	values, err := c.LRange("queue", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "3"}, values)
+
+	_, err = c.ZAdd("scores", cache.Z{Member: "a", Score: 1}, cache.Z{Member: "b", Score: 2})
+	assert.Nil(t, err)
+	score, has, _ := c.ZScore("scores", "b")
+	assert.True(t, has)
+	assert.Equal(t, 2.0, score)
+
+	assert.Nil(t, c.Set("plain", "text"))
+	_, _, err = c.HGet("plain", "field")
+	assert.Equal(t, cache.ErrWrongType, err)
+
+	n, _ = c.HDel("missing", "field")
+	assert.Equal(t, 0, n)
+	assert.False(t, c.Has("missing"))
+}
+
+func TestLevelDBCache_TTL(t *testing.T) {
+	c := newTestCache(t)
+	assert.Nil(t, c.Set("forever", 1))
+	ttl, has := c.TTL("forever")
+	assert.True(t, has)
+	assert.Equal(t, time.Duration(0), ttl)
+
+	assert.Nil(t, c.Set("short", 1, time.Minute))
+	ttl, _ = c.TTL("short")
+	assert.True(t, ttl > 0 && ttl <= time.Minute)
+
+	has, err := c.Expire("short", time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, has)
+	ttl, _ = c.TTL("short")
+	assert.True(t, ttl > time.Minute)
+	has, _ = c.Persist("short")
+	assert.True(t, has)
+	ttl, _ = c.TTL("short")
+	assert.Equal(t, time.Duration(0), ttl)
+	assert.Equal(t, 1, c.GetInt("short"))
+
+	ok, err := c.SetNX("short", 2)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, _ = c.CompareAndSwap("short", 1, 2)
+	assert.True(t, ok)
+	assert.Equal(t, 2, c.GetInt("short"))
+}
+
+func TestLevelDBCache_Events(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mot-leveldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, err := NewLevelDBCache(dir, nil, &Options{SweepInterval: 10 * time.Millisecond})
+	assert.Nil(t, err)
+	defer c.Close()
+
+	expired := make(chan string, 1)
+	changed := make(chan string, 4)
+	assert.Nil(t, c.OnExpire("session.*", func(key string) {
+		expired <- key
+	}))
+	assert.Nil(t, c.OnChange("user.*", func(key, event string) {
+		changed <- key + ":" + event
+	}))
+
+	assert.Nil(t, c.Set("session.1", 1, 20*time.Millisecond))
+	select {
+	case key := <-expired:
+		assert.Equal(t, "session.1", key)
+	case <-time.After(time.Second):
+		t.Fatal("expiration not notified")
+	}
+
+	assert.Nil(t, c.Set("user.1", 1))
+	_, err = c.Persist("user.1")
+	assert.Nil(t, err)
+	var events []string
+	for len(events) < 2 {
+		select {
+		case event := <-changed:
+			events = append(events, event)
+		case <-time.After(time.Second):
+			t.Fatal("change not notified")
+		}
+	}
+	assert.ElementsMatch(t, []string{"user.1:set", "user.1:persist"}, events)
+}
+
+func TestLevelDBCache_PubSub(t *testing.T) {
+	c := newTestCache(t)
+	received := make(chan string, 1)
+	_, err := c.PSubscribe([]string{"news.*"}, func(channel string, message string) {
+		received <- channel + ":" + message
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, c.Publish("news.sport", "goal"))
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, "news.sport:goal", msg)
+	case <-time.After(time.Second):
+		t.Fatal("message not delivered")
+	}
+}
+
+func TestLevelDBCache_Conformance(t *testing.T) {
+	cachetest.Run(t, newTestCache)
+}
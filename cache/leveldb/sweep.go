@@ -0,0 +1,254 @@
+package leveldb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/motclub/common/cache"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"sync"
+	"time"
+)
+
+// sweeper periodically removes the expired entries of a cache and compacts the
+// range they were deleted from. Writers hold mu for reading, and the reads
+// deleting an expired entry hold it like the sweeps, so that an entry
+// rewritten meanwhile is never deleted by them.
+type sweeper struct {
+	mu sync.RWMutex
+	cache.Sweeper
+}
+
+// fullSweepEvery is how many sweeps of the expiry index run between two sweeps
+// of the whole database, which recount the keys and their size for the stats.
+const fullSweepEvery = 60
+
+// startSweeper starts sweeping at the sweep interval, or at the default one when there is none.
+func (l *levelDBCache) startSweeper() {
+	interval := l.sweepInterval
+	if interval <= 0 {
+		interval = cache.DefaultSweepInterval
+	}
+	n := 0
+	l.sweeper.Start(interval, func() {
+		if n%fullSweepEvery == 0 {
+			_ = l.sweepAll(false)
+		} else {
+			_ = l.sweep()
+		}
+		n++
+	})
+}
+
+// expiryKey returns the entry of the expiry index marking key to expire at.
+// The entries are ordered by time, so that sweeps only read the expired ones.
+func expiryKey(at time.Time, key string) []byte {
+	b := make([]byte, len(expiryPrefix)+8+len(key))
+	copy(b, expiryPrefix)
+	binary.BigEndian.PutUint64(b[len(expiryPrefix):], uint64(at.UnixNano()))
+	copy(b[len(expiryPrefix)+8:], key)
+	return b
+}
+
+// indexExpiry adds to batch the expiry index entry of key, stored as v, when
+// v expires. The entries of the values key held before are left to the sweeps.
+func indexExpiry(batch *leveldb.Batch, key string, v *cache.Envelope) {
+	if v.ExpiredDuration > 0 {
+		batch.Put(expiryKey(v.CreatedAt.Add(v.ExpiredDuration), key), nil)
+	}
+}
+
+// indexedKey returns the key a tag index entry refers to.
+func indexedKey(indexKey []byte) []byte {
+	if bytes.HasPrefix(indexKey, []byte(keyTagsPrefix)) {
+		return indexKey[len(keyTagsPrefix):]
+	}
+	i := bytes.IndexByte(indexKey[len(tagIndexPrefix):], 0)
+	if i < 0 {
+		return nil
+	}
+	return indexKey[len(tagIndexPrefix)+i+1:]
+}
+
+// sweep deletes the entries the expiry index lists as expired by now, along
+// with their index entries.
+func (l *levelDBCache) sweep() error {
+	now := time.Now()
+	var entries, keys [][]byte
+	iter := l.db.NewIterator(&util.Range{Start: []byte(expiryPrefix), Limit: expiryKey(now.Add(1), "")}, nil)
+	for iter.Next() {
+		entry := append([]byte(nil), iter.Key()...)
+		entries = append(entries, entry)
+		keys = append(keys, entry[len(expiryPrefix)+8:])
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		l.stats.Error()
+		return err
+	}
+	return l.expireKeys(now, keys, entries)
+}
+
+// expireKeys deletes the entries of keys still expired at now, and the index
+// entries listed in indexKeys. The tag index entries of the deleted keys, and
+// of the missing ones, which expired when read, go along with them.
+func (l *levelDBCache) expireKeys(now time.Time, keys, indexKeys [][]byte) error {
+	if len(keys) == 0 && len(indexKeys) == 0 {
+		return nil
+	}
+	l.mu.Lock()
+	l.sweeper.mu.Lock()
+	var compact *util.Range
+	batch := new(leveldb.Batch)
+	for _, indexKey := range indexKeys {
+		batch.Delete(indexKey)
+		compact = extend(compact, indexKey)
+	}
+	deleted := make(map[string]bool, len(keys))
+	var err error
+	for _, key := range keys {
+		// the entry may have been rewritten since it was read
+		data, getErr := l.db.Get(key, nil)
+		if getErr == nil {
+			if v, err := decode(data); err != nil || !v.Expired(now) {
+				continue
+			}
+			batch.Delete(key)
+			deleted[string(key)] = true
+			compact = extend(compact, key)
+		} else if getErr != leveldb.ErrNotFound {
+			continue
+		}
+		if err = l.untag(batch, string(key)); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = l.db.Write(batch, nil)
+	}
+	l.sweeper.mu.Unlock()
+	l.mu.Unlock()
+	if err != nil {
+		l.stats.Error()
+		return err
+	}
+
+	l.stats.Expire(len(deleted))
+	for key := range deleted {
+		l.events.Emit(cache.EventExpired, key)
+	}
+	if compact != nil {
+		// compact only the range of the deleted entries, Limit is exclusive
+		compact.Limit = append(append([]byte(nil), compact.Limit...), 0)
+		return l.db.CompactRange(*compact)
+	}
+	return nil
+}
+
+// sweepAll sweeps, then scans the whole database: it deletes the expired
+// entries missing from the expiry index, when reindex is set indexes the live
+// ones, and deletes the tag index entries of missing keys. It records the
+// number of keys left and their size.
+func (l *levelDBCache) sweepAll(reindex bool) error {
+	if err := l.sweep(); err != nil {
+		return err
+	}
+	now := time.Now()
+	var (
+		expired   [][]byte
+		keys      int64
+		size      int64
+		indexKeys [][]byte
+	)
+	index := new(leveldb.Batch)
+	iter := l.db.NewIterator(nil, nil)
+	for iter.Next() {
+		key := iter.Key()
+		if bytes.HasPrefix(key, []byte(tagIndexPrefix)) || bytes.HasPrefix(key, []byte(keyTagsPrefix)) {
+			indexKeys = append(indexKeys, append([]byte(nil), key...))
+			continue
+		}
+		if bytes.HasPrefix(key, []byte(internalPrefix)) {
+			continue
+		}
+		v, err := decode(iter.Value())
+		if err == nil && v.Expired(now) {
+			expired = append(expired, append([]byte(nil), key...))
+			continue
+		}
+		if err == nil && reindex {
+			indexExpiry(index, string(key), v)
+		}
+		keys++
+		size += int64(len(key) + len(iter.Value()))
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		l.stats.Error()
+		return err
+	}
+	// an entry rewritten meanwhile leaves a stale index entry, which sweeps drop
+	if err := l.db.Write(index, nil); err != nil {
+		l.stats.Error()
+		return err
+	}
+	if err := l.expireKeys(now, expired, nil); err != nil {
+		return err
+	}
+
+	l.sweeper.mu.Lock()
+	var compact *util.Range
+	batch := new(leveldb.Batch)
+	for _, indexKey := range indexKeys {
+		key := indexedKey(indexKey)
+		if key == nil {
+			continue
+		}
+		if has, err := l.db.Has(key, nil); err == nil && !has {
+			batch.Delete(indexKey)
+			compact = extend(compact, indexKey)
+		}
+	}
+	err := l.db.Write(batch, nil)
+	l.sweeper.mu.Unlock()
+	if err != nil {
+		l.stats.Error()
+		return err
+	}
+
+	l.stats.Size(keys, size)
+	if compact != nil {
+		compact.Limit = append(append([]byte(nil), compact.Limit...), 0)
+		return l.db.CompactRange(*compact)
+	}
+	return nil
+}
+
+// extend returns r extended to hold key, a new range when r is nil.
+func extend(r *util.Range, key []byte) *util.Range {
+	switch {
+	case r == nil:
+		return &util.Range{Start: key, Limit: key}
+	case bytes.Compare(key, r.Start) < 0:
+		r.Start = key
+	case bytes.Compare(key, r.Limit) > 0:
+		r.Limit = key
+	}
+	return r
+}
+
+// expire deletes the entry at path when it is still expired, holding mu like
+// the sweeps so that an entry rewritten since it was read is kept. It reports
+// whether the entry was deleted.
+func (l *levelDBCache) expire(path []byte) bool {
+	l.sweeper.mu.Lock()
+	defer l.sweeper.mu.Unlock()
+	data, err := l.db.Get(path, nil)
+	if err != nil {
+		return false
+	}
+	if v, err := decode(data); err != nil || !v.Expired(time.Now()) {
+		return false
+	}
+	return l.db.Delete(path, nil) == nil
+}
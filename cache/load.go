@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"github.com/motclub/common/json"
+	"sync"
+	"time"
+)
+
+// LoaderFunc loads the value of a key that is missing from every cache level.
+type LoaderFunc func() (interface{}, error)
+
+type loadCall struct {
+	wg    sync.WaitGroup
+	value interface{}
+	err   error
+}
+
+// IIdentifier is implemented by the caches whose views, such as the ones
+// WithContext returns, are distinct values sharing one storage.
+type IIdentifier interface {
+	// Identity returns a comparable value, the same for every view of the cache.
+	Identity() interface{}
+}
+
+// Identity returns the identity of c, c itself unless it is an IIdentifier.
+func Identity(c ICache) interface{} {
+	if c == nil {
+		return nil
+	}
+	if i, ok := c.(IIdentifier); ok {
+		return i.Identity()
+	}
+	return c
+}
+
+// loadKey identifies a load by the identity of the cache it writes to as well
+// as the key, so that the views of a cache share their loads while wrappers
+// storing the same key differently, such as namespaces, never share a value.
+type loadKey struct {
+	c   interface{}
+	key string
+}
+
+// loadGroup collapses concurrent loads of the same key into one call, like singleflight.
+type loadGroup struct {
+	mu    sync.Mutex
+	calls map[loadKey]*loadCall
+}
+
+var loads = &loadGroup{calls: make(map[loadKey]*loadCall)}
+
+func (g *loadGroup) do(key loadKey, fn func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if c, has := g.calls[key]; has {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.value, c.err
+	}
+	c := new(loadCall)
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+	c.value, c.err = fn()
+	return c.value, c.err
+}
+
+// GetOrLoad reads key into dst and falls back to loader when no level has it.
+// Concurrent misses of the same key of c, or of views of c, in this process share a single loader call,
+// whose value is written through every level of c with the given ttl. When the
+// loader succeeds but the write fails, dst is still filled and the write error
+// is returned.
+func GetOrLoad(c ICache, key string, dst interface{}, ttl time.Duration, loader LoaderFunc) error {
+	if c.HasGet(key, dst) {
+		return nil
+	}
+	value, err := loads.do(loadKey{c: Identity(c), key: key}, func() (interface{}, error) {
+		value, err := loader()
+		if err != nil {
+			return nil, err
+		}
+		return value, c.Set(key, value, ttl)
+	})
+	if err != nil && value == nil {
+		return err
+	}
+	if e := json.Copy(value, dst); e != nil {
+		return e
+	}
+	return err
+}
@@ -0,0 +1,41 @@
+package cache_test
+
+import (
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/cache/memory"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrLoad(t *testing.T) {
+	l1, _ := memory.NewMemoryCache()
+	l2, _ := memory.NewMemoryCache()
+	c, err := cache.NewCache([]cache.ICache{l1, l2})
+	assert.Nil(t, err)
+
+	var calls int32
+	loader := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		return "loaded", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var v string
+			assert.Nil(t, c.GetOrLoad("hot", &v, time.Minute, loader))
+			assert.Equal(t, "loaded", v)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, "loaded", l1.GetString("hot"))
+	assert.Equal(t, "loaded", l2.GetString("hot"))
+}
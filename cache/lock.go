@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrLockNotObtained = errors.New(`mot: lock not obtained`)
+	ErrLockNotHeld     = errors.New(`mot: lock not held`)
+	ErrInvalidLockTTL  = errors.New(`mot: lock ttl must be positive`)
+)
+
+// minLocalLocksPrune is the number of entries below which LocalLocks never looks for expired locks.
+const minLocalLocksPrune = 64
+
+// ILock is a lock held on a key until it is unlocked or its TTL runs out.
+// Locks always expire, locking or extending with a TTL that is not positive
+// fails with ErrInvalidLockTTL.
+type ILock interface {
+	Key() string
+	// Token identifies this holder, only the holder can unlock or extend the lock.
+	Token() string
+	Unlock() error
+	// Extend resets the TTL of the lock to ttl from now.
+	Extend(ttl time.Duration) error
+}
+
+// NewLockToken returns a random token identifying a lock holder.
+func NewLockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type localLockEntry struct {
+	token     string
+	expiresAt time.Time
+}
+
+// LocalLocks is an in-process table of expiring locks, used by levels that
+// have no shared parent to lock through.
+type LocalLocks struct {
+	mu    sync.Mutex
+	locks map[string]*localLockEntry
+	// pruneAt is the number of entries from which Lock drops the expired ones.
+	pruneAt int
+}
+
+func NewLocalLocks() *LocalLocks {
+	return &LocalLocks{locks: make(map[string]*localLockEntry), pruneAt: minLocalLocksPrune}
+}
+
+// Lock obtains the lock on key for ttl, or fails with ErrLockNotObtained when it is held.
+func (l *LocalLocks) Lock(key string, ttl time.Duration) (ILock, error) {
+	if ttl <= 0 {
+		return nil, ErrInvalidLockTTL
+	}
+	token, err := NewLockToken()
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if e, has := l.locks[key]; has && now.Before(e.expiresAt) {
+		return nil, ErrLockNotObtained
+	}
+	l.locks[key] = &localLockEntry{token: token, expiresAt: now.Add(ttl)}
+	if len(l.locks) >= l.pruneAt {
+		l.prune(now)
+	}
+	return &localLock{table: l, key: key, token: token}, nil
+}
+
+// prune drops the expired entries, then waits for the table to double before
+// pruning again, so that the cost of a prune is spread over the locks taken
+// meanwhile. The caller must hold l.mu.
+func (l *LocalLocks) prune(now time.Time) {
+	for key, e := range l.locks {
+		if !now.Before(e.expiresAt) {
+			delete(l.locks, key)
+		}
+	}
+	if l.pruneAt = 2 * len(l.locks); l.pruneAt < minLocalLocksPrune {
+		l.pruneAt = minLocalLocksPrune
+	}
+}
+
+// held returns the entry of key when it is still held with token. The caller must hold l.mu.
+func (l *LocalLocks) held(key, token string) (*localLockEntry, bool) {
+	e, has := l.locks[key]
+	if !has || e.token != token || !time.Now().Before(e.expiresAt) {
+		return nil, false
+	}
+	return e, true
+}
+
+type localLock struct {
+	table *LocalLocks
+	key   string
+	token string
+}
+
+func (l *localLock) Key() string {
+	return l.key
+}
+
+func (l *localLock) Token() string {
+	return l.token
+}
+
+func (l *localLock) Unlock() error {
+	l.table.mu.Lock()
+	defer l.table.mu.Unlock()
+	if _, has := l.table.held(l.key, l.token); !has {
+		return ErrLockNotHeld
+	}
+	delete(l.table.locks, l.key)
+	return nil
+}
+
+func (l *localLock) Extend(ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidLockTTL
+	}
+	l.table.mu.Lock()
+	defer l.table.mu.Unlock()
+	e, has := l.table.held(l.key, l.token)
+	if !has {
+		return ErrLockNotHeld
+	}
+	e.expiresAt = time.Now().Add(ttl)
+	return nil
+}
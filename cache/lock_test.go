@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLocalLocks(t *testing.T) {
+	locks := NewLocalLocks()
+
+	l, err := locks.Lock("job", time.Minute)
+	assert.Nil(t, err)
+	_, err = locks.Lock("job", time.Minute)
+	assert.Equal(t, ErrLockNotObtained, err)
+
+	assert.Nil(t, l.Extend(time.Minute))
+	assert.Nil(t, l.Unlock())
+	assert.Equal(t, ErrLockNotHeld, l.Unlock())
+
+	l, err = locks.Lock("job", 10*time.Millisecond)
+	assert.Nil(t, err)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, ErrLockNotHeld, l.Extend(time.Minute))
+
+	other, err := locks.Lock("job", time.Minute)
+	assert.Nil(t, err)
+	assert.NotEqual(t, l.Token(), other.Token())
+	assert.Equal(t, ErrLockNotHeld, l.Unlock())
+	assert.Equal(t, ErrInvalidLockTTL, other.Extend(0))
+	assert.Nil(t, other.Unlock())
+
+	_, err = locks.Lock("job", 0)
+	assert.Equal(t, ErrInvalidLockTTL, err)
+	_, err = locks.Lock("job", -time.Second)
+	assert.Equal(t, ErrInvalidLockTTL, err)
+}
+
+func TestLocalLocks_Prune(t *testing.T) {
+	locks := NewLocalLocks()
+	for i := 0; i < 1000; i++ {
+		_, err := locks.Lock(strconv.Itoa(i), time.Millisecond)
+		assert.Nil(t, err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	// the table reaches the size it is pruned at again before this loop ends
+	locks.mu.Lock()
+	held := locks.pruneAt
+	locks.mu.Unlock()
+	for i := 0; i < held; i++ {
+		_, err := locks.Lock("held:"+strconv.Itoa(i), time.Minute)
+		assert.Nil(t, err)
+	}
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	assert.True(t, len(locks.locks) <= held, "%d locks left", len(locks.locks))
+}
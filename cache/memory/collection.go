@@ -0,0 +1,326 @@
+package memory
+
+import (
+	"github.com/motclub/common/cache"
+	"time"
+)
+
+// collection returns the collection of type typ stored at key, an empty one when there is none.
+func (m *memoryCache) collection(key, typ string) (*cache.Collection, error) {
+	v, has := m.hasGet(key)
+	if !has {
+		return cache.NewCollection(typ), nil
+	}
+	return cache.DecodeCollection(v.codec, v.data, typ)
+}
+
+// modify applies fn to the collection of type typ stored at key, keeping its
+// expiration, and deletes key once the collection is empty.
+func (m *memoryCache) modify(key, typ string, fn func(c *cache.Collection)) error {
+	defer m.stats.Observe(cache.OpSet, time.Now())
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	c := cache.NewCollection(typ)
+	v, has := m.store.get(key)
+	if has {
+		var err error
+		if c, err = cache.DecodeCollection(v.codec, v.data, typ); err != nil {
+			return err
+		}
+	}
+	fn(c)
+	if c.Len() == 0 {
+		if has {
+			m.store.remove(v)
+			m.stats.Delete(1)
+			m.store.events.Emit(cache.EventDel, key)
+		}
+		return nil
+	}
+	data, err := cache.EncodeCollection(c)
+	if err != nil {
+		return err
+	}
+	nv := &memoryCacheValue{key: key, data: data, codec: cache.CodecCollection, createdAt: time.Now()}
+	if has {
+		nv.createdAt = v.createdAt
+		nv.expiredDuration = v.expiredDuration
+	}
+	m.store.put(nv)
+	m.stats.Set(1)
+	m.store.events.Emit(cache.EventSet, key)
+	return nil
+}
+
+func (m *memoryCache) HSet(key string, values map[string]interface{}) (int, error) {
+	if m.parent != nil {
+		return m.parent.HSet(key, values)
+	}
+
+	fields, err := cache.FormatFields(values)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = m.modify(key, cache.TypeHash, func(c *cache.Collection) {
+		n = c.HSet(fields)
+	})
+	return n, err
+}
+
+func (m *memoryCache) HGet(key, field string) (string, bool, error) {
+	if m.parent != nil {
+		return m.parent.HGet(key, field)
+	}
+
+	c, err := m.collection(key, cache.TypeHash)
+	if err != nil {
+		return "", false, err
+	}
+	v, has := c.HGet(field)
+	return v, has, nil
+}
+
+func (m *memoryCache) HGetAll(key string) (map[string]string, error) {
+	if m.parent != nil {
+		return m.parent.HGetAll(key)
+	}
+
+	c, err := m.collection(key, cache.TypeHash)
+	if err != nil {
+		return nil, err
+	}
+	return c.HGetAll(), nil
+}
+
+func (m *memoryCache) HDel(key string, fields ...string) (int, error) {
+	if m.parent != nil {
+		return m.parent.HDel(key, fields...)
+	}
+
+	var n int
+	err := m.modify(key, cache.TypeHash, func(c *cache.Collection) {
+		n = c.HDel(fields...)
+	})
+	return n, err
+}
+
+func (m *memoryCache) LPush(key string, values ...interface{}) (int, error) {
+	if m.parent != nil {
+		return m.parent.LPush(key, values...)
+	}
+
+	members, err := cache.FormatArgs(values)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = m.modify(key, cache.TypeList, func(c *cache.Collection) {
+		n = c.LPush(members...)
+	})
+	return n, err
+}
+
+func (m *memoryCache) RPush(key string, values ...interface{}) (int, error) {
+	if m.parent != nil {
+		return m.parent.RPush(key, values...)
+	}
+
+	members, err := cache.FormatArgs(values)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = m.modify(key, cache.TypeList, func(c *cache.Collection) {
+		n = c.RPush(members...)
+	})
+	return n, err
+}
+
+func (m *memoryCache) LPop(key string) (string, bool, error) {
+	if m.parent != nil {
+		return m.parent.LPop(key)
+	}
+
+	var (
+		v   string
+		has bool
+	)
+	err := m.modify(key, cache.TypeList, func(c *cache.Collection) {
+		v, has = c.LPop()
+	})
+	return v, has, err
+}
+
+func (m *memoryCache) RPop(key string) (string, bool, error) {
+	if m.parent != nil {
+		return m.parent.RPop(key)
+	}
+
+	var (
+		v   string
+		has bool
+	)
+	err := m.modify(key, cache.TypeList, func(c *cache.Collection) {
+		v, has = c.RPop()
+	})
+	return v, has, err
+}
+
+func (m *memoryCache) LRange(key string, start, stop int) ([]string, error) {
+	if m.parent != nil {
+		return m.parent.LRange(key, start, stop)
+	}
+
+	c, err := m.collection(key, cache.TypeList)
+	if err != nil {
+		return nil, err
+	}
+	return c.LRange(start, stop), nil
+}
+
+func (m *memoryCache) SAdd(key string, members ...interface{}) (int, error) {
+	if m.parent != nil {
+		return m.parent.SAdd(key, members...)
+	}
+
+	v, err := cache.FormatArgs(members)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = m.modify(key, cache.TypeSet, func(c *cache.Collection) {
+		n = c.SAdd(v...)
+	})
+	return n, err
+}
+
+func (m *memoryCache) SRem(key string, members ...interface{}) (int, error) {
+	if m.parent != nil {
+		return m.parent.SRem(key, members...)
+	}
+
+	v, err := cache.FormatArgs(members)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = m.modify(key, cache.TypeSet, func(c *cache.Collection) {
+		n = c.SRem(v...)
+	})
+	return n, err
+}
+
+func (m *memoryCache) SIsMember(key string, member interface{}) (bool, error) {
+	if m.parent != nil {
+		return m.parent.SIsMember(key, member)
+	}
+
+	v, err := cache.FormatArg(member)
+	if err != nil {
+		return false, err
+	}
+	c, err := m.collection(key, cache.TypeSet)
+	if err != nil {
+		return false, err
+	}
+	return c.SIsMember(v), nil
+}
+
+func (m *memoryCache) SMembers(key string) ([]string, error) {
+	if m.parent != nil {
+		return m.parent.SMembers(key)
+	}
+
+	c, err := m.collection(key, cache.TypeSet)
+	if err != nil {
+		return nil, err
+	}
+	return c.SMembers(), nil
+}
+
+func (m *memoryCache) ZAdd(key string, members ...cache.Z) (int, error) {
+	if m.parent != nil {
+		return m.parent.ZAdd(key, members...)
+	}
+
+	var n int
+	err := m.modify(key, cache.TypeZSet, func(c *cache.Collection) {
+		n = c.ZAdd(members...)
+	})
+	return n, err
+}
+
+func (m *memoryCache) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	if m.parent != nil {
+		return m.parent.ZIncrBy(key, increment, member)
+	}
+
+	var v float64
+	err := m.modify(key, cache.TypeZSet, func(c *cache.Collection) {
+		v = c.ZIncrBy(increment, member)
+	})
+	return v, err
+}
+
+func (m *memoryCache) ZRem(key string, members ...string) (int, error) {
+	if m.parent != nil {
+		return m.parent.ZRem(key, members...)
+	}
+
+	var n int
+	err := m.modify(key, cache.TypeZSet, func(c *cache.Collection) {
+		n = c.ZRem(members...)
+	})
+	return n, err
+}
+
+func (m *memoryCache) ZScore(key, member string) (float64, bool, error) {
+	if m.parent != nil {
+		return m.parent.ZScore(key, member)
+	}
+
+	c, err := m.collection(key, cache.TypeZSet)
+	if err != nil {
+		return 0, false, err
+	}
+	v, has := c.ZScore(member)
+	return v, has, nil
+}
+
+func (m *memoryCache) ZRange(key string, start, stop int) ([]cache.Z, error) {
+	if m.parent != nil {
+		return m.parent.ZRange(key, start, stop)
+	}
+
+	c, err := m.collection(key, cache.TypeZSet)
+	if err != nil {
+		return nil, err
+	}
+	return c.ZRange(start, stop), nil
+}
+
+func (m *memoryCache) ZRevRange(key string, start, stop int) ([]cache.Z, error) {
+	if m.parent != nil {
+		return m.parent.ZRevRange(key, start, stop)
+	}
+
+	c, err := m.collection(key, cache.TypeZSet)
+	if err != nil {
+		return nil, err
+	}
+	return c.ZRevRange(start, stop), nil
+}
+
+func (m *memoryCache) ZRangeByScore(key string, min, max float64) ([]cache.Z, error) {
+	if m.parent != nil {
+		return m.parent.ZRangeByScore(key, min, max)
+	}
+
+	c, err := m.collection(key, cache.TypeZSet)
+	if err != nil {
+		return nil, err
+	}
+	return c.ZRangeByScore(min, max), nil
+}
@@ -0,0 +1,158 @@
+package memory
+
+import (
+	"github.com/motclub/common/cache"
+	"time"
+)
+
+// swap stores value at key when cond, given the current entry of key, holds.
+func (m *memoryCache) swap(key string, value interface{}, expiration time.Duration, cond func(v *memoryCacheValue, has bool) (bool, error)) (bool, error) {
+	defer m.stats.Observe(cache.OpSet, time.Now())
+	nv, err := newValue(key, value, expiration)
+	if err != nil {
+		return false, err
+	}
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	v, has := m.store.get(key)
+	if ok, err := cond(v, has); err != nil || !ok {
+		return false, err
+	}
+	m.store.put(nv)
+	m.stats.Set(1)
+	m.store.events.Emit(cache.EventSet, key)
+	return true, nil
+}
+
+// retime applies fn to the entry of key, deleting the entry when fn returns
+// false, and reports whether key exists. The change emits event.
+func (m *memoryCache) retime(key, event string, fn func(v *memoryCacheValue) bool) bool {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	v, has := m.store.get(key)
+	switch {
+	case !has:
+	case fn(v):
+		m.store.events.Emit(event, key)
+	default:
+		m.store.remove(v)
+		m.stats.Delete(1)
+		m.store.events.Emit(cache.EventDel, key)
+	}
+	return has
+}
+
+func (m *memoryCache) SetNX(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	var exp time.Duration
+	if len(expiration) > 0 {
+		exp = expiration[0]
+	}
+	if m.parent != nil {
+		ok, err := m.parent.SetNX(key, value, expiration...)
+		if ok && err == nil {
+			err = m.set(key, value, exp)
+		}
+		return ok, err
+	}
+
+	return m.swap(key, value, exp, func(_ *memoryCacheValue, has bool) (bool, error) {
+		return !has, nil
+	})
+}
+
+func (m *memoryCache) SetXX(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	var exp time.Duration
+	if len(expiration) > 0 {
+		exp = expiration[0]
+	}
+	if m.parent != nil {
+		ok, err := m.parent.SetXX(key, value, expiration...)
+		if ok && err == nil {
+			err = m.set(key, value, exp)
+		}
+		return ok, err
+	}
+
+	return m.swap(key, value, exp, func(_ *memoryCacheValue, has bool) (bool, error) {
+		return has, nil
+	})
+}
+
+func (m *memoryCache) GetSet(key string, value interface{}, dst interface{}) (bool, error) {
+	if m.parent != nil {
+		has, err := m.parent.GetSet(key, value, dst)
+		if err == nil {
+			err = m.set(key, value, 0)
+		}
+		return has, err
+	}
+
+	var old *memoryCacheValue
+	_, err := m.swap(key, value, 0, func(v *memoryCacheValue, _ bool) (bool, error) {
+		old = v
+		return true, nil
+	})
+	if err != nil || old == nil {
+		return false, err
+	}
+	return true, cache.Unmarshal(old.codec, old.data, dst)
+}
+
+func (m *memoryCache) CompareAndSwap(key string, old, value interface{}, expiration ...time.Duration) (bool, error) {
+	var exp time.Duration
+	if len(expiration) > 0 {
+		exp = expiration[0]
+	}
+	if m.parent != nil {
+		ok, err := m.parent.CompareAndSwap(key, old, value, expiration...)
+		if ok && err == nil {
+			err = m.set(key, value, exp)
+		}
+		return ok, err
+	}
+
+	return m.swap(key, value, exp, func(v *memoryCacheValue, has bool) (bool, error) {
+		if !has {
+			return false, nil
+		}
+		return (&cache.Envelope{Codec: v.codec, Data: v.data}).Equal(old)
+	})
+}
+
+func (m *memoryCache) Expire(key string, ttl time.Duration) (bool, error) {
+	has := m.retime(key, cache.EventExpire, func(v *memoryCacheValue) bool {
+		v.createdAt = time.Now()
+		v.expiredDuration = ttl
+		return ttl > 0
+	})
+	if m.parent != nil {
+		return m.parent.Expire(key, ttl)
+	}
+	return has, nil
+}
+
+func (m *memoryCache) ExpireAt(key string, at time.Time) (bool, error) {
+	return m.Expire(key, time.Until(at))
+}
+
+func (m *memoryCache) Persist(key string) (bool, error) {
+	has := m.retime(key, cache.EventPersist, func(v *memoryCacheValue) bool {
+		v.expiredDuration = 0
+		return true
+	})
+	if m.parent != nil {
+		return m.parent.Persist(key)
+	}
+	return has, nil
+}
+
+func (m *memoryCache) Touch(key string) (bool, error) {
+	has := m.retime(key, cache.EventExpire, func(v *memoryCacheValue) bool {
+		v.createdAt = time.Now()
+		return true
+	})
+	if m.parent != nil {
+		return m.parent.Touch(key)
+	}
+	return has, nil
+}
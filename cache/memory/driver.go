@@ -0,0 +1,30 @@
+package memory
+
+import (
+	"github.com/motclub/common/cache"
+	"net/url"
+)
+
+func init() {
+	cache.Register("memory", Open)
+}
+
+// Open opens a memory cache from a URI such as
+// "memory://?size=10000&max_bytes=67108864&eviction=lfu&sweep_interval=1s",
+// where size is an alias of max_entries.
+func Open(u *url.URL) (cache.ICache, error) {
+	q := cache.NewURIOptions(u)
+	o := &Options{
+		MaxEntries:    q.Int("max_entries"),
+		MaxBytes:      q.Int64("max_bytes"),
+		Eviction:      q.String("eviction"),
+		SweepInterval: q.Duration("sweep_interval"),
+	}
+	if q.Has("size") {
+		o.MaxEntries = q.Int("size")
+	}
+	if err := q.Err(); err != nil {
+		return nil, err
+	}
+	return NewMemoryCache(o)
+}
@@ -0,0 +1,885 @@
+package memory
+
+import (
+	"context"
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/json"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrCacheUnsupportedEviction = errors.New(`mot: unsupported eviction policy`)
+	ErrCacheNotInteger          = errors.New(`mot: value is not an integer or out of range`)
+	ErrCacheNotFloat            = errors.New(`mot: value is not a valid float`)
+)
+
+type Options struct {
+	MaxEntries int    `json:"max_entries"`
+	MaxBytes   int64  `json:"max_bytes"`
+	Eviction   string `json:"eviction"`
+	// SweepInterval is how often expired entries are removed in the background,
+	// 0 removes them as they are read until expirations are subscribed to.
+	SweepInterval time.Duration `json:"sweep_interval"`
+}
+
+func NewMemoryCache(options ...*Options) (cache.ICache, error) {
+	o := resolveOptions(options)
+	switch o.Eviction {
+	case "":
+		o.Eviction = EvictionLRU
+	case EvictionLRU, EvictionLFU:
+	default:
+		return nil, ErrCacheUnsupportedEviction
+	}
+	stats := cache.NewStatsRecorder("memory")
+	m := &memoryCache{
+		store:         newStore(o, stats),
+		broker:        cache.NewBroker(),
+		stats:         stats,
+		locks:         cache.NewLocalLocks(),
+		sweeper:       new(cache.Sweeper),
+		sweepInterval: o.SweepInterval,
+	}
+	if o.SweepInterval > 0 {
+		m.startSweeper()
+	}
+	return m, nil
+}
+
+// startSweeper starts sweeping at the sweep interval, or at the default one when there is none.
+func (m *memoryCache) startSweeper() {
+	interval := m.sweepInterval
+	if interval <= 0 {
+		interval = cache.DefaultSweepInterval
+	}
+	store := m.store
+	m.sweeper.Start(interval, func() {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		store.sweep(time.Now())
+	})
+}
+
+func resolveOptions(options []*Options) *Options {
+	var o Options
+	if len(options) > 0 && options[0] != nil {
+		o = *options[0]
+	}
+	return &o
+}
+
+type memoryCache struct {
+	store   *store
+	broker  *cache.Broker
+	locks   *cache.LocalLocks
+	stats   *cache.StatsRecorder
+	sweeper *cache.Sweeper
+	// sweepInterval is the interval of the sweeper, the default one when 0.
+	sweepInterval time.Duration
+	parent        cache.ICache
+	children      cache.ICache
+}
+
+func (m *memoryCache) WithContext(ctx context.Context) cache.ICache {
+	c := *m
+	if m.parent != nil {
+		c.parent = m.parent.WithContext(ctx)
+	}
+	return &c
+}
+
+func (m *memoryCache) OnExpire(pattern string, handler func(key string)) error {
+	if m.parent != nil {
+		return m.parent.OnExpire(pattern, handler)
+	}
+	m.store.events.OnExpire(pattern, handler)
+	m.startSweeper()
+	return nil
+}
+
+func (m *memoryCache) OnChange(pattern string, handler func(key, event string)) error {
+	if m.parent != nil {
+		return m.parent.OnChange(pattern, handler)
+	}
+	m.store.events.OnChange(pattern, handler)
+	m.startSweeper()
+	return nil
+}
+
+func (m *memoryCache) Publish(channel string, message interface{}) error {
+	if m.parent != nil {
+		return m.parent.Publish(channel, message)
+	}
+	return m.broker.Publish(channel, message)
+}
+
+func (m *memoryCache) Subscribe(channels []string, handler func(string, string), options ...*cache.SubscribeOptions) (cache.ISubscription, error) {
+	if m.parent != nil {
+		return m.parent.Subscribe(channels, handler, options...)
+	}
+	return m.broker.Subscribe(channels, handler, options...), nil
+}
+
+func (m *memoryCache) PSubscribe(patterns []string, handler func(string, string), options ...*cache.SubscribeOptions) (cache.ISubscription, error) {
+	if m.parent != nil {
+		return m.parent.PSubscribe(patterns, handler, options...)
+	}
+	return m.broker.PSubscribe(patterns, handler, options...), nil
+}
+
+func (m *memoryCache) Stats() cache.Stats {
+	m.store.mu.Lock()
+	m.stats.Size(int64(len(m.store.values)), m.store.bytes)
+	m.store.mu.Unlock()
+	return m.stats.Stats()
+}
+
+func (m *memoryCache) hasGet(key string) (*memoryCacheValue, bool) {
+	defer m.stats.Observe(cache.OpGet, time.Now())
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	v, has := m.store.get(key)
+	if !has {
+		m.stats.Miss()
+		return nil, false
+	}
+	m.stats.Hit()
+	return v, true
+}
+
+func (m *memoryCache) set(key string, value interface{}, expiration time.Duration, tags ...string) error {
+	defer m.stats.Observe(cache.OpSet, time.Now())
+	v, err := newValue(key, value, expiration)
+	if err != nil {
+		return err
+	}
+	v.tags = tags
+	m.stats.Set(1)
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	m.store.put(v)
+	m.store.events.Emit(cache.EventSet, key)
+	return nil
+}
+
+// newValue encodes value into a new entry of key.
+func newValue(key string, value interface{}, expiration time.Duration) (*memoryCacheValue, error) {
+	data, err := json.STD().Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryCacheValue{
+		key:             key,
+		data:            data,
+		expiredDuration: expiration,
+		createdAt:       time.Now(),
+	}, nil
+}
+
+func (m *memoryCache) TTL(key string) (time.Duration, bool) {
+	m.store.mu.Lock()
+	var ttl time.Duration
+	v, has := m.store.get(key)
+	if has {
+		ttl = v.remaining(time.Now())
+	}
+	m.store.mu.Unlock()
+	if !has && m.parent != nil {
+		return m.parent.TTL(key)
+	}
+	return ttl, has
+}
+
+func (m *memoryCache) Has(key string) bool {
+	_, has := m.hasGet(key)
+	if !has && m.parent != nil {
+		m.stats.Fallthrough()
+		has = m.parent.Has(key)
+	}
+	return has
+}
+
+func (m *memoryCache) HasGet(key string, dst interface{}) bool {
+	v, has := m.hasGet(key)
+	if has {
+		_ = cache.Unmarshal(v.codec, v.data, dst)
+	} else if m.parent != nil {
+		m.stats.Fallthrough()
+		if has = m.parent.HasGet(key, dst); has {
+			ttl, _ := m.parent.TTL(key)
+			_ = m.set(key, dst, ttl)
+		}
+	}
+	return has
+}
+
+func (m *memoryCache) HasGetInt(key string) (int, bool) {
+	var v int
+	has := m.HasGet(key, &v)
+	return v, has
+}
+
+func (m *memoryCache) HasGetFloat(key string) (float64, bool) {
+	var v float64
+	has := m.HasGet(key, &v)
+	return v, has
+}
+
+func (m *memoryCache) HasGetString(key string) (string, bool) {
+	var v string
+	has := m.HasGet(key, &v)
+	return v, has
+}
+
+func (m *memoryCache) HasGetBool(key string) (bool, bool) {
+	var v bool
+	has := m.HasGet(key, &v)
+	return v, has
+}
+
+func (m *memoryCache) HasGetTime(key string) (time.Time, bool) {
+	var v time.Time
+	has := m.HasGet(key, &v)
+	return v, has
+}
+
+func (m *memoryCache) HasGetInt8(key string) (int8, bool) {
+	v, has := m.HasGetInt(key)
+	return int8(v), has
+}
+
+func (m *memoryCache) HasGetInt16(key string) (int16, bool) {
+	v, has := m.HasGetInt(key)
+	return int16(v), has
+}
+
+func (m *memoryCache) HasGetInt32(key string) (int32, bool) {
+	v, has := m.HasGetInt(key)
+	return int32(v), has
+}
+
+func (m *memoryCache) HasGetInt64(key string) (int64, bool) {
+	v, has := m.HasGetInt(key)
+	return int64(v), has
+}
+
+func (m *memoryCache) HasGetUint(key string) (uint, bool) {
+	v, has := m.HasGetInt(key)
+	return uint(v), has
+}
+
+func (m *memoryCache) HasGetUint8(key string) (uint8, bool) {
+	v, has := m.HasGetInt(key)
+	return uint8(v), has
+}
+
+func (m *memoryCache) HasGetUint16(key string) (uint16, bool) {
+	v, has := m.HasGetInt(key)
+	return uint16(v), has
+}
+
+func (m *memoryCache) HasGetUint32(key string) (uint32, bool) {
+	v, has := m.HasGetInt(key)
+	return uint32(v), has
+}
+
+func (m *memoryCache) HasGetUint64(key string) (uint64, bool) {
+	v, has := m.HasGetInt(key)
+	return uint64(v), has
+}
+
+func (m *memoryCache) HasGetFloat32(key string) (float32, bool) {
+	v, has := m.HasGetFloat(key)
+	return float32(v), has
+}
+
+func (m *memoryCache) HasGetFloat64(key string) (float64, bool) {
+	return m.HasGetFloat(key)
+}
+
+func (m *memoryCache) Get(key string, dst interface{}) {
+	_ = m.HasGet(key, dst)
+}
+
+func (m *memoryCache) GetInt(key string) int {
+	v, _ := m.HasGetInt(key)
+	return v
+}
+
+func (m *memoryCache) GetInt8(key string) int8 {
+	v, _ := m.HasGetInt8(key)
+	return v
+}
+
+func (m *memoryCache) GetInt16(key string) int16 {
+	v, _ := m.HasGetInt16(key)
+	return v
+}
+
+func (m *memoryCache) GetInt32(key string) int32 {
+	v, _ := m.HasGetInt32(key)
+	return v
+}
+
+func (m *memoryCache) GetInt64(key string) int64 {
+	v, _ := m.HasGetInt64(key)
+	return v
+}
+
+func (m *memoryCache) GetUint(key string) uint {
+	v, _ := m.HasGetUint(key)
+	return v
+}
+
+func (m *memoryCache) GetUint8(key string) uint8 {
+	v, _ := m.HasGetUint8(key)
+	return v
+}
+
+func (m *memoryCache) GetUint16(key string) uint16 {
+	v, _ := m.HasGetUint16(key)
+	return v
+}
+
+func (m *memoryCache) GetUint32(key string) uint32 {
+	v, _ := m.HasGetUint32(key)
+	return v
+}
+
+func (m *memoryCache) GetUint64(key string) uint64 {
+	v, _ := m.HasGetUint64(key)
+	return v
+}
+
+func (m *memoryCache) GetFloat(key string) float64 {
+	v, _ := m.HasGetFloat(key)
+	return v
+}
+
+func (m *memoryCache) GetFloat32(key string) float32 {
+	v, _ := m.HasGetFloat32(key)
+	return v
+}
+
+func (m *memoryCache) GetFloat64(key string) float64 {
+	v, _ := m.HasGetFloat64(key)
+	return v
+}
+
+func (m *memoryCache) GetString(key string) string {
+	v, _ := m.HasGetString(key)
+	return v
+}
+
+func (m *memoryCache) GetBool(key string) bool {
+	v, _ := m.HasGetBool(key)
+	return v
+}
+
+func (m *memoryCache) GetTime(key string) time.Time {
+	v, _ := m.HasGetTime(key)
+	return v
+}
+
+func (m *memoryCache) DefaultGet(key string, dst interface{}, defaultValue interface{}) {
+	if !m.HasGet(key, dst) {
+		_ = json.Copy(defaultValue, dst)
+	}
+}
+
+func (m *memoryCache) DefaultGetInt(key string, defaultValue int) int {
+	if v, has := m.HasGetInt(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (m *memoryCache) DefaultGetInt8(key string, defaultValue int8) int8 {
+	if v, has := m.HasGetInt8(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (m *memoryCache) DefaultGetInt16(key string, defaultValue int16) int16 {
+	if v, has := m.HasGetInt16(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (m *memoryCache) DefaultGetInt32(key string, defaultValue int32) int32 {
+	if v, has := m.HasGetInt32(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (m *memoryCache) DefaultGetInt64(key string, defaultValue int64) int64 {
+	if v, has := m.HasGetInt64(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (m *memoryCache) DefaultGetUint(key string, defaultValue uint) uint {
+	if v, has := m.HasGetUint(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (m *memoryCache) DefaultGetUint8(key string, defaultValue uint8) uint8 {
+	if v, has := m.HasGetUint8(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (m *memoryCache) DefaultGetUint16(key string, defaultValue uint16) uint16 {
+	if v, has := m.HasGetUint16(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (m *memoryCache) DefaultGetUint32(key string, defaultValue uint32) uint32 {
+	if v, has := m.HasGetUint32(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (m *memoryCache) DefaultGetUint64(key string, defaultValue uint64) uint64 {
+	if v, has := m.HasGetUint64(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (m *memoryCache) DefaultGetFloat(key string, defaultValue float64) float64 {
+	if v, has := m.HasGetFloat(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (m *memoryCache) DefaultGetFloat32(key string, defaultValue float32) float32 {
+	if v, has := m.HasGetFloat32(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (m *memoryCache) DefaultGetFloat64(key string, defaultValue float64) float64 {
+	if v, has := m.HasGetFloat64(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (m *memoryCache) DefaultGetString(key string, defaultValue string) string {
+	if v, has := m.HasGetString(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (m *memoryCache) DefaultGetBool(key string, defaultValue bool) bool {
+	if v, has := m.HasGetBool(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (m *memoryCache) DefaultGetTime(key string, defaultValue time.Time) time.Time {
+	if v, has := m.HasGetTime(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (m *memoryCache) Set(key string, value interface{}, expiration ...time.Duration) error {
+	var exp time.Duration
+	if len(expiration) > 0 {
+		exp = expiration[0]
+	}
+	err := m.set(key, value, exp)
+	if err == nil && m.parent != nil {
+		err = m.parent.Set(key, value, expiration...)
+	}
+	return err
+}
+
+func (m *memoryCache) SetWithTags(key string, value interface{}, tags []string, expiration ...time.Duration) error {
+	var exp time.Duration
+	if len(expiration) > 0 {
+		exp = expiration[0]
+	}
+	err := m.set(key, value, exp, tags...)
+	if err == nil && m.parent != nil {
+		err = m.parent.SetWithTags(key, value, tags, expiration...)
+	}
+	return err
+}
+
+func (m *memoryCache) InvalidateTags(tags ...string) error {
+	start := time.Now()
+	m.store.mu.Lock()
+	keys := m.store.invalidate(tags)
+	m.store.mu.Unlock()
+	m.stats.Delete(len(keys))
+	m.store.events.Emit(cache.EventDel, keys...)
+	m.stats.Observe(cache.OpDel, start)
+
+	if m.parent != nil {
+		return m.parent.InvalidateTags(tags...)
+	}
+	return nil
+}
+
+func (m *memoryCache) MGet(keys ...string) (map[string]*cache.Item, error) {
+	start := time.Now()
+	items := make(map[string]*cache.Item, len(keys))
+	var missing []string
+	m.store.mu.Lock()
+	for _, key := range keys {
+		if v, has := m.store.get(key); has && v.codec == cache.CodecCollection {
+			// collections are not values
+			continue
+		} else if has {
+			m.stats.Hit()
+			items[key] = &cache.Item{Key: key, Value: v.data, Codec: v.codec, TTL: v.remaining(start)}
+		} else {
+			m.stats.Miss()
+			missing = append(missing, key)
+		}
+	}
+	m.store.mu.Unlock()
+	m.stats.Observe(cache.OpGet, start)
+	if len(missing) == 0 || m.parent == nil {
+		return items, nil
+	}
+
+	m.stats.Fallthrough()
+	found, err := m.parent.MGet(missing...)
+	if err != nil {
+		return items, err
+	}
+	backfill := make([]*cache.Item, 0, len(found))
+	for key, item := range found {
+		items[key] = item
+		backfill = append(backfill, item)
+	}
+	m.setItems(backfill)
+	return items, nil
+}
+
+func (m *memoryCache) SetItems(items ...*cache.Item) error {
+	m.setItems(items)
+	if m.parent != nil {
+		return cache.SetItems(m.parent, items...)
+	}
+	return nil
+}
+
+// setItems stores items in this level as they are.
+func (m *memoryCache) setItems(items []*cache.Item) {
+	defer m.stats.Observe(cache.OpSet, time.Now())
+	now := time.Now()
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	for _, item := range items {
+		m.store.put(&memoryCacheValue{
+			key:             item.Key,
+			data:            item.Value,
+			codec:           item.Codec,
+			expiredDuration: item.TTL,
+			createdAt:       now,
+		})
+		m.store.events.Emit(cache.EventSet, item.Key)
+	}
+	m.stats.Set(len(items))
+}
+
+func (m *memoryCache) MSet(values map[string]interface{}, expiration ...time.Duration) error {
+	var exp time.Duration
+	if len(expiration) > 0 {
+		exp = expiration[0]
+	}
+	err := m.mset(values, exp)
+	if err == nil && m.parent != nil {
+		err = m.parent.MSet(values, expiration...)
+	}
+	return err
+}
+
+func (m *memoryCache) mset(values map[string]interface{}, expiration time.Duration) error {
+	defer m.stats.Observe(cache.OpSet, time.Now())
+	now := time.Now()
+	entries := make([]*memoryCacheValue, 0, len(values))
+	for key, value := range values {
+		data, err := json.STD().Marshal(value)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &memoryCacheValue{
+			key:             key,
+			data:            data,
+			expiredDuration: expiration,
+			createdAt:       now,
+		})
+	}
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	for _, v := range entries {
+		m.store.put(v)
+		m.store.events.Emit(cache.EventSet, v.key)
+	}
+	m.stats.Set(len(entries))
+	return nil
+}
+
+func (m *memoryCache) GetOrLoad(key string, dst interface{}, ttl time.Duration, loader cache.LoaderFunc) error {
+	return cache.GetOrLoad(m, key, dst, ttl, loader)
+}
+
+func (m *memoryCache) HasPrefix(s string, limit ...int) (map[string]string, error) {
+	v := m.filter(func(key string) bool {
+		return strings.HasPrefix(key, s)
+	}, limit...)
+
+	if len(v) == 0 && m.parent != nil {
+		return m.parent.HasPrefix(s, limit...)
+	}
+
+	return v, nil
+}
+
+func (m *memoryCache) HasSuffix(s string, limit ...int) (map[string]string, error) {
+	v := m.filter(func(key string) bool {
+		return strings.HasSuffix(key, s)
+	}, limit...)
+
+	if len(v) == 0 && m.parent != nil {
+		return m.parent.HasSuffix(s, limit...)
+	}
+
+	return v, nil
+}
+
+func (m *memoryCache) Contains(s string, limit ...int) (map[string]string, error) {
+	v := m.filter(func(key string) bool {
+		return strings.Contains(key, s)
+	}, limit...)
+
+	if len(v) == 0 && m.parent != nil {
+		return m.parent.Contains(s, limit...)
+	}
+
+	return v, nil
+}
+
+func (m *memoryCache) Scan(prefix, cursor string, limit int) ([]*cache.Item, string, error) {
+	if m.parent != nil {
+		return m.parent.Scan(prefix, cursor, limit)
+	}
+	if cursor != "" && !strings.HasPrefix(cursor, prefix) {
+		return nil, "", cache.ErrInvalidCursor
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	now := time.Now()
+	var keys []string
+	for key, cv := range m.store.values {
+		if key > cursor && strings.HasPrefix(key, prefix) && !cv.expired(now) && cv.codec != cache.CodecCollection {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		cursor = keys[limit-1]
+	} else {
+		cursor = ""
+	}
+	items := make([]*cache.Item, len(keys))
+	for i, key := range keys {
+		cv := m.store.values[key]
+		items[i] = &cache.Item{Key: key, Value: cv.data, Codec: cv.codec, TTL: cv.remaining(now)}
+	}
+	return items, cursor, nil
+}
+
+func (m *memoryCache) filter(filter func(key string) bool, limit ...int) map[string]string {
+	var max int
+	if len(limit) > 0 {
+		max = limit[0]
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	now := time.Now()
+	v := make(map[string]string)
+	for key, cv := range m.store.values {
+		if cv.expired(now) || cv.codec == cache.CodecCollection || !filter(key) {
+			continue
+		}
+		v[key] = cache.DataString(cv.codec, cv.data)
+		if max > 0 && len(v) >= max {
+			break
+		}
+	}
+	return v
+}
+
+// update atomically replaces the value of key with the result of fn, keeping its expiration.
+func (m *memoryCache) update(key string, fn func(data []byte, has bool) ([]byte, error)) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	nv := &memoryCacheValue{key: key, createdAt: time.Now()}
+	v, has := m.store.get(key)
+	var data []byte
+	if has {
+		data = v.data
+		nv.createdAt = v.createdAt
+		nv.expiredDuration = v.expiredDuration
+	}
+	data, err := fn(data, has)
+	if err != nil {
+		return err
+	}
+	nv.data = data
+	m.store.put(nv)
+	m.stats.Set(1)
+	m.store.events.Emit(cache.EventSet, key)
+	return nil
+}
+
+func (m *memoryCache) Lock(key string, ttl time.Duration) (cache.ILock, error) {
+	if m.parent != nil {
+		return m.parent.Lock(key, ttl)
+	}
+
+	return m.locks.Lock(key, ttl)
+}
+
+func (m *memoryCache) incr(key string, step int) (int, error) {
+	var n int
+	err := m.update(key, func(data []byte, has bool) ([]byte, error) {
+		if has && json.STD().Unmarshal(data, &n) != nil {
+			return nil, ErrCacheNotInteger
+		}
+		n += step
+		return json.STD().Marshal(n)
+	})
+	if err == nil {
+		// the copies held by the child levels never update, evict them
+		cache.EvictChildren(m, key)
+	}
+	return n, err
+}
+
+func (m *memoryCache) Incr(key string) (int, error) {
+	if m.parent != nil {
+		return m.parent.Incr(key)
+	}
+
+	return m.incr(key, 1)
+}
+
+func (m *memoryCache) IncrBy(key string, step int) (int, error) {
+	if m.parent != nil {
+		return m.parent.IncrBy(key, step)
+	}
+
+	return m.incr(key, step)
+}
+
+func (m *memoryCache) IncrByFloat(key string, step float64) (float64, error) {
+	if m.parent != nil {
+		return m.parent.IncrByFloat(key, step)
+	}
+
+	var f float64
+	err := m.update(key, func(data []byte, has bool) ([]byte, error) {
+		if has && json.STD().Unmarshal(data, &f) != nil {
+			return nil, ErrCacheNotFloat
+		}
+		f += step
+		return json.STD().Marshal(f)
+	})
+	if err == nil {
+		cache.EvictChildren(m, key)
+	}
+	return f, err
+}
+
+func (m *memoryCache) Del(keys ...string) error {
+	start := time.Now()
+	m.store.mu.Lock()
+	for _, key := range keys {
+		if v, has := m.store.values[key]; has {
+			m.store.remove(v)
+			m.stats.Delete(1)
+			m.store.events.Emit(cache.EventDel, key)
+		}
+	}
+	m.store.mu.Unlock()
+	m.stats.Observe(cache.OpDel, start)
+
+	if m.parent != nil {
+		return m.parent.Del(keys...)
+	}
+	return nil
+}
+
+func (m *memoryCache) Local() cache.ICache {
+	c := *m
+	c.parent = nil
+	c.children = nil
+	return &c
+}
+
+// Identity identifies the cache by its store and its parent level.
+func (m *memoryCache) Identity() interface{} {
+	return [2]interface{}{m.store, cache.Identity(m.parent)}
+}
+
+func (m *memoryCache) Parent() cache.ICache {
+	return m.parent
+}
+
+func (m *memoryCache) SetParent(parent cache.ICache) {
+	if m.parent == nil {
+		m.parent = parent
+	}
+}
+
+func (m *memoryCache) Children() cache.ICache {
+	return m.children
+}
+
+func (m *memoryCache) SetChildren(children cache.ICache) {
+	if m.children == nil {
+		m.children = children
+	}
+}
+
+func (m *memoryCache) Close() error {
+	m.sweeper.Stop()
+	m.broker.Close()
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	m.store.values = make(map[string]*memoryCacheValue)
+	m.store.queue.values = nil
+	m.store.bytes = 0
+	return nil
+}
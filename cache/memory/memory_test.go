@@ -0,0 +1,383 @@
+package memory
+
+import (
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/cache/cachetest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache_SetGet(t *testing.T) {
+	c, err := NewMemoryCache()
+	assert.Nil(t, err)
+
+	assert.Nil(t, c.Set("int", 10))
+	assert.Nil(t, c.Set("string", "hello"))
+	assert.Nil(t, c.Set("struct", struct{ A int }{A: 1}))
+
+	assert.Equal(t, 10, c.GetInt("int"))
+	assert.Equal(t, "hello", c.GetString("string"))
+	var v struct{ A int }
+	assert.True(t, c.HasGet("struct", &v))
+	assert.Equal(t, 1, v.A)
+	assert.Equal(t, "def", c.DefaultGetString("missing", "def"))
+
+	values, err := c.HasPrefix("str")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"string": "hello", "struct": `{"A":1}`}, values)
+
+	assert.Nil(t, c.Del("int"))
+	assert.False(t, c.Has("int"))
+}
+
+func TestMemoryCache_TTL(t *testing.T) {
+	c, _ := NewMemoryCache()
+
+	assert.Nil(t, c.Set("forever", 1))
+	ttl, has := c.TTL("forever")
+	assert.True(t, has)
+	assert.Equal(t, time.Duration(0), ttl)
+
+	assert.Nil(t, c.Set("short", 1, 20*time.Millisecond))
+	ttl, has = c.TTL("short")
+	assert.True(t, has)
+	assert.True(t, ttl > 0 && ttl <= 20*time.Millisecond)
+
+	time.Sleep(30 * time.Millisecond)
+	assert.False(t, c.Has("short"))
+}
+
+func TestMemoryCache_Eviction(t *testing.T) {
+	c, _ := NewMemoryCache(&Options{MaxEntries: 2})
+	_ = c.Set("a", 1)
+	_ = c.Set("b", 2)
+	c.GetInt("a")
+	_ = c.Set("c", 3)
+	assert.True(t, c.Has("a"))
+	assert.False(t, c.Has("b"))
+	assert.True(t, c.Has("c"))
+
+	c, _ = NewMemoryCache(&Options{MaxEntries: 2, Eviction: EvictionLFU})
+	_ = c.Set("a", 1)
+	_ = c.Set("b", 2)
+	c.GetInt("a")
+	c.GetInt("a")
+	c.GetInt("b")
+	_ = c.Set("c", 3)
+	assert.True(t, c.Has("a"))
+	assert.False(t, c.Has("b"))
+}
+
+func TestMemoryCache_Incr(t *testing.T) {
+	c, _ := NewMemoryCache()
+	n, err := c.Incr("n")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, _ = c.IncrBy("n", 4)
+	assert.Equal(t, 5, n)
+	f, _ := c.IncrByFloat("f", 1.5)
+	assert.Equal(t, 1.5, f)
+
+	_ = c.Set("s", "abc")
+	_, err = c.Incr("s")
+	assert.Equal(t, ErrCacheNotInteger, err)
+}
+
+func TestMemoryCache_PubSub(t *testing.T) {
+	c, _ := NewMemoryCache()
+	received := make(chan string, 2)
+	_, err := c.PSubscribe([]string{"news.*"}, func(channel string, message string) {
+		received <- channel + ":" + message
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, c.Publish("news.sport", "goal"))
+	assert.Nil(t, c.Publish("weather", "rain"))
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, "news.sport:goal", msg)
+	case <-time.After(time.Second):
+		t.Fatal("message not delivered")
+	}
+}
+
+func TestMemoryCache_Stats(t *testing.T) {
+	l1, _ := NewMemoryCache()
+	l2, _ := NewMemoryCache(&Options{MaxEntries: 1})
+	c, _ := cache.NewCache([]cache.ICache{l1, l2})
+
+	_ = c.Set("a", 1)
+	c.GetInt("a")
+	c.GetInt("missing")
+	_ = c.Set("b", 2)
+
+	stats := cache.ChainStats(c)
+	assert.Equal(t, 2, len(stats))
+	assert.Equal(t, "memory", stats[0].Level)
+	assert.Equal(t, uint64(1), stats[0].Hits)
+	assert.Equal(t, uint64(1), stats[0].Misses)
+	assert.Equal(t, uint64(1), stats[0].Fallthroughs)
+	assert.Equal(t, uint64(2), stats[0].Sets)
+	assert.Equal(t, uint64(2), stats[0].Latency[cache.OpGet].Count)
+	assert.Equal(t, uint64(1), stats[1].Misses)
+	assert.Equal(t, uint64(1), stats[1].Evictions)
+}
+
+func TestMemoryCache_MGet(t *testing.T) {
+	l1, _ := NewMemoryCache()
+	l2, _ := NewMemoryCache()
+	c, _ := cache.NewCache([]cache.ICache{l1, l2})
+
+	assert.Nil(t, c.MSet(map[string]interface{}{"a": 1, "b": "two"}, time.Minute))
+	assert.Nil(t, l2.Set("c", 3))
+	assert.Nil(t, l1.Del("a"))
+	assert.Nil(t, l2.Set("a", 1, time.Minute))
+
+	items, err := c.MGet("a", "b", "c", "d")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(items))
+	var b string
+	assert.Nil(t, items["b"].Bind(&b))
+	assert.Equal(t, "two", b)
+	assert.True(t, items["a"].TTL > 0)
+	assert.Equal(t, time.Duration(0), items["c"].TTL)
+
+	// partial misses are backfilled into the child level
+	v, has := l1.(*memoryCache).hasGet("c")
+	assert.True(t, has)
+	assert.Equal(t, "3", string(v.data))
+}
+
+func TestMemoryCache_InvalidateTags(t *testing.T) {
+	l1, _ := NewMemoryCache()
+	l2, _ := NewMemoryCache()
+	c, _ := cache.NewCache([]cache.ICache{l1, l2})
+
+	assert.Nil(t, c.SetWithTags("user:42:profile", "p", []string{"user:42"}))
+	assert.Nil(t, c.SetWithTags("user:42:orders", "o", []string{"user:42", "tenant:7"}))
+	assert.Nil(t, c.SetWithTags("user:43:profile", "p", []string{"user:43", "tenant:7"}))
+	assert.Nil(t, c.Set("user:42:other", "x"))
+
+	assert.Nil(t, c.InvalidateTags("user:42"))
+	for _, level := range []cache.ICache{l1, l2} {
+		assert.False(t, level.Has("user:42:profile"))
+		assert.False(t, level.Has("user:42:orders"))
+		assert.True(t, level.Has("user:43:profile"))
+		assert.True(t, level.Has("user:42:other"))
+	}
+
+	assert.Nil(t, c.InvalidateTags("tenant:7"))
+	assert.False(t, c.Has("user:43:profile"))
+}
+
+func TestMemoryCache_Scan(t *testing.T) {
+	c, _ := NewMemoryCache()
+	for _, key := range []string{"user:3", "user:1", "user:2", "order:1"} {
+		assert.Nil(t, c.Set(key, key))
+	}
+
+	items, cursor, err := c.Scan("user:", "", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "user:2", cursor)
+	assert.Equal(t, 2, len(items))
+	assert.Equal(t, "user:1", items[0].Key)
+	var v string
+	assert.Nil(t, items[1].Bind(&v))
+	assert.Equal(t, "user:2", v)
+
+	items, cursor, err = c.Scan("user:", cursor, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "", cursor)
+	assert.Equal(t, 1, len(items))
+	assert.Equal(t, "user:3", items[0].Key)
+
+	_, _, err = c.Scan("user:", "order:1", 2)
+	assert.Equal(t, cache.ErrInvalidCursor, err)
+}
+
+func TestMemoryCache_Collections(t *testing.T) {
+	l1, _ := NewMemoryCache()
+	l2, _ := NewMemoryCache()
+	c, _ := cache.NewCache([]cache.ICache{l1, l2})
+
+	n, err := c.HSet("user:1", map[string]interface{}{"name": "alice", "age": 30})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	age, has, err := c.HGet("user:1", "age")
+	assert.Nil(t, err)
+	assert.True(t, has)
+	assert.Equal(t, "30", age)
+	// collections live at the top level only
+	assert.False(t, l1.Local().Has("user:1"))
+	assert.True(t, l2.Has("user:1"))
+
+	for player, score := range map[string]float64{"a": 10, "b": 30, "c": 20} {
+		_, err := c.ZIncrBy("leaderboard", score, player)
+		assert.Nil(t, err)
+	}
+	top, err := c.ZRevRange("leaderboard", 0, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.Z{{Member: "b", Score: 30}, {Member: "c", Score: 20}}, top)
+
+	_, err = c.SAdd("user:1", "x")
+	assert.Equal(t, cache.ErrWrongType, err)
+
+	n, _ = c.SAdd("tags", "go", "redis", "go")
+	assert.Equal(t, 2, n)
+	n, _ = c.SRem("tags", "go", "redis")
+	assert.Equal(t, 2, n)
+	// empty collections are deleted
+	assert.False(t, c.Has("tags"))
+}
+
+func TestMemoryCache_Conditional(t *testing.T) {
+	l1, _ := NewMemoryCache()
+	l2, _ := NewMemoryCache()
+	c, _ := cache.NewCache([]cache.ICache{l1, l2})
+
+	ok, err := c.SetNX("k", "a")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, _ = c.SetNX("k", "b")
+	assert.False(t, ok)
+	ok, _ = c.SetXX("missing", "b")
+	assert.False(t, ok)
+	assert.False(t, c.Has("missing"))
+
+	var old string
+	has, err := c.GetSet("k", "c", &old)
+	assert.Nil(t, err)
+	assert.True(t, has)
+	assert.Equal(t, "a", old)
+
+	ok, err = c.CompareAndSwap("k", "a", "d")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, _ = c.CompareAndSwap("k", "c", "d")
+	assert.True(t, ok)
+	assert.Equal(t, "d", l1.GetString("k"))
+
+	// an item read earlier serves as a version
+	items, _ := c.MGet("k")
+	assert.Nil(t, c.Set("k", "e"))
+	ok, _ = c.CompareAndSwap("k", items["k"], "f")
+	assert.False(t, ok)
+	items, _ = c.MGet("k")
+	ok, _ = c.CompareAndSwap("k", items["k"], "f")
+	assert.True(t, ok)
+}
+
+func TestMemoryCache_Expire(t *testing.T) {
+	c, _ := NewMemoryCache()
+	assert.Nil(t, c.Set("k", 1, 40*time.Millisecond))
+
+	has, err := c.Expire("k", time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, has)
+	ttl, _ := c.TTL("k")
+	assert.True(t, ttl > 40*time.Millisecond)
+
+	has, _ = c.Persist("k")
+	assert.True(t, has)
+	ttl, _ = c.TTL("k")
+	assert.Equal(t, time.Duration(0), ttl)
+
+	has, _ = c.Expire("missing", time.Hour)
+	assert.False(t, has)
+	has, _ = c.ExpireAt("k", time.Now().Add(-time.Second))
+	assert.True(t, has)
+	assert.False(t, c.Has("k"))
+
+	// touched keys slide their expiration
+	assert.Nil(t, c.Set("session", 1, 40*time.Millisecond))
+	for i := 0; i < 3; i++ {
+		time.Sleep(20 * time.Millisecond)
+		has, _ = c.Touch("session")
+		assert.True(t, has)
+	}
+	assert.True(t, c.Has("session"))
+}
+
+func TestMemoryCache_Events(t *testing.T) {
+	c, _ := NewMemoryCache(&Options{SweepInterval: 10 * time.Millisecond})
+	defer c.Close()
+	expired := make(chan string, 1)
+	changed := make(chan string, 4)
+	assert.Nil(t, c.OnExpire("session.*", func(key string) {
+		expired <- key
+	}))
+	assert.Nil(t, c.OnChange("user.*", func(key, event string) {
+		changed <- key + ":" + event
+	}))
+
+	// expired keys are swept without being read
+	assert.Nil(t, c.Set("session.1", 1, 20*time.Millisecond))
+	select {
+	case key := <-expired:
+		assert.Equal(t, "session.1", key)
+	case <-time.After(time.Second):
+		t.Fatal("expiration not notified")
+	}
+
+	assert.Nil(t, c.Set("user.1", 1))
+	assert.Nil(t, c.Set("order.1", 1))
+	assert.Nil(t, c.Del("user.1"))
+	var events []string
+	for len(events) < 2 {
+		select {
+		case event := <-changed:
+			events = append(events, event)
+		case <-time.After(time.Second):
+			t.Fatal("change not notified")
+		}
+	}
+	assert.ElementsMatch(t, []string{"user.1:set", "user.1:del"}, events)
+}
+
+func TestMemoryCache_Subscription(t *testing.T) {
+	c, _ := NewMemoryCache()
+	received := make(chan string, 4)
+	sub, err := c.Subscribe([]string{"jobs"}, func(channel string, message string) {
+		if message == "bad" {
+			panic("bad message")
+		}
+		received <- message
+	}, &cache.SubscribeOptions{Concurrency: 2})
+	assert.Nil(t, err)
+
+	// a panicking handler does not end the subscription
+	assert.Nil(t, c.Publish("jobs", "bad"))
+	assert.Nil(t, c.Publish("jobs", "good"))
+	select {
+	case msg := <-received:
+		assert.Equal(t, "good", msg)
+	case <-time.After(time.Second):
+		t.Fatal("message not delivered")
+	}
+
+	assert.Nil(t, sub.Close())
+	assert.Nil(t, sub.Close())
+	assert.Nil(t, sub.Err())
+	assert.Nil(t, c.Publish("jobs", "late"))
+	select {
+	case msg := <-received:
+		t.Fatalf("message %q delivered after Close", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sub, _ = c.Subscribe([]string{"jobs"}, func(string, string) {})
+	assert.Nil(t, c.Close())
+	assert.Equal(t, cache.ErrCacheClosed, sub.Err())
+}
+
+func TestMemoryCache_Conformance(t *testing.T) {
+	cachetest.Run(t, func(t *testing.T) cache.ICache {
+		c, err := NewMemoryCache()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = c.Close() })
+		return c
+	})
+}
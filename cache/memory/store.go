@@ -0,0 +1,205 @@
+package memory
+
+import (
+	"container/heap"
+	"github.com/motclub/common/cache"
+	"sync"
+	"time"
+)
+
+const (
+	EvictionLRU = "lru"
+	EvictionLFU = "lfu"
+)
+
+type memoryCacheValue struct {
+	key  string
+	data []byte
+	// codec is the name of the codec data is encoded with, JSON when empty.
+	codec           string
+	expiredDuration time.Duration
+	createdAt       time.Time
+	tags            []string
+
+	hits  uint64
+	tick  uint64
+	index int
+}
+
+func (v *memoryCacheValue) expired(now time.Time) bool {
+	return v.expiredDuration > 0 && now.After(v.createdAt.Add(v.expiredDuration))
+}
+
+// remaining returns the time to live left at now, 0 when the value does not expire.
+func (v *memoryCacheValue) remaining(now time.Time) time.Duration {
+	if v.expiredDuration <= 0 {
+		return 0
+	}
+	return v.createdAt.Add(v.expiredDuration).Sub(now)
+}
+
+func (v *memoryCacheValue) size() int64 {
+	return int64(len(v.key) + len(v.data))
+}
+
+// store keeps the entries of a memory cache, ordered by eviction priority in a min-heap.
+type store struct {
+	mu         sync.Mutex
+	values     map[string]*memoryCacheValue
+	tagged     map[string]map[string]struct{}
+	queue      valueQueue
+	bytes      int64
+	tick       uint64
+	maxEntries int
+	maxBytes   int64
+	stats      *cache.StatsRecorder
+	events     *cache.KeyEvents
+}
+
+func newStore(o *Options, stats *cache.StatsRecorder) *store {
+	return &store{
+		stats:      stats,
+		events:     cache.NewKeyEvents(),
+		values:     make(map[string]*memoryCacheValue),
+		tagged:     make(map[string]map[string]struct{}),
+		queue:      valueQueue{lfu: o.Eviction == EvictionLFU},
+		maxEntries: o.MaxEntries,
+		maxBytes:   o.MaxBytes,
+	}
+}
+
+// get returns the entry of key, removing it when it has expired. The caller must hold s.mu.
+func (s *store) get(key string) (*memoryCacheValue, bool) {
+	v, has := s.values[key]
+	if !has {
+		return nil, false
+	}
+	if v.expired(time.Now()) {
+		s.remove(v)
+		s.stats.Expire(1)
+		s.events.Emit(cache.EventExpired, key)
+		return nil, false
+	}
+	s.touch(v)
+	return v, true
+}
+
+// put inserts or replaces an entry, evicting other entries first to respect the bounds.
+// An entry larger than MaxBytes is not stored at all. The caller must hold s.mu.
+func (s *store) put(v *memoryCacheValue) {
+	v.index = -1
+	if old, has := s.values[v.key]; has {
+		v.hits = old.hits
+		s.remove(old)
+	}
+	if s.maxBytes > 0 && v.size() > s.maxBytes {
+		return
+	}
+	for s.queue.Len() > 0 && !s.fits(v) {
+		evicted := s.queue.values[0]
+		s.remove(evicted)
+		s.stats.Evict(1)
+		s.events.Emit(cache.EventEvicted, evicted.key)
+	}
+	s.values[v.key] = v
+	for _, tag := range v.tags {
+		if s.tagged[tag] == nil {
+			s.tagged[tag] = make(map[string]struct{})
+		}
+		s.tagged[tag][v.key] = struct{}{}
+	}
+	s.bytes += v.size()
+	s.touch(v)
+	heap.Push(&s.queue, v)
+}
+
+func (s *store) fits(v *memoryCacheValue) bool {
+	return (s.maxEntries <= 0 || len(s.values) < s.maxEntries) && (s.maxBytes <= 0 || s.bytes+v.size() <= s.maxBytes)
+}
+
+// remove deletes an entry. The caller must hold s.mu.
+func (s *store) remove(v *memoryCacheValue) {
+	delete(s.values, v.key)
+	for _, tag := range v.tags {
+		delete(s.tagged[tag], v.key)
+		if len(s.tagged[tag]) == 0 {
+			delete(s.tagged, tag)
+		}
+	}
+	s.bytes -= v.size()
+	if v.index >= 0 {
+		heap.Remove(&s.queue, v.index)
+	}
+}
+
+// invalidate removes every entry carrying one of tags and returns their keys.
+// The caller must hold s.mu.
+func (s *store) invalidate(tags []string) []string {
+	var keys []string
+	for _, tag := range tags {
+		for key := range s.tagged[tag] {
+			s.remove(s.values[key])
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// sweep removes the entries expired at now. The caller must hold s.mu.
+func (s *store) sweep(now time.Time) {
+	for key, v := range s.values {
+		if v.expired(now) {
+			s.remove(v)
+			s.stats.Expire(1)
+			s.events.Emit(cache.EventExpired, key)
+		}
+	}
+}
+
+func (s *store) touch(v *memoryCacheValue) {
+	s.tick++
+	v.tick = s.tick
+	v.hits++
+	if v.index >= 0 {
+		heap.Fix(&s.queue, v.index)
+	}
+}
+
+// valueQueue orders entries by last access (LRU) or by hit count then last access (LFU).
+type valueQueue struct {
+	lfu    bool
+	values []*memoryCacheValue
+}
+
+func (q valueQueue) Len() int {
+	return len(q.values)
+}
+
+func (q valueQueue) Less(i, j int) bool {
+	a, b := q.values[i], q.values[j]
+	if q.lfu && a.hits != b.hits {
+		return a.hits < b.hits
+	}
+	return a.tick < b.tick
+}
+
+func (q valueQueue) Swap(i, j int) {
+	q.values[i], q.values[j] = q.values[j], q.values[i]
+	q.values[i].index = i
+	q.values[j].index = j
+}
+
+func (q *valueQueue) Push(x interface{}) {
+	v := x.(*memoryCacheValue)
+	v.index = len(q.values)
+	q.values = append(q.values, v)
+}
+
+func (q *valueQueue) Pop() interface{} {
+	n := len(q.values)
+	v := q.values[n-1]
+	q.values[n-1] = nil
+	q.values = q.values[:n-1]
+	v.index = -1
+	return v
+}
@@ -0,0 +1,743 @@
+package namespace
+
+import (
+	"context"
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/json"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// separator joins the namespace and the keys or channels it prefixes.
+const separator = ":"
+
+// scanPageSize is the number of keys scanned per call while clearing or searching a namespace.
+const scanPageSize = 1000
+
+var ErrEmptyNamespace = errors.New(`mot: empty cache namespace`)
+
+// INamespaceCache is a view of a cache whose keys, tags and channels are all
+// prefixed with a namespace.
+type INamespaceCache interface {
+	cache.ICache
+	Namespace() string
+	// Clear deletes every key of the namespace.
+	Clear() error
+}
+
+func NewNamespaceCache(c cache.ICache, namespace string) (INamespaceCache, error) {
+	if namespace == "" {
+		return nil, ErrEmptyNamespace
+	}
+	return newNamespaceCache(c, namespace), nil
+}
+
+type namespaceCache struct {
+	c         cache.ICache
+	namespace string
+	prefix    string
+}
+
+func newNamespaceCache(c cache.ICache, namespace string) *namespaceCache {
+	return &namespaceCache{c: c, namespace: namespace, prefix: namespace + separator}
+}
+
+func (n *namespaceCache) Namespace() string {
+	return n.namespace
+}
+
+func (n *namespaceCache) key(key string) string {
+	return n.prefix + key
+}
+
+func (n *namespaceCache) keys(keys []string) []string {
+	v := make([]string, len(keys))
+	for i, key := range keys {
+		v[i] = n.prefix + key
+	}
+	return v
+}
+
+// strip returns key without the namespace, and whether it belongs to the namespace.
+func (n *namespaceCache) strip(key string) (string, bool) {
+	if !strings.HasPrefix(key, n.prefix) {
+		return "", false
+	}
+	return key[len(n.prefix):], true
+}
+
+func (n *namespaceCache) Clear() error {
+	cursor := ""
+	for {
+		items, next, err := n.c.Scan(n.prefix, cursor, scanPageSize)
+		if err != nil {
+			return err
+		}
+		if len(items) > 0 {
+			keys := make([]string, len(items))
+			for i, item := range items {
+				keys[i] = item.Key
+			}
+			if err := n.c.Del(keys...); err != nil {
+				return err
+			}
+		}
+		if cursor = next; cursor == "" {
+			return nil
+		}
+	}
+}
+
+func (n *namespaceCache) Has(key string) bool {
+	return n.c.Has(n.key(key))
+}
+
+func (n *namespaceCache) HasGet(key string, dst interface{}) bool {
+	return n.c.HasGet(n.key(key), dst)
+}
+
+func (n *namespaceCache) HasGetInt(key string) (int, bool) {
+	var v int
+	has := n.HasGet(key, &v)
+	return v, has
+}
+
+func (n *namespaceCache) HasGetFloat(key string) (float64, bool) {
+	var v float64
+	has := n.HasGet(key, &v)
+	return v, has
+}
+
+func (n *namespaceCache) HasGetString(key string) (string, bool) {
+	var v string
+	has := n.HasGet(key, &v)
+	return v, has
+}
+
+func (n *namespaceCache) HasGetBool(key string) (bool, bool) {
+	var v bool
+	has := n.HasGet(key, &v)
+	return v, has
+}
+
+func (n *namespaceCache) HasGetTime(key string) (time.Time, bool) {
+	var v time.Time
+	has := n.HasGet(key, &v)
+	return v, has
+}
+
+func (n *namespaceCache) HasGetInt8(key string) (int8, bool) {
+	v, has := n.HasGetInt(key)
+	return int8(v), has
+}
+
+func (n *namespaceCache) HasGetInt16(key string) (int16, bool) {
+	v, has := n.HasGetInt(key)
+	return int16(v), has
+}
+
+func (n *namespaceCache) HasGetInt32(key string) (int32, bool) {
+	v, has := n.HasGetInt(key)
+	return int32(v), has
+}
+
+func (n *namespaceCache) HasGetInt64(key string) (int64, bool) {
+	v, has := n.HasGetInt(key)
+	return int64(v), has
+}
+
+func (n *namespaceCache) HasGetUint(key string) (uint, bool) {
+	v, has := n.HasGetInt(key)
+	return uint(v), has
+}
+
+func (n *namespaceCache) HasGetUint8(key string) (uint8, bool) {
+	v, has := n.HasGetInt(key)
+	return uint8(v), has
+}
+
+func (n *namespaceCache) HasGetUint16(key string) (uint16, bool) {
+	v, has := n.HasGetInt(key)
+	return uint16(v), has
+}
+
+func (n *namespaceCache) HasGetUint32(key string) (uint32, bool) {
+	v, has := n.HasGetInt(key)
+	return uint32(v), has
+}
+
+func (n *namespaceCache) HasGetUint64(key string) (uint64, bool) {
+	v, has := n.HasGetInt(key)
+	return uint64(v), has
+}
+
+func (n *namespaceCache) HasGetFloat32(key string) (float32, bool) {
+	v, has := n.HasGetFloat(key)
+	return float32(v), has
+}
+
+func (n *namespaceCache) HasGetFloat64(key string) (float64, bool) {
+	return n.HasGetFloat(key)
+}
+
+func (n *namespaceCache) Get(key string, dst interface{}) {
+	_ = n.HasGet(key, dst)
+}
+
+func (n *namespaceCache) GetInt(key string) int {
+	v, _ := n.HasGetInt(key)
+	return v
+}
+
+func (n *namespaceCache) GetInt8(key string) int8 {
+	v, _ := n.HasGetInt8(key)
+	return v
+}
+
+func (n *namespaceCache) GetInt16(key string) int16 {
+	v, _ := n.HasGetInt16(key)
+	return v
+}
+
+func (n *namespaceCache) GetInt32(key string) int32 {
+	v, _ := n.HasGetInt32(key)
+	return v
+}
+
+func (n *namespaceCache) GetInt64(key string) int64 {
+	v, _ := n.HasGetInt64(key)
+	return v
+}
+
+func (n *namespaceCache) GetUint(key string) uint {
+	v, _ := n.HasGetUint(key)
+	return v
+}
+
+func (n *namespaceCache) GetUint8(key string) uint8 {
+	v, _ := n.HasGetUint8(key)
+	return v
+}
+
+func (n *namespaceCache) GetUint16(key string) uint16 {
+	v, _ := n.HasGetUint16(key)
+	return v
+}
+
+func (n *namespaceCache) GetUint32(key string) uint32 {
+	v, _ := n.HasGetUint32(key)
+	return v
+}
+
+func (n *namespaceCache) GetUint64(key string) uint64 {
+	v, _ := n.HasGetUint64(key)
+	return v
+}
+
+func (n *namespaceCache) GetFloat(key string) float64 {
+	v, _ := n.HasGetFloat(key)
+	return v
+}
+
+func (n *namespaceCache) GetFloat32(key string) float32 {
+	v, _ := n.HasGetFloat32(key)
+	return v
+}
+
+func (n *namespaceCache) GetFloat64(key string) float64 {
+	v, _ := n.HasGetFloat64(key)
+	return v
+}
+
+func (n *namespaceCache) GetString(key string) string {
+	v, _ := n.HasGetString(key)
+	return v
+}
+
+func (n *namespaceCache) GetBool(key string) bool {
+	v, _ := n.HasGetBool(key)
+	return v
+}
+
+func (n *namespaceCache) GetTime(key string) time.Time {
+	v, _ := n.HasGetTime(key)
+	return v
+}
+
+func (n *namespaceCache) DefaultGet(key string, dst interface{}, defaultValue interface{}) {
+	if !n.HasGet(key, dst) {
+		_ = json.Copy(defaultValue, dst)
+	}
+}
+
+func (n *namespaceCache) DefaultGetInt(key string, defaultValue int) int {
+	if v, has := n.HasGetInt(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (n *namespaceCache) DefaultGetInt8(key string, defaultValue int8) int8 {
+	if v, has := n.HasGetInt8(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (n *namespaceCache) DefaultGetInt16(key string, defaultValue int16) int16 {
+	if v, has := n.HasGetInt16(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (n *namespaceCache) DefaultGetInt32(key string, defaultValue int32) int32 {
+	if v, has := n.HasGetInt32(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (n *namespaceCache) DefaultGetInt64(key string, defaultValue int64) int64 {
+	if v, has := n.HasGetInt64(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (n *namespaceCache) DefaultGetUint(key string, defaultValue uint) uint {
+	if v, has := n.HasGetUint(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (n *namespaceCache) DefaultGetUint8(key string, defaultValue uint8) uint8 {
+	if v, has := n.HasGetUint8(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (n *namespaceCache) DefaultGetUint16(key string, defaultValue uint16) uint16 {
+	if v, has := n.HasGetUint16(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (n *namespaceCache) DefaultGetUint32(key string, defaultValue uint32) uint32 {
+	if v, has := n.HasGetUint32(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (n *namespaceCache) DefaultGetUint64(key string, defaultValue uint64) uint64 {
+	if v, has := n.HasGetUint64(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (n *namespaceCache) DefaultGetFloat(key string, defaultValue float64) float64 {
+	if v, has := n.HasGetFloat(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (n *namespaceCache) DefaultGetFloat32(key string, defaultValue float32) float32 {
+	if v, has := n.HasGetFloat32(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (n *namespaceCache) DefaultGetFloat64(key string, defaultValue float64) float64 {
+	if v, has := n.HasGetFloat64(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (n *namespaceCache) DefaultGetString(key string, defaultValue string) string {
+	if v, has := n.HasGetString(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (n *namespaceCache) DefaultGetBool(key string, defaultValue bool) bool {
+	if v, has := n.HasGetBool(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (n *namespaceCache) DefaultGetTime(key string, defaultValue time.Time) time.Time {
+	if v, has := n.HasGetTime(key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (n *namespaceCache) TTL(key string) (time.Duration, bool) {
+	return n.c.TTL(n.key(key))
+}
+
+func (n *namespaceCache) Set(key string, value interface{}, expiration ...time.Duration) error {
+	return n.c.Set(n.key(key), value, expiration...)
+}
+
+func (n *namespaceCache) MGet(keys ...string) (map[string]*cache.Item, error) {
+	found, err := n.c.MGet(n.keys(keys)...)
+	if err != nil {
+		return nil, err
+	}
+	items := make(map[string]*cache.Item, len(found))
+	for _, item := range found {
+		if key, ok := n.strip(item.Key); ok {
+			items[key] = n.item(key, item)
+		}
+	}
+	return items, nil
+}
+
+// item returns a copy of item under key, leaving the items of the wrapped cache untouched.
+func (n *namespaceCache) item(key string, item *cache.Item) *cache.Item {
+	v := *item
+	v.Key = key
+	return &v
+}
+
+func (n *namespaceCache) MSet(values map[string]interface{}, expiration ...time.Duration) error {
+	v := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		v[n.key(key)] = value
+	}
+	return n.c.MSet(v, expiration...)
+}
+
+func (n *namespaceCache) SetNX(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	return n.c.SetNX(n.key(key), value, expiration...)
+}
+
+func (n *namespaceCache) SetXX(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	return n.c.SetXX(n.key(key), value, expiration...)
+}
+
+func (n *namespaceCache) GetSet(key string, value interface{}, dst interface{}) (bool, error) {
+	return n.c.GetSet(n.key(key), value, dst)
+}
+
+func (n *namespaceCache) CompareAndSwap(key string, old, value interface{}, expiration ...time.Duration) (bool, error) {
+	return n.c.CompareAndSwap(n.key(key), old, value, expiration...)
+}
+
+func (n *namespaceCache) Expire(key string, ttl time.Duration) (bool, error) {
+	return n.c.Expire(n.key(key), ttl)
+}
+
+func (n *namespaceCache) ExpireAt(key string, at time.Time) (bool, error) {
+	return n.c.ExpireAt(n.key(key), at)
+}
+
+func (n *namespaceCache) Persist(key string) (bool, error) {
+	return n.c.Persist(n.key(key))
+}
+
+func (n *namespaceCache) Touch(key string) (bool, error) {
+	return n.c.Touch(n.key(key))
+}
+
+func (n *namespaceCache) SetItems(items ...*cache.Item) error {
+	v := make([]*cache.Item, len(items))
+	for i, item := range items {
+		v[i] = n.item(n.key(item.Key), item)
+	}
+	return cache.SetItems(n.c, v...)
+}
+
+func (n *namespaceCache) SetWithTags(key string, value interface{}, tags []string, expiration ...time.Duration) error {
+	return n.c.SetWithTags(n.key(key), value, n.keys(tags), expiration...)
+}
+
+func (n *namespaceCache) InvalidateTags(tags ...string) error {
+	return n.c.InvalidateTags(n.keys(tags)...)
+}
+
+func (n *namespaceCache) GetOrLoad(key string, dst interface{}, ttl time.Duration, loader cache.LoaderFunc) error {
+	return n.c.GetOrLoad(n.key(key), dst, ttl, loader)
+}
+
+func (n *namespaceCache) HasPrefix(s string, limit ...int) (map[string]string, error) {
+	found, err := n.c.HasPrefix(n.key(s), limit...)
+	return n.values(found, err)
+}
+
+func (n *namespaceCache) HasSuffix(s string, limit ...int) (map[string]string, error) {
+	return n.match(func(key string) bool {
+		return strings.HasSuffix(key, s)
+	}, limit...)
+}
+
+func (n *namespaceCache) Contains(s string, limit ...int) (map[string]string, error) {
+	return n.match(func(key string) bool {
+		return strings.Contains(key, s)
+	}, limit...)
+}
+
+// values strips the namespace from the keys found, dropping the keys of other namespaces.
+func (n *namespaceCache) values(found map[string]string, err error) (map[string]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	v := make(map[string]string, len(found))
+	for key, value := range found {
+		if key, ok := n.strip(key); ok {
+			v[key] = value
+		}
+	}
+	return v, nil
+}
+
+// match scans the keys of the namespace only, returning the values of the
+// ones filter accepts, without the namespace.
+func (n *namespaceCache) match(filter func(key string) bool, limit ...int) (map[string]string, error) {
+	var max int
+	if len(limit) > 0 {
+		max = limit[0]
+	}
+	v := make(map[string]string)
+	cursor := ""
+	for {
+		items, next, err := n.c.Scan(n.prefix, cursor, scanPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if key, ok := n.strip(item.Key); ok && filter(key) {
+				v[key] = cache.DataString(item.Codec, item.Value)
+				if max > 0 && len(v) >= max {
+					return v, nil
+				}
+			}
+		}
+		if cursor = next; cursor == "" {
+			return v, nil
+		}
+	}
+}
+
+func (n *namespaceCache) Scan(prefix, cursor string, limit int) ([]*cache.Item, string, error) {
+	found, next, err := n.c.Scan(n.key(prefix), cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	items := make([]*cache.Item, 0, len(found))
+	for _, item := range found {
+		if key, ok := n.strip(item.Key); ok {
+			items = append(items, n.item(key, item))
+		}
+	}
+	return items, next, nil
+}
+
+// Scripter runs scripts on the scripter of the wrapped cache, with their keys prefixed.
+func (n *namespaceCache) Scripter() (cache.IScripter, bool) {
+	s, ok := cache.Scripter(n.c)
+	if !ok {
+		return nil, false
+	}
+	return &scripter{s: s, n: n}, true
+}
+
+type scripter struct {
+	s cache.IScripter
+	n *namespaceCache
+}
+
+func (s *scripter) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	return s.s.Eval(script, s.n.keys(keys), args...)
+}
+
+func (n *namespaceCache) Lock(key string, ttl time.Duration) (cache.ILock, error) {
+	return n.c.Lock(n.key(key), ttl)
+}
+
+func (n *namespaceCache) Incr(key string) (int, error) {
+	return n.c.Incr(n.key(key))
+}
+
+func (n *namespaceCache) IncrBy(key string, step int) (int, error) {
+	return n.c.IncrBy(n.key(key), step)
+}
+
+func (n *namespaceCache) IncrByFloat(key string, step float64) (float64, error) {
+	return n.c.IncrByFloat(n.key(key), step)
+}
+
+func (n *namespaceCache) HSet(key string, values map[string]interface{}) (int, error) {
+	return n.c.HSet(n.key(key), values)
+}
+
+func (n *namespaceCache) HGet(key, field string) (string, bool, error) {
+	return n.c.HGet(n.key(key), field)
+}
+
+func (n *namespaceCache) HGetAll(key string) (map[string]string, error) {
+	return n.c.HGetAll(n.key(key))
+}
+
+func (n *namespaceCache) HDel(key string, fields ...string) (int, error) {
+	return n.c.HDel(n.key(key), fields...)
+}
+
+func (n *namespaceCache) LPush(key string, values ...interface{}) (int, error) {
+	return n.c.LPush(n.key(key), values...)
+}
+
+func (n *namespaceCache) RPush(key string, values ...interface{}) (int, error) {
+	return n.c.RPush(n.key(key), values...)
+}
+
+func (n *namespaceCache) LPop(key string) (string, bool, error) {
+	return n.c.LPop(n.key(key))
+}
+
+func (n *namespaceCache) RPop(key string) (string, bool, error) {
+	return n.c.RPop(n.key(key))
+}
+
+func (n *namespaceCache) LRange(key string, start, stop int) ([]string, error) {
+	return n.c.LRange(n.key(key), start, stop)
+}
+
+func (n *namespaceCache) SAdd(key string, members ...interface{}) (int, error) {
+	return n.c.SAdd(n.key(key), members...)
+}
+
+func (n *namespaceCache) SRem(key string, members ...interface{}) (int, error) {
+	return n.c.SRem(n.key(key), members...)
+}
+
+func (n *namespaceCache) SIsMember(key string, member interface{}) (bool, error) {
+	return n.c.SIsMember(n.key(key), member)
+}
+
+func (n *namespaceCache) SMembers(key string) ([]string, error) {
+	return n.c.SMembers(n.key(key))
+}
+
+func (n *namespaceCache) ZAdd(key string, members ...cache.Z) (int, error) {
+	return n.c.ZAdd(n.key(key), members...)
+}
+
+func (n *namespaceCache) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	return n.c.ZIncrBy(n.key(key), increment, member)
+}
+
+func (n *namespaceCache) ZRem(key string, members ...string) (int, error) {
+	return n.c.ZRem(n.key(key), members...)
+}
+
+func (n *namespaceCache) ZScore(key, member string) (float64, bool, error) {
+	return n.c.ZScore(n.key(key), member)
+}
+
+func (n *namespaceCache) ZRange(key string, start, stop int) ([]cache.Z, error) {
+	return n.c.ZRange(n.key(key), start, stop)
+}
+
+func (n *namespaceCache) ZRevRange(key string, start, stop int) ([]cache.Z, error) {
+	return n.c.ZRevRange(n.key(key), start, stop)
+}
+
+func (n *namespaceCache) ZRangeByScore(key string, min, max float64) ([]cache.Z, error) {
+	return n.c.ZRangeByScore(n.key(key), min, max)
+}
+
+func (n *namespaceCache) Del(keys ...string) error {
+	return n.c.Del(n.keys(keys)...)
+}
+
+func (n *namespaceCache) Local() cache.ICache {
+	return newNamespaceCache(n.c.Local(), n.namespace)
+}
+
+// Identity identifies the cache by its prefix and the cache it wraps.
+func (n *namespaceCache) Identity() interface{} {
+	return [2]interface{}{n.prefix, cache.Identity(n.c)}
+}
+
+func (n *namespaceCache) Parent() cache.ICache {
+	return n.c.Parent()
+}
+
+func (n *namespaceCache) Children() cache.ICache {
+	return n.c.Children()
+}
+
+func (n *namespaceCache) SetParent(parent cache.ICache) {
+	n.c.SetParent(parent)
+}
+
+func (n *namespaceCache) SetChildren(children cache.ICache) {
+	n.c.SetChildren(children)
+}
+
+func (n *namespaceCache) Close() error {
+	return n.c.Close()
+}
+
+func (n *namespaceCache) Stats() cache.Stats {
+	return n.c.Stats()
+}
+
+func (n *namespaceCache) WithContext(ctx context.Context) cache.ICache {
+	return newNamespaceCache(n.c.WithContext(ctx), n.namespace)
+}
+
+func (n *namespaceCache) OnExpire(pattern string, handler func(key string)) error {
+	return n.c.OnExpire(cache.EscapePattern(n.prefix)+pattern, func(key string) {
+		if key, ok := n.strip(key); ok {
+			handler(key)
+		}
+	})
+}
+
+func (n *namespaceCache) OnChange(pattern string, handler func(key, event string)) error {
+	return n.c.OnChange(cache.EscapePattern(n.prefix)+pattern, func(key, event string) {
+		if key, ok := n.strip(key); ok {
+			handler(key, event)
+		}
+	})
+}
+
+func (n *namespaceCache) Publish(channel string, message interface{}) error {
+	return n.c.Publish(n.key(channel), message)
+}
+
+func (n *namespaceCache) Subscribe(channels []string, handler func(string, string), options ...*cache.SubscribeOptions) (cache.ISubscription, error) {
+	return n.c.Subscribe(n.keys(channels), n.handler(handler), options...)
+}
+
+func (n *namespaceCache) PSubscribe(patterns []string, handler func(string, string), options ...*cache.SubscribeOptions) (cache.ISubscription, error) {
+	prefix := cache.EscapePattern(n.prefix)
+	v := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		v[i] = prefix + pattern
+	}
+	return n.c.PSubscribe(v, n.handler(handler), options...)
+}
+
+// handler strips the namespace from the channels handler receives messages on.
+func (n *namespaceCache) handler(handler func(string, string)) func(string, string) {
+	return func(channel string, message string) {
+		if channel, ok := n.strip(channel); ok {
+			handler(channel, message)
+		}
+	}
+}
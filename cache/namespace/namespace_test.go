@@ -0,0 +1,115 @@
+package namespace
+
+import (
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/cache/memory"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNamespaceCache_Isolation(t *testing.T) {
+	inner, _ := memory.NewMemoryCache()
+	a, err := NewNamespaceCache(inner, "a")
+	assert.Nil(t, err)
+	b, _ := NewNamespaceCache(inner, "b")
+
+	assert.Nil(t, a.Set("user:1", "alice"))
+	assert.Nil(t, b.Set("user:1", "bob"))
+	assert.Equal(t, "alice", a.GetString("user:1"))
+	assert.Equal(t, "bob", b.GetString("user:1"))
+	assert.Equal(t, "alice", inner.GetString("a:user:1"))
+
+	values, err := a.HasPrefix("user:")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"user:1": "alice"}, values)
+	values, err = b.HasSuffix(":1")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"user:1": "bob"}, values)
+	values, err = b.Contains("b")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(values))
+
+	items, err := a.MGet("user:1", "user:2")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(items))
+	assert.Equal(t, "user:1", items["user:1"].Key)
+
+	scanned, cursor, err := b.Scan("user:", "", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "", cursor)
+	assert.Equal(t, 1, len(scanned))
+	assert.Equal(t, "user:1", scanned[0].Key)
+}
+
+func TestNamespaceCache_Search(t *testing.T) {
+	inner, _ := memory.NewMemoryCache()
+	a, _ := NewNamespaceCache(inner, "a")
+	b, _ := NewNamespaceCache(inner, "b")
+	assert.Nil(t, a.Set("user:1", "alice"))
+	assert.Nil(t, a.Set("user:2", "anna"))
+	assert.Nil(t, b.Set("user:1", "bob"))
+	assert.Nil(t, inner.Set("user:1", "root"))
+
+	values, err := a.HasSuffix(":1")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"user:1": "alice"}, values)
+	values, err = a.Contains("user")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"user:1": "alice", "user:2": "anna"}, values)
+	values, _ = a.Contains("user", 1)
+	assert.Len(t, values, 1)
+
+	// keys of other namespaces never match, even when the namespace has none
+	c, _ := NewNamespaceCache(inner, "c")
+	values, err = c.HasSuffix(":1")
+	assert.Nil(t, err)
+	assert.Len(t, values, 0)
+	values, _ = c.Contains("user")
+	assert.Len(t, values, 0)
+
+	var v string
+	assert.Nil(t, c.GetOrLoad("loaded", &v, time.Minute, func() (interface{}, error) {
+		return "value", nil
+	}))
+	assert.Equal(t, "value", inner.GetString("c:loaded"))
+	assert.False(t, inner.Has("loaded"))
+}
+
+func TestNamespaceCache_Clear(t *testing.T) {
+	inner, _ := memory.NewMemoryCache()
+	a, _ := NewNamespaceCache(inner, "a")
+	assert.Nil(t, a.Set("k1", 1))
+	assert.Nil(t, a.Set("k2", 2))
+	assert.Nil(t, inner.Set("ab:k1", 3))
+	assert.Nil(t, inner.Set("k1", 4))
+
+	assert.Nil(t, a.Clear())
+	assert.False(t, a.Has("k1"))
+	assert.False(t, a.Has("k2"))
+	assert.True(t, inner.Has("ab:k1"))
+	assert.True(t, inner.Has("k1"))
+
+	_, err := NewNamespaceCache(inner, "")
+	assert.Equal(t, ErrEmptyNamespace, err)
+	var _ cache.ICache = a
+}
+
+func TestNamespaceCache_PubSub(t *testing.T) {
+	inner, _ := memory.NewMemoryCache()
+	a, _ := NewNamespaceCache(inner, "a")
+	received := make(chan string, 2)
+	_, err := a.PSubscribe([]string{"news.*"}, func(channel string, message string) {
+		received <- channel + ":" + message
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, inner.Publish("news.sport", "other namespace"))
+	assert.Nil(t, a.Publish("news.sport", "goal"))
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, "news.sport:goal", msg)
+	case <-time.After(time.Second):
+		t.Fatal("message not delivered")
+	}
+}
@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"github.com/pkg/errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownDriver = errors.New(`mot: unknown cache driver`)
+	ErrInvalidConfig = errors.New(`mot: invalid cache config, "levels" must list the URIs of the levels`)
+)
+
+// Driver opens a cache level from its URI, such as "memory://?size=10000".
+type Driver func(u *url.URL) (ICache, error)
+
+var drivers = struct {
+	sync.RWMutex
+	m map[string]Driver
+}{m: make(map[string]Driver)}
+
+// Register makes a driver available to Open under the scheme of its URIs.
+// Backends register themselves when their package is imported, so that
+// importing it for its side effects is enough:
+//
+//	import _ "github.com/motclub/common/cache/redis"
+//
+// Register panics when driver is nil or scheme is already registered.
+func Register(scheme string, driver Driver) {
+	drivers.Lock()
+	defer drivers.Unlock()
+	if driver == nil {
+		panic("mot: nil cache driver " + scheme)
+	}
+	if _, has := drivers.m[scheme]; has {
+		panic("mot: cache driver " + scheme + " registered twice")
+	}
+	drivers.m[scheme] = driver
+}
+
+// Drivers returns the sorted schemes of the registered drivers.
+func Drivers() []string {
+	drivers.RLock()
+	defer drivers.RUnlock()
+	schemes := make([]string, 0, len(drivers.m))
+	for scheme := range drivers.m {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// OpenLevel opens a single cache level from its URI.
+func OpenLevel(uri string) (ICache, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	drivers.RLock()
+	driver, has := drivers.m[u.Scheme]
+	drivers.RUnlock()
+	if !has {
+		return nil, errors.Wrap(ErrUnknownDriver, u.Scheme)
+	}
+	return driver(u)
+}
+
+// Open opens the levels of uris, lowest first, and chains them as NewCache
+// does, or returns the level alone when there is only one. The levels already
+// opened are closed when one fails to open.
+func Open(uris []string) (ICache, error) {
+	if len(uris) == 0 {
+		return nil, ErrInvalidConfig
+	}
+	levels := make([]ICache, 0, len(uris))
+	closeAll := func() {
+		for _, level := range levels {
+			_ = level.Close()
+		}
+	}
+	for _, uri := range uris {
+		level, err := OpenLevel(uri)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		levels = append(levels, level)
+	}
+	if len(levels) == 1 {
+		return levels[0], nil
+	}
+	c, err := NewCache(levels)
+	if err != nil {
+		closeAll()
+	}
+	return c, err
+}
+
+// OpenConfig opens the chain of a config, such as a std.D read from a config
+// file, whose "levels" list the URIs of the levels as Open expects them.
+func OpenConfig(config map[string]interface{}) (ICache, error) {
+	var uris []string
+	switch levels := config["levels"].(type) {
+	case []string:
+		uris = levels
+	case []interface{}:
+		for _, level := range levels {
+			uri, ok := level.(string)
+			if !ok {
+				return nil, ErrInvalidConfig
+			}
+			uris = append(uris, uri)
+		}
+	default:
+		return nil, ErrInvalidConfig
+	}
+	return Open(uris)
+}
+
+// URIOptions reads the query options of a cache URI for its driver. Reading
+// an option marks it known, Err then reports the options that are invalid or
+// unknown to the driver.
+type URIOptions struct {
+	values url.Values
+	known  map[string]bool
+	err    error
+}
+
+func NewURIOptions(u *url.URL) *URIOptions {
+	return &URIOptions{values: u.Query(), known: make(map[string]bool)}
+}
+
+func (o *URIOptions) fail(name string, err error) {
+	if o.err == nil {
+		o.err = errors.Errorf("mot: invalid cache option %s: %v", name, err)
+	}
+}
+
+// Has reports whether the option name is set.
+func (o *URIOptions) Has(name string) bool {
+	o.known[name] = true
+	_, has := o.values[name]
+	return has
+}
+
+func (o *URIOptions) String(name string) string {
+	o.known[name] = true
+	return o.values.Get(name)
+}
+
+// Strings returns every value of the option name, which may be repeated.
+func (o *URIOptions) Strings(name string) []string {
+	o.known[name] = true
+	return o.values[name]
+}
+
+func (o *URIOptions) Int(name string) int {
+	return int(o.Int64(name))
+}
+
+func (o *URIOptions) Int64(name string) int64 {
+	s := o.String(name)
+	if s == "" {
+		return 0
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		o.fail(name, err)
+	}
+	return v
+}
+
+// Bool returns the option name, true when it is set without a value.
+func (o *URIOptions) Bool(name string) bool {
+	if !o.Has(name) {
+		return false
+	}
+	s := o.values.Get(name)
+	if s == "" {
+		return true
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		o.fail(name, err)
+	}
+	return v
+}
+
+// Duration returns the option name, written like time.ParseDuration expects.
+func (o *URIOptions) Duration(name string) time.Duration {
+	s := o.String(name)
+	if s == "" {
+		return 0
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		o.fail(name, err)
+	}
+	return v
+}
+
+// CodecOptions returns the codec, compression and compress_threshold options.
+func (o *URIOptions) CodecOptions() CodecOptions {
+	return CodecOptions{
+		Codec:             o.String("codec"),
+		Compression:       o.String("compression"),
+		CompressThreshold: o.Int("compress_threshold"),
+	}
+}
+
+// Err returns the first invalid option, or lists the options that were never read.
+func (o *URIOptions) Err() error {
+	if o.err != nil {
+		return o.err
+	}
+	var unknown []string
+	for name := range o.values {
+		if !o.known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return errors.Errorf("mot: unknown cache options %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package cache_test
+
+import (
+	"github.com/motclub/common/cache"
+	_ "github.com/motclub/common/cache/leveldb"
+	_ "github.com/motclub/common/cache/memory"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mot-open")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := cache.Open([]string{"memory://?size=10", "leveldb://" + dir + "?sweep_interval=1m"})
+	assert.Nil(t, err)
+	defer c.Close()
+	assert.NotNil(t, c.Parent())
+	assert.Nil(t, c.Set("a", 1))
+	assert.Equal(t, 1, c.Parent().GetInt("a"))
+
+	_, err = cache.Open([]string{"memcached://host"})
+	assert.Equal(t, cache.ErrUnknownDriver, errors.Cause(err))
+	_, err = cache.Open([]string{"memory://?size=ten"})
+	assert.NotNil(t, err)
+	_, err = cache.Open([]string{"memory://?sizes=10"})
+	assert.EqualError(t, err, "mot: unknown cache options sizes")
+	_, err = cache.Open(nil)
+	assert.Equal(t, cache.ErrInvalidConfig, err)
+	assert.Subset(t, cache.Drivers(), []string{"leveldb", "memory"})
+}
+
+func TestOpenConfig(t *testing.T) {
+	c, err := cache.OpenConfig(map[string]interface{}{
+		"levels": []interface{}{"memory://", "memory://?eviction=lfu"},
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, c.Parent())
+
+	_, err = cache.OpenConfig(map[string]interface{}{"levels": "memory://"})
+	assert.Equal(t, cache.ErrInvalidConfig, err)
+}
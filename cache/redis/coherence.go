@@ -0,0 +1,61 @@
+package redis
+
+import (
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/json"
+	"strings"
+)
+
+const (
+	// CoherenceInvalidate evicts the keys written on other nodes from the child levels.
+	CoherenceInvalidate = "invalidate"
+	// CoherenceUpdate evicts the keys written on other nodes from the child levels and reads them back.
+	CoherenceUpdate = "update"
+	// CoherenceNone leaves the child levels serving their copy until it expires. Deletions are still broadcast.
+	CoherenceNone = "none"
+)
+
+const coherenceOpSet = "set"
+
+// coherenceMessage announces the keys written by a node on redisDelKeysChannel.
+// Deletions keep the comma separated payload older nodes understand.
+type coherenceMessage struct {
+	Node string   `json:"node"`
+	Op   string   `json:"op"`
+	Keys []string `json:"keys"`
+}
+
+// changed announces that keys were written, when this is the top level of the chain.
+func (r *redisCache) changed(keys ...string) error {
+	if r.parent != nil || r.local || r.coherence == CoherenceNone || len(keys) == 0 {
+		return nil
+	}
+	return r.Publish(redisDelKeysChannel, json.Stringify(&coherenceMessage{
+		Node: r.node,
+		Op:   coherenceOpSet,
+		Keys: keys,
+	}, false))
+}
+
+// onKeysMessage updates the child levels of this node for a message of redisDelKeysChannel.
+func (r *redisCache) onKeysMessage(data string) {
+	if data == "" {
+		return
+	}
+	if !strings.HasPrefix(data, "{") {
+		cache.EvictChildren(r, strings.Split(data, ",")...)
+		return
+	}
+
+	var msg coherenceMessage
+	if err := json.Parse(data, &msg); err != nil || msg.Node == r.node {
+		return
+	}
+	switch r.coherence {
+	case CoherenceNone:
+	case CoherenceUpdate:
+		cache.RefreshChildren(r, msg.Keys...)
+	default:
+		cache.EvictChildren(r, msg.Keys...)
+	}
+}
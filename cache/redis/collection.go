@@ -0,0 +1,328 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/motclub/common/cache"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// wrongTypeHook reports the WRONGTYPE errors of the server as cache.ErrWrongType,
+// as the other backends do for operations against the wrong kind of value.
+type wrongTypeHook struct{}
+
+func wrongType(cmd redis.Cmder) {
+	if err := cmd.Err(); err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE") {
+		cmd.SetErr(cache.ErrWrongType)
+	}
+}
+
+func (wrongTypeHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (wrongTypeHook) AfterProcess(_ context.Context, cmd redis.Cmder) error {
+	wrongType(cmd)
+	return nil
+}
+
+func (wrongTypeHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (wrongTypeHook) AfterProcessPipeline(_ context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		wrongType(cmd)
+	}
+	return nil
+}
+
+// formatScore returns score as a ZRANGEBYSCORE bound.
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "+inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// members converts the members of a sorted set read from Redis.
+func members(zs []redis.Z) []cache.Z {
+	v := make([]cache.Z, len(zs))
+	for i, z := range zs {
+		v[i] = cache.Z{Member: fmt.Sprint(z.Member), Score: z.Score}
+	}
+	return v
+}
+
+// args formats values as the arguments of a command.
+func args(values []interface{}) ([]interface{}, error) {
+	formatted, err := cache.FormatArgs(values)
+	if err != nil {
+		return nil, err
+	}
+	v := make([]interface{}, len(formatted))
+	for i, s := range formatted {
+		v[i] = s
+	}
+	return v, nil
+}
+
+// popped returns the result of a command reading a single element.
+func popped(v string, err error) (string, bool, error) {
+	switch err {
+	case nil:
+		return v, true, nil
+	case redis.Nil:
+		return "", false, nil
+	}
+	return "", false, err
+}
+
+func (r *redisCache) HSet(key string, values map[string]interface{}) (int, error) {
+	if r.parent != nil {
+		return r.parent.HSet(key, values)
+	}
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	fields, err := cache.FormatFields(values)
+	if err != nil {
+		return 0, err
+	}
+	pairs := make([]interface{}, 0, 2*len(fields))
+	for name, value := range fields {
+		pairs = append(pairs, name, value)
+	}
+	n, err := r.rdb.HSet(r.context(), key, pairs...).Result()
+	return int(n), err
+}
+
+func (r *redisCache) HGet(key, field string) (string, bool, error) {
+	if r.parent != nil {
+		return r.parent.HGet(key, field)
+	}
+
+	return popped(r.rdb.HGet(r.context(), key, field).Result())
+}
+
+func (r *redisCache) HGetAll(key string) (map[string]string, error) {
+	if r.parent != nil {
+		return r.parent.HGetAll(key)
+	}
+
+	return r.rdb.HGetAll(r.context(), key).Result()
+}
+
+func (r *redisCache) HDel(key string, fields ...string) (int, error) {
+	if r.parent != nil {
+		return r.parent.HDel(key, fields...)
+	}
+	if len(fields) == 0 {
+		return 0, nil
+	}
+
+	n, err := r.rdb.HDel(r.context(), key, fields...).Result()
+	return int(n), err
+}
+
+func (r *redisCache) LPush(key string, values ...interface{}) (int, error) {
+	if r.parent != nil {
+		return r.parent.LPush(key, values...)
+	}
+	if len(values) == 0 {
+		n, err := r.rdb.LLen(r.context(), key).Result()
+		return int(n), err
+	}
+
+	v, err := args(values)
+	if err != nil {
+		return 0, err
+	}
+	n, err := r.rdb.LPush(r.context(), key, v...).Result()
+	return int(n), err
+}
+
+func (r *redisCache) RPush(key string, values ...interface{}) (int, error) {
+	if r.parent != nil {
+		return r.parent.RPush(key, values...)
+	}
+	if len(values) == 0 {
+		n, err := r.rdb.LLen(r.context(), key).Result()
+		return int(n), err
+	}
+
+	v, err := args(values)
+	if err != nil {
+		return 0, err
+	}
+	n, err := r.rdb.RPush(r.context(), key, v...).Result()
+	return int(n), err
+}
+
+func (r *redisCache) LPop(key string) (string, bool, error) {
+	if r.parent != nil {
+		return r.parent.LPop(key)
+	}
+
+	return popped(r.rdb.LPop(r.context(), key).Result())
+}
+
+func (r *redisCache) RPop(key string) (string, bool, error) {
+	if r.parent != nil {
+		return r.parent.RPop(key)
+	}
+
+	return popped(r.rdb.RPop(r.context(), key).Result())
+}
+
+func (r *redisCache) LRange(key string, start, stop int) ([]string, error) {
+	if r.parent != nil {
+		return r.parent.LRange(key, start, stop)
+	}
+
+	return r.rdb.LRange(r.context(), key, int64(start), int64(stop)).Result()
+}
+
+func (r *redisCache) SAdd(key string, members ...interface{}) (int, error) {
+	if r.parent != nil {
+		return r.parent.SAdd(key, members...)
+	}
+	if len(members) == 0 {
+		return 0, nil
+	}
+
+	v, err := args(members)
+	if err != nil {
+		return 0, err
+	}
+	n, err := r.rdb.SAdd(r.context(), key, v...).Result()
+	return int(n), err
+}
+
+func (r *redisCache) SRem(key string, members ...interface{}) (int, error) {
+	if r.parent != nil {
+		return r.parent.SRem(key, members...)
+	}
+	if len(members) == 0 {
+		return 0, nil
+	}
+
+	v, err := args(members)
+	if err != nil {
+		return 0, err
+	}
+	n, err := r.rdb.SRem(r.context(), key, v...).Result()
+	return int(n), err
+}
+
+func (r *redisCache) SIsMember(key string, member interface{}) (bool, error) {
+	if r.parent != nil {
+		return r.parent.SIsMember(key, member)
+	}
+
+	v, err := cache.FormatArg(member)
+	if err != nil {
+		return false, err
+	}
+	return r.rdb.SIsMember(r.context(), key, v).Result()
+}
+
+func (r *redisCache) SMembers(key string) ([]string, error) {
+	if r.parent != nil {
+		return r.parent.SMembers(key)
+	}
+
+	return r.rdb.SMembers(r.context(), key).Result()
+}
+
+func (r *redisCache) ZAdd(key string, members ...cache.Z) (int, error) {
+	if r.parent != nil {
+		return r.parent.ZAdd(key, members...)
+	}
+	if len(members) == 0 {
+		return 0, nil
+	}
+
+	zs := make([]*redis.Z, len(members))
+	for i, z := range members {
+		zs[i] = &redis.Z{Member: z.Member, Score: z.Score}
+	}
+	n, err := r.rdb.ZAdd(r.context(), key, zs...).Result()
+	return int(n), err
+}
+
+func (r *redisCache) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	if r.parent != nil {
+		return r.parent.ZIncrBy(key, increment, member)
+	}
+
+	return r.rdb.ZIncrBy(r.context(), key, increment, member).Result()
+}
+
+func (r *redisCache) ZRem(key string, members ...string) (int, error) {
+	if r.parent != nil {
+		return r.parent.ZRem(key, members...)
+	}
+	if len(members) == 0 {
+		return 0, nil
+	}
+
+	v := make([]interface{}, len(members))
+	for i, member := range members {
+		v[i] = member
+	}
+	n, err := r.rdb.ZRem(r.context(), key, v...).Result()
+	return int(n), err
+}
+
+func (r *redisCache) ZScore(key, member string) (float64, bool, error) {
+	if r.parent != nil {
+		return r.parent.ZScore(key, member)
+	}
+
+	v, err := r.rdb.ZScore(r.context(), key, member).Result()
+	switch err {
+	case nil:
+		return v, true, nil
+	case redis.Nil:
+		return 0, false, nil
+	}
+	return 0, false, err
+}
+
+func (r *redisCache) ZRange(key string, start, stop int) ([]cache.Z, error) {
+	if r.parent != nil {
+		return r.parent.ZRange(key, start, stop)
+	}
+
+	zs, err := r.rdb.ZRangeWithScores(r.context(), key, int64(start), int64(stop)).Result()
+	return members(zs), err
+}
+
+func (r *redisCache) ZRevRange(key string, start, stop int) ([]cache.Z, error) {
+	if r.parent != nil {
+		return r.parent.ZRevRange(key, start, stop)
+	}
+
+	zs, err := r.rdb.ZRevRangeWithScores(r.context(), key, int64(start), int64(stop)).Result()
+	return members(zs), err
+}
+
+func (r *redisCache) ZRangeByScore(key string, min, max float64) ([]cache.Z, error) {
+	if r.parent != nil {
+		return r.parent.ZRangeByScore(key, min, max)
+	}
+
+	zs, err := r.rdb.ZRangeByScoreWithScores(r.context(), key, &redis.ZRangeBy{
+		Min: formatScore(min),
+		Max: formatScore(max),
+	}).Result()
+	return members(zs), err
+}
@@ -0,0 +1,248 @@
+package redis
+
+import (
+	"github.com/go-redis/redis/v8"
+	"github.com/motclub/common/cache"
+	"time"
+)
+
+// maxTxRetries bounds the attempts of a transaction whose key keeps changing meanwhile.
+const maxTxRetries = 16
+
+func isWrongType(err error) bool {
+	return err == cache.ErrWrongType
+}
+
+// retime rewrites the envelope of key as fn changes it, deleting key when fn
+// returns false, and reports whether key exists. Values without an envelope,
+// such as counters and collections, only carry the expiration of Redis, which
+// native changes instead. The sets of the tags of key are extended to its new
+// expiration.
+func (r *redisCache) retime(key string, fn func(v *cache.Envelope) bool, native func(pipe redis.Pipeliner)) (bool, error) {
+	ctx := r.context()
+	var (
+		has  bool
+		tags []string
+		ttl  time.Duration
+	)
+	txf := func(tx *redis.Tx) error {
+		tags = nil
+		s, err := tx.Get(ctx, key).Result()
+		if has = err != redis.Nil; !has {
+			return nil
+		}
+		if err != nil && !isWrongType(err) {
+			return err
+		}
+		v, decodeErr := cache.DecodeEnvelope([]byte(s))
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			switch {
+			case decodeErr != nil:
+				if native != nil {
+					native(pipe)
+				}
+			case !fn(v):
+				pipe.Del(ctx, key)
+			default:
+				data, err := r.codec.Encode(v)
+				if err != nil {
+					return err
+				}
+				ttl = v.Remaining(time.Now())
+				pipe.Set(ctx, key, data, ttl)
+				tags = v.Tags
+			}
+			return nil
+		})
+		return err
+	}
+	var err error
+	for i := 0; i < maxTxRetries; i++ {
+		if err = r.rdb.Watch(ctx, txf, key); err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err == redis.TxFailedErr {
+		return false, err
+	}
+	if err != nil || len(tags) == 0 {
+		return has, err
+	}
+	ttls, err := r.tagTTLs(ctx, tags, ttl)
+	if err == nil {
+		_, err = r.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			expireTags(ctx, pipe, tags, ttls, ttl)
+			return nil
+		})
+	}
+	return true, err
+}
+
+func (r *redisCache) SetNX(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	var dur time.Duration
+	if len(expiration) > 0 {
+		dur = expiration[0]
+	}
+	if r.parent != nil {
+		ok, err := r.parent.SetNX(key, value, expiration...)
+		if ok && err == nil {
+			err = r.set(key, value, dur)
+		}
+		return ok, err
+	}
+
+	v, err := r.encode(value, dur)
+	if err != nil {
+		return false, err
+	}
+	ok, err := r.rdb.SetNX(r.context(), key, v, dur).Result()
+	if ok && err == nil {
+		err = r.changed(key)
+	}
+	return ok, err
+}
+
+func (r *redisCache) SetXX(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	var dur time.Duration
+	if len(expiration) > 0 {
+		dur = expiration[0]
+	}
+	if r.parent != nil {
+		ok, err := r.parent.SetXX(key, value, expiration...)
+		if ok && err == nil {
+			err = r.set(key, value, dur)
+		}
+		return ok, err
+	}
+
+	v, err := r.encode(value, dur)
+	if err != nil {
+		return false, err
+	}
+	ok, err := r.rdb.SetXX(r.context(), key, v, dur).Result()
+	if ok && err == nil {
+		err = r.changed(key)
+	}
+	return ok, err
+}
+
+func (r *redisCache) GetSet(key string, value interface{}, dst interface{}) (bool, error) {
+	if r.parent != nil {
+		has, err := r.parent.GetSet(key, value, dst)
+		if err == nil {
+			err = r.set(key, value, 0)
+		}
+		return has, err
+	}
+
+	v, err := r.encode(value, 0)
+	if err != nil {
+		return false, err
+	}
+	s, err := r.rdb.GetSet(r.context(), key, v).Result()
+	has := err == nil
+	if err == redis.Nil {
+		err = nil
+	}
+	if err == nil {
+		err = r.changed(key)
+	}
+	if has && err == nil {
+		old := decode(s)
+		err = cache.Unmarshal(old.Codec, old.Data, dst)
+	}
+	return has, err
+}
+
+func (r *redisCache) CompareAndSwap(key string, old, value interface{}, expiration ...time.Duration) (bool, error) {
+	var dur time.Duration
+	if len(expiration) > 0 {
+		dur = expiration[0]
+	}
+	if r.parent != nil {
+		ok, err := r.parent.CompareAndSwap(key, old, value, expiration...)
+		if ok && err == nil {
+			err = r.set(key, value, dur)
+		}
+		return ok, err
+	}
+
+	v, err := r.encode(value, dur)
+	if err != nil {
+		return false, err
+	}
+	ctx := r.context()
+	var ok bool
+	err = r.rdb.Watch(ctx, func(tx *redis.Tx) error {
+		s, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if ok, err = decode(s).Equal(old); err != nil || !ok {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, v, dur)
+			return nil
+		})
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		// the value changed since it was compared
+		return false, nil
+	}
+	if ok && err == nil {
+		err = r.changed(key)
+	}
+	return ok && err == nil, err
+}
+
+func (r *redisCache) Expire(key string, ttl time.Duration) (bool, error) {
+	has, err := r.retime(key, func(v *cache.Envelope) bool {
+		v.CreatedAt = time.Now()
+		v.ExpiredDuration = ttl
+		return ttl > 0
+	}, func(pipe redis.Pipeliner) {
+		pipe.PExpire(r.context(), key, ttl)
+	})
+	if err == nil && r.parent != nil {
+		return r.parent.Expire(key, ttl)
+	}
+	if has && err == nil {
+		err = r.changed(key)
+	}
+	return has, err
+}
+
+func (r *redisCache) ExpireAt(key string, at time.Time) (bool, error) {
+	return r.Expire(key, time.Until(at))
+}
+
+func (r *redisCache) Persist(key string) (bool, error) {
+	has, err := r.retime(key, func(v *cache.Envelope) bool {
+		v.ExpiredDuration = 0
+		return true
+	}, func(pipe redis.Pipeliner) {
+		pipe.Persist(r.context(), key)
+	})
+	if err == nil && r.parent != nil {
+		return r.parent.Persist(key)
+	}
+	if has && err == nil {
+		err = r.changed(key)
+	}
+	return has, err
+}
+
+func (r *redisCache) Touch(key string) (bool, error) {
+	has, err := r.retime(key, func(v *cache.Envelope) bool {
+		v.CreatedAt = time.Now()
+		return true
+	}, nil)
+	if err == nil && r.parent != nil {
+		return r.parent.Touch(key)
+	}
+	return has, err
+}
@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"github.com/go-redis/redis/v8"
+	"github.com/motclub/common/cache"
+	"net/url"
+)
+
+func init() {
+	cache.Register("redis", Open)
+	cache.Register("rediss", Open)
+}
+
+// Open opens a Redis cache from a URI such as
+// "redis://:password@host:6379/0?coherence=update&codec=msgpack", or rediss://
+// for TLS. Repeated addr options add the other nodes of a cluster, or the
+// sentinels along with master_name. The pool_size, dial_timeout, read_timeout
+// and write_timeout options tune the client.
+func Open(u *url.URL) (cache.ICache, error) {
+	q := cache.NewURIOptions(u)
+	o := &Options{
+		CodecOptions:         q.CodecOptions(),
+		Coherence:            q.String("coherence"),
+		NodeID:               q.String("node_id"),
+		NotifyKeyspaceEvents: q.String("notify_keyspace_events"),
+	}
+	addrs := q.Strings("addr")
+	masterName := q.String("master_name")
+	poolSize := q.Int("pool_size")
+	dialTimeout := q.Duration("dial_timeout")
+	readTimeout := q.Duration("read_timeout")
+	writeTimeout := q.Duration("write_timeout")
+	if err := q.Err(); err != nil {
+		return nil, err
+	}
+
+	base := *u
+	base.RawQuery = ""
+	ro, err := redis.ParseURL(base.String())
+	if err != nil {
+		return nil, err
+	}
+	return NewRedisCache(&redis.UniversalOptions{
+		Addrs:        append([]string{ro.Addr}, addrs...),
+		DB:           ro.DB,
+		Username:     ro.Username,
+		Password:     ro.Password,
+		TLSConfig:    ro.TLSConfig,
+		MasterName:   masterName,
+		PoolSize:     poolSize,
+		DialTimeout:  dialTimeout,
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+	}, o)
+}
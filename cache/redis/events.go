@@ -0,0 +1,53 @@
+package redis
+
+import (
+	"github.com/motclub/common/cache"
+	"strings"
+)
+
+const (
+	// redisExpiredChannel is the keyevent channel of the keys Redis expires, in any database.
+	redisExpiredChannel = "__keyevent@*__:expired"
+	// redisKeyspacePrefix starts the keyspace channel of a key, in any database.
+	redisKeyspacePrefix = "__keyspace@*__:"
+)
+
+// keyspaceKey returns the key of a keyspace notification channel.
+func keyspaceKey(channel string) string {
+	if i := strings.Index(channel, "__:"); i >= 0 {
+		return channel[i+3:]
+	}
+	return channel
+}
+
+// OnExpire relies on the keyspace notifications of Redis, which must include
+// the expired events ("Ex", see Options.NotifyKeyspaceEvents). In a cluster
+// only the keys of the node subscribed to are notified.
+func (r *redisCache) OnExpire(pattern string, handler func(key string)) error {
+	if r.parent != nil {
+		return r.parent.OnExpire(pattern, handler)
+	}
+
+	_, err := r.PSubscribe([]string{redisExpiredChannel}, func(_ string, key string) {
+		if !strings.HasPrefix(key, redisInternalPrefix) && cache.Match(pattern, key) {
+			handler(key)
+		}
+	})
+	return err
+}
+
+// OnChange relies on the keyspace notifications of Redis, which must include
+// the keyspace events of the wanted commands ("KA", see Options.NotifyKeyspaceEvents).
+// Events are named after the Redis commands, so collections report theirs, such as hset.
+func (r *redisCache) OnChange(pattern string, handler func(key, event string)) error {
+	if r.parent != nil {
+		return r.parent.OnChange(pattern, handler)
+	}
+
+	_, err := r.PSubscribe([]string{redisKeyspacePrefix + pattern}, func(channel string, event string) {
+		if key := keyspaceKey(channel); !strings.HasPrefix(key, redisInternalPrefix) {
+			handler(key, event)
+		}
+	})
+	return err
+}
@@ -0,0 +1,84 @@
+package redis
+
+import (
+	"github.com/go-redis/redis/v8"
+	"github.com/motclub/common/cache"
+	"time"
+)
+
+const redisLockKeyPrefix = "__MOT_LOCK__:"
+
+var (
+	redisUnlockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+	redisExtendScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+func (r *redisCache) Lock(key string, ttl time.Duration) (cache.ILock, error) {
+	if r.parent != nil {
+		return r.parent.Lock(key, ttl)
+	}
+	if ttl <= 0 {
+		// SET NX without an expiration would never release the lock of a crashed holder
+		return nil, cache.ErrInvalidLockTTL
+	}
+
+	token, err := cache.NewLockToken()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := r.rdb.SetNX(r.context(), redisLockKeyPrefix+key, token, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, cache.ErrLockNotObtained
+	}
+	return &redisLock{cache: r, key: key, token: token}, nil
+}
+
+type redisLock struct {
+	cache *redisCache
+	key   string
+	token string
+}
+
+func (l *redisLock) Key() string {
+	return l.key
+}
+
+func (l *redisLock) Token() string {
+	return l.token
+}
+
+func (l *redisLock) Unlock() error {
+	n, err := redisUnlockScript.Run(l.cache.context(), l.cache.rdb, []string{redisLockKeyPrefix + l.key}, l.token).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return cache.ErrLockNotHeld
+	}
+	return nil
+}
+
+func (l *redisLock) Extend(ttl time.Duration) error {
+	if ttl <= 0 {
+		return cache.ErrInvalidLockTTL
+	}
+	n, err := redisExtendScript.Run(l.cache.context(), l.cache.rdb, []string{redisLockKeyPrefix + l.key}, l.token, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return cache.ErrLockNotHeld
+	}
+	return nil
+}
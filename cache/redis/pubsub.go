@@ -0,0 +1,90 @@
+package redis
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/motclub/common/cache"
+	"net"
+	"time"
+)
+
+const (
+	// pubsubHealthCheck is how long a subscription waits for a message before
+	// pinging the server, which detects the connections lost silently.
+	pubsubHealthCheck = 3 * time.Second
+	// maxReconnectBackoff bounds the wait between two attempts to reconnect.
+	maxReconnectBackoff = 5 * time.Second
+)
+
+func isTimeout(err error) bool {
+	e, ok := err.(net.Error)
+	return ok && e.Timeout()
+}
+
+func (r *redisCache) Subscribe(channels []string, handler func(string, string), options ...*cache.SubscribeOptions) (cache.ISubscription, error) {
+	return r.subscribe(r.rdb.Subscribe(r.context(), channels...), handler, options)
+}
+
+func (r *redisCache) PSubscribe(patterns []string, handler func(string, string), options ...*cache.SubscribeOptions) (cache.ISubscription, error) {
+	return r.subscribe(r.rdb.PSubscribe(r.context(), patterns...), handler, options)
+}
+
+// subscribe waits for ps to be subscribed, then delivers its messages to handler.
+func (r *redisCache) subscribe(ps *redis.PubSub, handler func(string, string), options []*cache.SubscribeOptions) (cache.ISubscription, error) {
+	if _, err := ps.Receive(r.context()); err != nil {
+		_ = ps.Close()
+		return nil, err
+	}
+	sub := cache.NewSubscription(handler, ps.Close, options...)
+	go r.receive(ps, sub)
+	return sub, nil
+}
+
+// receive delivers the messages of ps to sub until either is closed, or the
+// cache is. A lost connection is reopened by ps, which subscribes again.
+func (r *redisCache) receive(ps *redis.PubSub, sub *cache.Subscription) {
+	ctx := context.Background()
+	var backoff time.Duration
+	for {
+		select {
+		case <-sub.Done():
+			return
+		case <-r.done.Done():
+			sub.Stop(cache.ErrCacheClosed)
+			return
+		default:
+		}
+
+		msg, err := ps.ReceiveTimeout(ctx, pubsubHealthCheck)
+		if err != nil && isTimeout(err) {
+			err = ps.Ping(ctx)
+		}
+		if err == redis.ErrClosed {
+			select {
+			case <-sub.Done():
+			default:
+				sub.Stop(err)
+			}
+			return
+		}
+		if err != nil {
+			sub.Disconnected(err)
+			if backoff += 100 * time.Millisecond; backoff > maxReconnectBackoff {
+				backoff = maxReconnectBackoff
+			}
+			select {
+			case <-time.After(backoff):
+			case <-sub.Done():
+			}
+			continue
+		}
+
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			backoff = 0
+			sub.Reconnected()
+		case *redis.Message:
+			sub.Deliver(msg.Channel, msg.Payload)
+		}
+	}
+}
@@ -6,37 +6,166 @@ import (
 	"github.com/go-redis/redis/v8"
 	"github.com/motclub/common/cache"
 	"github.com/motclub/common/json"
+	"github.com/pkg/errors"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-const redisDelKeysChannel = "__MOT_DEL_KEYS_CHANNEL__"
+const (
+	redisDelKeysChannel = "__MOT_DEL_KEYS_CHANNEL__"
+	redisTagKeyPrefix   = "__MOT_TAG__:"
+	// redisInternalPrefix starts the keys of locks, tags and other bookkeeping, hidden from key scans.
+	redisInternalPrefix = "__MOT_"
+)
 
-func NewRedisCache(opts *redis.UniversalOptions) (cache.ICache, error) {
+var ErrCacheUnsupportedCoherence = errors.New(`mot: unsupported coherence mode`)
+
+type Options struct {
+	// CodecOptions select how values are encoded and compressed.
+	cache.CodecOptions
+	// Coherence is how the child levels follow the keys written on other nodes, CoherenceInvalidate by default.
+	Coherence string `json:"coherence"`
+	// NodeID identifies this node in coherence messages, random by default.
+	NodeID string `json:"node_id"`
+	// NotifyKeyspaceEvents, when set, is written to the notify-keyspace-events
+	// setting of the server, which OnExpire and OnChange rely on, e.g. "KEA".
+	NotifyKeyspaceEvents string `json:"notify_keyspace_events"`
+}
+
+func NewRedisCache(opts *redis.UniversalOptions, options ...*Options) (cache.ICache, error) {
+	o := resolveOptions(options)
+	switch o.Coherence {
+	case "":
+		o.Coherence = CoherenceInvalidate
+	case CoherenceInvalidate, CoherenceUpdate, CoherenceNone:
+	default:
+		return nil, ErrCacheUnsupportedCoherence
+	}
+	if o.NodeID == "" {
+		id, err := cache.NewLockToken()
+		if err != nil {
+			return nil, err
+		}
+		o.NodeID = id
+	}
+	codec, err := cache.NewEnvelopeCodec(&o.CodecOptions)
+	if err != nil {
+		return nil, err
+	}
 	cmd := redis.NewUniversalClient(opts)
+	cmd.AddHook(wrongTypeHook{})
 	if _, err := cmd.Ping(context.Background()).Result(); err != nil {
 		return nil, err
 	}
-	cache := &redisCache{rdb: cmd}
-	err := cache.Subscribe([]string{redisDelKeysChannel}, func(channel string, data string) {
-		if data == "" {
-			return
+	if o.NotifyKeyspaceEvents != "" {
+		if err := cmd.ConfigSet(context.Background(), "notify-keyspace-events", o.NotifyKeyspaceEvents).Err(); err != nil {
+			return nil, err
 		}
+	}
+	c := &redisCache{
+		rdb:       cmd,
+		stats:     cache.NewStatsRecorder("redis"),
+		codec:     codec,
+		coherence: o.Coherence,
+		node:      o.NodeID,
+	}
+	c.done, c.stop = context.WithCancel(context.Background())
+	_, err = c.Subscribe([]string{redisDelKeysChannel}, func(channel string, data string) {
+		c.onKeysMessage(data)
+	})
+	return c, err
+}
 
-		if cache.children != nil {
-			keys := strings.Split(data, ",")
-			_ = cache.children.Del(keys...)
+func resolveOptions(options []*Options) *Options {
+	var o Options
+	if len(options) > 0 && options[0] != nil {
+		o = *options[0]
+	}
+	return &o
+}
+
+// redisCacheValue is the JSON envelope written before values carried a codec header.
+type redisCacheValue struct {
+	ExpiredDuration time.Duration   `json:"expired_duration"`
+	CreatedAt       time.Time       `json:"created_at"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// decode reads a stored value, in either the current or the legacy JSON envelope.
+// Values written by INCR and friends are stored bare instead of in an envelope.
+func decode(s string) *cache.Envelope {
+	if cache.IsEnvelope([]byte(s)) {
+		if v, err := cache.DecodeEnvelope([]byte(s)); err == nil {
+			return v
 		}
-	})
-	return cache, err
+	} else {
+		var v redisCacheValue
+		if err := json.Parse(s, &v); err == nil && v.Data != nil {
+			return &cache.Envelope{
+				ExpiredDuration: v.ExpiredDuration,
+				CreatedAt:       v.CreatedAt,
+				Codec:           cache.CodecJSON,
+				Data:            v.Data,
+			}
+		}
+	}
+	return &cache.Envelope{Codec: cache.CodecRaw, Data: []byte(s)}
 }
 
 type redisCache struct {
-	rdb      redis.UniversalClient
+	rdb   redis.UniversalClient
+	stats *cache.StatsRecorder
+	codec *cache.EnvelopeCodec
+	// coherence and node are the coherence mode and the ID of this node.
+	coherence string
+	node      string
+	ctx       context.Context
+	// done is cancelled by Close, ending the subscriptions.
+	done     context.Context
+	stop     context.CancelFunc
+	local    bool
 	parent   cache.ICache
 	children cache.ICache
 }
 
+func (r *redisCache) context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+func (r *redisCache) WithContext(ctx context.Context) cache.ICache {
+	c := *r
+	c.ctx = ctx
+	if r.parent != nil {
+		c.parent = r.parent.WithContext(ctx)
+	}
+	return &c
+}
+
+func (r *redisCache) Stats() cache.Stats {
+	return r.stats.Stats()
+}
+
+func (r *redisCache) get(key string) (string, error) {
+	defer r.stats.Observe(cache.OpGet, time.Now())
+	s, err := r.rdb.Get(r.context(), key).Result()
+	switch err {
+	case nil:
+		r.stats.Hit()
+	case redis.Nil:
+		r.stats.Miss()
+	default:
+		r.stats.Miss()
+		r.stats.Error()
+	}
+	return s, err
+}
+
 func (r *redisCache) SetParent(parent cache.ICache) {
 	if r.parent == nil {
 		r.parent = parent
@@ -50,93 +179,53 @@ func (r *redisCache) SetChildren(children cache.ICache) {
 }
 
 func (r *redisCache) Publish(channel string, message interface{}) error {
-	return r.rdb.Publish(context.Background(), channel, message).Err()
+	return r.rdb.Publish(r.context(), channel, message).Err()
 }
 
-func (r *redisCache) Subscribe(channels []string, handler func(string, string)) error {
-	ps := r.rdb.Subscribe(context.Background(), channels...)
-	if _, err := ps.Receive(context.Background()); err != nil {
-		return err
-	}
-	ch := ps.Channel()
-	go func(ch <-chan *redis.Message) {
-		for msg := range ch {
-			handler(msg.Channel, msg.Payload)
+func (r *redisCache) TTL(path string) (time.Duration, bool) {
+	dur, err := r.rdb.PTTL(r.context(), path).Result()
+	if err != nil || dur == -2 {
+		if r.parent != nil {
+			return r.parent.TTL(path)
 		}
-	}(ch)
-	return nil
-}
-
-func (r *redisCache) PSubscribe(patterns []string, handler func(string, string)) error {
-	pubsub := r.rdb.PSubscribe(context.Background(), patterns...)
-	if _, err := pubsub.Receive(context.Background()); err != nil {
-		return err
+		return 0, false
 	}
-	ch := pubsub.Channel()
-	go func(ch <-chan *redis.Message) {
-		for msg := range ch {
-			handler(msg.Channel, msg.Payload)
-		}
-	}(ch)
-	return nil
-}
-
-func (r *redisCache) TTL(path string) (time.Duration, bool) {
-	dur, err := r.rdb.TTL(context.Background(), path).Result()
-	return dur, err == nil
+	if dur < 0 {
+		// the key exists but has no associated expire
+		return 0, true
+	}
+	return dur, true
 }
 
 func (r *redisCache) Has(key string) bool {
-	has := r.rdb.Exists(context.Background(), key).Val() > 1
+	has := r.rdb.Exists(r.context(), key).Val() > 0
 	if !has && r.parent != nil {
+		r.stats.Fallthrough()
 		has = r.parent.Has(key)
 	}
 	return has
 }
 
 func (r *redisCache) HasGet(key string, dst interface{}) bool {
-	s, err := r.rdb.Get(context.Background(), key).Result()
+	s, err := r.get(key)
 	has := err == nil
-	if has && s != "" {
-		var v struct {
-			ExpiredDuration int64       `json:"expired_duration"`
-			CreatedAt       time.Time   `json:"created_at"`
-			Data            interface{} `json:"data"`
-		}
-		if err = json.Parse(s, &v); err == nil {
-			err = json.Copy(v.Data, dst)
-		}
+	if has {
+		v := decode(s)
+		_ = cache.Unmarshal(v.Codec, v.Data, dst)
 	} else if r.parent != nil {
-		has = r.parent.HasGet(key, dst)
-		var ttl time.Duration
-		ttl, has = r.parent.TTL(key)
-		if has {
-			_ = r.Set(key, dst, ttl)
+		r.stats.Fallthrough()
+		if has = r.parent.HasGet(key, dst); has {
+			ttl, _ := r.parent.TTL(key)
+			_ = r.set(key, dst, ttl)
 		}
 	}
 	return has
 }
 
 func (r *redisCache) HasGetInt(key string) (int, bool) {
-	s, err := r.rdb.Get(context.Background(), key).Result()
-	has := err == nil
-	if !has && r.parent != nil {
-		var v int
-		v, has = r.parent.HasGetInt(key)
-		var ttl time.Duration
-		ttl, has = r.parent.TTL(key)
-		if has {
-			_ = r.Set(key, v, ttl)
-		}
-		return v, has
-	}
-	var v struct {
-		ExpiredDuration int64     `json:"expired_duration"`
-		CreatedAt       time.Time `json:"created_at"`
-		Data            int       `json:"data"`
-	}
-	err = json.Parse(s, &v)
-	return v.Data, has
+	var v int
+	has := r.HasGet(key, &v)
+	return v, has
 }
 
 func (r *redisCache) HasGetInt8(key string) (int8, bool) {
@@ -185,25 +274,9 @@ func (r *redisCache) HasGetUint64(key string) (uint64, bool) {
 }
 
 func (r *redisCache) HasGetFloat(key string) (float64, bool) {
-	s, err := r.rdb.Get(context.Background(), key).Result()
-	has := err == nil
-	if !has && r.parent != nil {
-		var v float64
-		v, has = r.parent.HasGetFloat(key)
-		var ttl time.Duration
-		ttl, has = r.parent.TTL(key)
-		if has {
-			_ = r.Set(key, v, ttl)
-		}
-		return v, has
-	}
-	var v struct {
-		ExpiredDuration int64     `json:"expired_duration"`
-		CreatedAt       time.Time `json:"created_at"`
-		Data            float64   `json:"data"`
-	}
-	err = json.Parse(s, &v)
-	return v.Data, has
+	var v float64
+	has := r.HasGet(key, &v)
+	return v, has
 }
 
 func (r *redisCache) HasGetFloat32(key string) (float32, bool) {
@@ -216,47 +289,15 @@ func (r *redisCache) HasGetFloat64(key string) (float64, bool) {
 }
 
 func (r *redisCache) HasGetString(key string) (string, bool) {
-	s, err := r.rdb.Get(context.Background(), key).Result()
-	has := err == nil
-	if !has && r.parent != nil {
-		var v string
-		v, has = r.parent.HasGetString(key)
-		var ttl time.Duration
-		ttl, has = r.parent.TTL(key)
-		if has {
-			_ = r.Set(key, v, ttl)
-		}
-		return v, has
-	}
-	var v struct {
-		ExpiredDuration int64     `json:"expired_duration"`
-		CreatedAt       time.Time `json:"created_at"`
-		Data            string    `json:"data"`
-	}
-	err = json.Parse(s, &v)
-	return v.Data, has
+	var v string
+	has := r.HasGet(key, &v)
+	return v, has
 }
 
 func (r *redisCache) HasGetBool(key string) (bool, bool) {
-	s, err := r.rdb.Get(context.Background(), key).Result()
-	has := err == nil
-	if !has && r.parent != nil {
-		var v bool
-		v, has = r.parent.HasGetBool(key)
-		var ttl time.Duration
-		ttl, has = r.parent.TTL(key)
-		if has {
-			_ = r.Set(key, v, ttl)
-		}
-		return v, has
-	}
-	var v struct {
-		ExpiredDuration int64     `json:"expired_duration"`
-		CreatedAt       time.Time `json:"created_at"`
-		Data            bool      `json:"data"`
-	}
-	err = json.Parse(s, &v)
-	return v.Data, has
+	var v bool
+	has := r.HasGet(key, &v)
+	return v, has
 }
 
 func (r *redisCache) HasGetTime(key string) (time.Time, bool) {
@@ -467,6 +508,19 @@ func (r *redisCache) DefaultGetTime(key string, defaultValue time.Time) time.Tim
 	return defaultValue
 }
 
+func (r *redisCache) Local() cache.ICache {
+	c := *r
+	c.local = true
+	c.parent = nil
+	c.children = nil
+	return &c
+}
+
+// Identity identifies the cache by its client and its parent level.
+func (r *redisCache) Identity() interface{} {
+	return [2]interface{}{r.rdb, cache.Identity(r.parent)}
+}
+
 func (r *redisCache) Parent() cache.ICache {
 	return r.parent
 }
@@ -475,6 +529,146 @@ func (r *redisCache) Children() cache.ICache {
 	return r.children
 }
 
+func (r *redisCache) MGet(keys ...string) (map[string]*cache.Item, error) {
+	items, missing, err := r.mget(keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) == 0 || r.parent == nil {
+		return items, nil
+	}
+
+	r.stats.Fallthrough()
+	found, err := r.parent.MGet(missing...)
+	if err != nil || len(found) == 0 {
+		return items, err
+	}
+	var backfill []*cache.Item
+	for key, item := range found {
+		items[key] = item
+		backfill = append(backfill, item)
+	}
+	return items, r.setItems(backfill)
+}
+
+func (r *redisCache) MSet(values map[string]interface{}, expiration ...time.Duration) error {
+	var exp time.Duration
+	if len(expiration) > 0 {
+		exp = expiration[0]
+	}
+	items := make([]*cache.Item, 0, len(values))
+	for key, value := range values {
+		v, err := r.codec.Marshal(value, exp)
+		if err != nil {
+			return err
+		}
+		items = append(items, &cache.Item{Key: key, Value: v.Data, Codec: v.Codec, TTL: exp})
+	}
+	err := r.setItems(items)
+	if err == nil && r.parent != nil {
+		err = r.parent.MSet(values, expiration...)
+	} else if err == nil {
+		keys := make([]string, 0, len(items))
+		for _, item := range items {
+			keys = append(keys, item.Key)
+		}
+		err = r.changed(keys...)
+	}
+	return err
+}
+
+// mget reads keys from this level in a single pipeline, returning the items found and the keys missing.
+func (r *redisCache) mget(keys []string) (map[string]*cache.Item, []string, error) {
+	items := make(map[string]*cache.Item, len(keys))
+	if len(keys) == 0 {
+		return items, nil, nil
+	}
+
+	start := time.Now()
+	pipe := r.rdb.Pipeline()
+	gets := make([]*redis.StringCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	for i, key := range keys {
+		gets[i] = pipe.Get(r.context(), key)
+		ttls[i] = pipe.PTTL(r.context(), key)
+	}
+	// the errors are checked per command below
+	_, _ = pipe.Exec(r.context())
+	r.stats.Observe(cache.OpGet, start)
+
+	var missing []string
+	for i, key := range keys {
+		s, err := gets[i].Result()
+		switch {
+		case err == redis.Nil:
+			r.stats.Miss()
+			missing = append(missing, key)
+			continue
+		case isWrongType(err):
+			// collections are not values
+			continue
+		case err != nil:
+			r.stats.Error()
+			return nil, nil, err
+		}
+		r.stats.Hit()
+		ttl := ttls[i].Val()
+		if ttl < 0 {
+			ttl = 0
+		}
+		v := decode(s)
+		items[key] = &cache.Item{Key: key, Value: v.Data, Codec: v.Codec, TTL: ttl}
+	}
+	return items, missing, nil
+}
+
+func (r *redisCache) SetItems(items ...*cache.Item) error {
+	err := r.setItems(items)
+	if err == nil && r.parent != nil {
+		err = cache.SetItems(r.parent, items...)
+	} else if err == nil {
+		keys := make([]string, len(items))
+		for i, item := range items {
+			keys[i] = item.Key
+		}
+		err = r.changed(keys...)
+	}
+	return err
+}
+
+// setItems writes items to this level in a single pipeline.
+func (r *redisCache) setItems(items []*cache.Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	defer r.stats.Observe(cache.OpSet, time.Now())
+	now := time.Now()
+	pipe := r.rdb.Pipeline()
+	for _, item := range items {
+		// keep the codec the item was encoded with, the envelope records it
+		v, err := r.codec.Encode(&cache.Envelope{
+			ExpiredDuration: item.TTL,
+			CreatedAt:       now,
+			Codec:           item.Codec,
+			Data:            item.Value,
+		})
+		if err != nil {
+			return err
+		}
+		pipe.Set(r.context(), item.Key, v, item.TTL)
+	}
+	if _, err := pipe.Exec(r.context()); err != nil {
+		r.stats.Error()
+		return err
+	}
+	r.stats.Set(len(items))
+	return nil
+}
+
+func (r *redisCache) GetOrLoad(key string, dst interface{}, ttl time.Duration, loader cache.LoaderFunc) error {
+	return cache.GetOrLoad(r, key, dst, ttl, loader)
+}
+
 func (r *redisCache) HasPrefix(s string, limit ...int) (map[string]string, error) {
 	v, err := r.contains(fmt.Sprintf("%s*", s), limit...)
 
@@ -510,30 +704,43 @@ func (r *redisCache) Set(key string, value interface{}, expiration ...time.Durat
 	if len(expiration) > 0 {
 		dur = expiration[0]
 	}
-	cv := struct {
-		ExpiredDuration time.Duration `json:"expired_duration"`
-		CreatedAt       time.Time     `json:"created_at"`
-		Data            interface{}   `json:"data"`
-	}{
-		ExpiredDuration: dur,
-		CreatedAt:       time.Now(),
-		Data:            value,
-	}
-	v := json.Stringify(&cv, false)
-	err := r.rdb.Set(context.Background(), key, v, dur).Err()
+	err := r.set(key, value, dur)
 	if err == nil && r.parent != nil {
 		err = r.parent.Set(key, value, expiration...)
+	} else if err == nil {
+		err = r.changed(key)
 	}
 	return err
 }
 
+func (r *redisCache) set(key string, value interface{}, expiration time.Duration) error {
+	v, err := r.encode(value, expiration)
+	if err != nil {
+		return err
+	}
+	defer r.stats.Observe(cache.OpSet, time.Now())
+	if err := r.rdb.Set(r.context(), key, v, expiration).Err(); err != nil {
+		r.stats.Error()
+		return err
+	}
+	r.stats.Set(1)
+	return nil
+}
+
+func (r *redisCache) encode(value interface{}, expiration time.Duration) ([]byte, error) {
+	cv, err := r.codec.Marshal(value, expiration)
+	if err != nil {
+		return nil, err
+	}
+	return r.codec.Encode(cv)
+}
+
 func (r *redisCache) Incr(key string) (int, error) {
 	if r.parent != nil {
 		return r.parent.Incr(key)
 	}
 
-	v, err := r.rdb.Incr(context.Background(), key).Result()
-	return int(v), err
+	return r.IncrBy(key, 1)
 }
 
 func (r *redisCache) IncrBy(key string, step int) (int, error) {
@@ -541,7 +748,19 @@ func (r *redisCache) IncrBy(key string, step int) (int, error) {
 		return r.parent.IncrBy(key, step)
 	}
 
-	v, err := r.rdb.IncrBy(context.Background(), key, int64(step)).Result()
+	v, err := r.rdb.IncrBy(r.context(), key, int64(step)).Result()
+	if isNotNumber(err) {
+		err = r.recount(key, err, func(e *cache.Envelope) (string, bool) {
+			if e.Item(key, time.Now()).Bind(&v) != nil {
+				return "", false
+			}
+			v += int64(step)
+			return strconv.FormatInt(v, 10), true
+		})
+	}
+	if err == nil {
+		err = r.incremented(key)
+	}
 	return int(v), err
 }
 
@@ -550,22 +769,98 @@ func (r *redisCache) IncrByFloat(key string, step float64) (float64, error) {
 		return r.parent.IncrByFloat(key, step)
 	}
 
-	return r.rdb.IncrByFloat(context.Background(), key, step).Result()
+	v, err := r.rdb.IncrByFloat(r.context(), key, step).Result()
+	if isNotNumber(err) {
+		err = r.recount(key, err, func(e *cache.Envelope) (string, bool) {
+			if e.Item(key, time.Now()).Bind(&v) != nil {
+				return "", false
+			}
+			v += step
+			return strconv.FormatFloat(v, 'f', -1, 64), true
+		})
+	}
+	if err == nil {
+		err = r.incremented(key)
+	}
+	return v, err
+}
+
+// isNotNumber reports whether err is the error of INCR and friends against a
+// value that is not a bare number, such as the envelope of a value set by Set.
+func isNotNumber(err error) bool {
+	return err != nil && (strings.HasPrefix(err.Error(), "ERR value is not an integer") ||
+		strings.HasPrefix(err.Error(), "ERR value is not a valid float"))
+}
+
+// recount replaces the envelope of key, written by Set, with the bare counter
+// next returns from it, keeping its expiration, so that counters keep counting
+// from the values that were set. It fails with notNumber when key holds no
+// envelope or next cannot read a number from it.
+func (r *redisCache) recount(key string, notNumber error, next func(e *cache.Envelope) (string, bool)) error {
+	ctx := r.context()
+	txf := func(tx *redis.Tx) error {
+		s, err := tx.Get(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		e, err := cache.DecodeEnvelope([]byte(s))
+		if err != nil {
+			return notNumber
+		}
+		v, ok := next(e)
+		if !ok {
+			return notNumber
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, v, e.Remaining(time.Now()))
+			return nil
+		})
+		return err
+	}
+	for i := 0; i < maxTxRetries; i++ {
+		if err := r.rdb.Watch(ctx, txf, key); err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return redis.TxFailedErr
+}
+
+// incremented evicts key from the child levels of this node, whose copy
+// counters never update, and announces the change to the other nodes.
+func (r *redisCache) incremented(key string) error {
+	cache.EvictChildren(r, key)
+	return r.changed(key)
 }
 
 func (r *redisCache) Del(keys ...string) error {
-	err := r.rdb.Del(context.Background(), keys...).Err()
+	if len(keys) == 0 {
+		return nil
+	}
+	start := time.Now()
+	n, err := r.rdb.Del(r.context(), keys...).Result()
+	if err != nil {
+		r.stats.Error()
+	}
+	r.stats.Delete(int(n))
+	r.stats.Observe(cache.OpDel, start)
 
 	if r.parent != nil {
 		err = r.parent.Del(keys...)
-	} else {
+	} else if !r.local {
 		err = r.Publish(redisDelKeysChannel, strings.Join(keys, ","))
 	}
 
 	return err
 }
 
+func (r *redisCache) Ping() error {
+	return r.rdb.Ping(r.context()).Err()
+}
+
 func (r *redisCache) Close() error {
+	if r.stop != nil {
+		r.stop()
+	}
 	if r.rdb != nil {
 		return r.rdb.Close()
 	}
@@ -573,10 +868,9 @@ func (r *redisCache) Close() error {
 }
 
 func (r *redisCache) contains(pattern string, limit ...int) (map[string]string, error) {
-
-	var count int64
+	var max int
 	if len(limit) > 0 {
-		count = int64(limit[0])
+		max = limit[0]
 	}
 
 	var (
@@ -585,30 +879,81 @@ func (r *redisCache) contains(pattern string, limit ...int) (map[string]string,
 	)
 
 	for {
-		var keys []string
-		var err error
-		keys, cursor, err = r.rdb.Scan(context.Background(), cursor, pattern, count).Result()
+		keys, next, err := r.rdb.Scan(r.context(), cursor, pattern, int64(max)).Result()
 		if err != nil {
 			return nil, err
 		}
-		for _, key := range keys {
-			s, err := r.rdb.Get(context.Background(), key).Result()
-			if err != nil {
-				return nil, err
-			}
-			var v struct {
-				ExpiredDuration int64     `json:"expired_duration"`
-				CreatedAt       time.Time `json:"created_at"`
-				Data            string    `json:"data"`
-			}
-			if err = json.Parse(s, &v); err == nil {
-				values[key] = v.Data
+		items, _, err := r.mget(userKeys(keys))
+		if err != nil {
+			return nil, err
+		}
+		for key, item := range items {
+			values[key] = cache.DataString(item.Codec, item.Value)
+			if max > 0 && len(values) >= max {
+				return values, nil
 			}
 		}
-		if cursor == 0 {
+		if cursor = next; cursor == 0 {
 			break
 		}
 	}
 
 	return values, nil
 }
+
+// userKeys filters out the keys the cache keeps for itself.
+func userKeys(keys []string) []string {
+	v := keys[:0]
+	for _, key := range keys {
+		if !strings.HasPrefix(key, redisInternalPrefix) {
+			v = append(v, key)
+		}
+	}
+	return v
+}
+
+func (r *redisCache) Scan(prefix, cursor string, limit int) ([]*cache.Item, string, error) {
+	if r.parent != nil {
+		return r.parent.Scan(prefix, cursor, limit)
+	}
+
+	var c uint64
+	if cursor != "" {
+		var err error
+		if c, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, "", cache.ErrInvalidCursor
+		}
+	}
+	keys, next, err := r.rdb.Scan(r.context(), c, cache.EscapePattern(prefix)+"*", int64(limit)).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	keys = userKeys(keys)
+	sort.Strings(keys)
+	found, _, err := r.mget(keys)
+	if err != nil {
+		return nil, "", err
+	}
+	items := make([]*cache.Item, 0, len(found))
+	for _, key := range keys {
+		// keys may expire between SCAN and GET
+		if item, has := found[key]; has {
+			items = append(items, item)
+		}
+	}
+	if next == 0 {
+		return items, "", nil
+	}
+	return items, strconv.FormatUint(next, 10), nil
+}
+
+var redisScripts sync.Map
+
+// Eval runs a Lua script, loading it once and then calling it by its SHA1.
+func (r *redisCache) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	s, ok := redisScripts.Load(script)
+	if !ok {
+		s, _ = redisScripts.LoadOrStore(script, redis.NewScript(script))
+	}
+	return s.(*redis.Script).Run(r.context(), r.rdb, keys, args...).Result()
+}
@@ -0,0 +1,192 @@
+package redis
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/cache/cachetest"
+	"github.com/motclub/common/cache/memory"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// newTestCache opens a cache against its own in-process Redis server.
+func newTestCache(t *testing.T) cache.ICache {
+	s, err := cachetest.NewRedisServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	c, err := NewRedisCache(&redis.UniversalOptions{Addrs: []string{s.Addr()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestRedisCache_Conformance(t *testing.T) {
+	cachetest.Run(t, newTestCache)
+}
+
+func TestRedisCache_TagSets(t *testing.T) {
+	c := newTestCache(t)
+	rdb := c.(*redisCache).rdb
+	ctx := context.Background()
+
+	// tag sets expire with the last of their keys
+	assert.Nil(t, c.SetWithTags("a", 1, []string{"t"}, time.Hour))
+	assert.Nil(t, c.SetWithTags("b", 1, []string{"t"}, time.Minute))
+	ttl := rdb.PTTL(ctx, tagKey("t")).Val()
+	assert.True(t, ttl > 59*time.Minute && ttl <= time.Hour, "ttl %v", ttl)
+	assert.Nil(t, c.SetWithTags("c", 1, []string{"t"}))
+	assert.Equal(t, time.Duration(-1), rdb.PTTL(ctx, tagKey("t")).Val())
+
+	// overwritten and deleted keys leave their tag sets when the tag is invalidated
+	assert.Nil(t, c.Set("a", 2))
+	assert.Nil(t, c.Del("b"))
+	assert.Equal(t, int64(3), rdb.SCard(ctx, tagKey("t")).Val())
+	assert.Nil(t, c.InvalidateTags("t"))
+	assert.Equal(t, int64(0), rdb.Exists(ctx, tagKey("t")).Val())
+	assert.Equal(t, 2, c.GetInt("a"))
+	assert.False(t, c.Has("c"))
+
+	// persisting a key keeps its tags
+	assert.Nil(t, c.SetWithTags("d", 1, []string{"u"}, time.Minute))
+	_, err := c.Persist("d")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(-1), rdb.PTTL(ctx, tagKey("u")).Val())
+	_, err = c.Expire("d", time.Hour)
+	assert.Nil(t, err)
+	assert.Nil(t, c.InvalidateTags("u"))
+	assert.False(t, c.Has("d"))
+}
+
+// TestRedisCache_UntaggedWrites checks that writing keys without tags takes
+// no transaction, which Redis Cluster refuses across slots.
+func TestRedisCache_UntaggedWrites(t *testing.T) {
+	c := newTestCache(t)
+	var cmds []string
+	c.(*redisCache).rdb.AddHook(&commandHook{names: &cmds})
+
+	assert.Nil(t, c.Set("a", 1))
+	assert.Nil(t, c.MSet(map[string]interface{}{"b": 2, "c": 3}))
+	assert.Nil(t, c.Del("a", "b"))
+	assert.NotContains(t, cmds, "watch")
+	assert.NotContains(t, cmds, "multi")
+}
+
+// commandHook records the names of the commands sent to the server.
+type commandHook struct {
+	names *[]string
+}
+
+func (h *commandHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	*h.names = append(*h.names, cmd.Name())
+	return ctx, nil
+}
+
+func (h *commandHook) AfterProcess(context.Context, redis.Cmder) error {
+	return nil
+}
+
+func (h *commandHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	for _, cmd := range cmds {
+		*h.names = append(*h.names, cmd.Name())
+	}
+	return ctx, nil
+}
+
+func (h *commandHook) AfterProcessPipeline(context.Context, []redis.Cmder) error {
+	return nil
+}
+
+func TestRedisCache_LockTTL(t *testing.T) {
+	c := newTestCache(t)
+	_, err := c.Lock("job", 0)
+	assert.Equal(t, cache.ErrInvalidLockTTL, err)
+	l, err := c.Lock("job", time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, cache.ErrInvalidLockTTL, l.Extend(-time.Second))
+	ttl := c.(*redisCache).rdb.PTTL(context.Background(), redisLockKeyPrefix+"job").Val()
+	assert.True(t, ttl > 0 && ttl <= time.Minute, "ttl %v", ttl)
+}
+
+func TestRedisCache_WithContext(t *testing.T) {
+	r := newTestCache(t)
+	l1, _ := memory.NewMemoryCache()
+	c, err := cache.NewCache([]cache.ICache{l1, r})
+	assert.Nil(t, err)
+	assert.Nil(t, c.Set("k", 1))
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	// the context reaches the Redis level, directly and through its child
+	assert.Equal(t, context.Canceled, r.WithContext(canceled).Set("k", 2))
+	assert.Equal(t, context.Canceled, c.WithContext(canceled).Set("k", 2))
+	_, err = c.WithContext(expired).Incr("n")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	_, err = c.WithContext(expired).Lock("lock", time.Second)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// the views leave the cache as it was, and a nil context is the background one
+	assert.Equal(t, 1, r.GetInt("k"))
+	assert.Nil(t, c.WithContext(nil).Set("k", 3))
+	assert.Equal(t, 3, r.GetInt("k"))
+}
+
+// newTestNode opens a node of a two level chain, a memory level below a Redis
+// level on the Redis server at addr, and returns the chain and its child level.
+func newTestNode(t *testing.T, addr, coherence string) (cache.ICache, cache.ICache) {
+	r, err := NewRedisCache(&redis.UniversalOptions{Addrs: []string{addr}}, &Options{Coherence: coherence})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	l1, _ := memory.NewMemoryCache()
+	c, err := cache.NewCache([]cache.ICache{l1, r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, l1.Local()
+}
+
+func TestRedisCache_Coherence(t *testing.T) {
+	s, err := cachetest.NewRedisServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, coherence := range []string{CoherenceInvalidate, CoherenceUpdate, CoherenceNone} {
+		t.Run(coherence, func(t *testing.T) {
+			a, childA := newTestNode(t, s.Addr(), coherence)
+			b, childB := newTestNode(t, s.Addr(), coherence)
+			key := coherence + ":k"
+			assert.Nil(t, a.Set(key, 1))
+			assert.Equal(t, 1, b.GetInt(key))
+			assert.Equal(t, 1, childB.GetInt(key))
+
+			assert.Nil(t, a.Set(key, 2))
+			switch coherence {
+			case CoherenceInvalidate:
+				assert.Eventually(t, func() bool { return !childB.Has(key) }, time.Second, 5*time.Millisecond)
+			case CoherenceUpdate:
+				assert.Eventually(t, func() bool { return childB.GetInt(key) == 2 }, time.Second, 5*time.Millisecond)
+			case CoherenceNone:
+				time.Sleep(50 * time.Millisecond)
+				assert.Equal(t, 1, childB.GetInt(key))
+			}
+			// the writer skips its own messages
+			assert.Equal(t, 2, childA.GetInt(key))
+
+			// deletions are broadcast whatever the mode
+			assert.Nil(t, a.Del(key))
+			assert.Eventually(t, func() bool { return !childB.Has(key) }, time.Second, 5*time.Millisecond)
+		})
+	}
+}
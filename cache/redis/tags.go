@@ -0,0 +1,215 @@
+package redis
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/motclub/common/cache"
+	"strings"
+	"time"
+)
+
+// tagKey returns the set listing the keys tagged with tag. The envelope of a
+// value records the tags it was set with, so that the keys set again without
+// the tag or deleted since, which the set still lists, are skipped and dropped
+// from it lazily by InvalidateTags instead of on every write.
+func tagKey(tag string) string {
+	return redisTagKeyPrefix + tag
+}
+
+// tagTTLs reads the remaining time to live of the sets of tags, -2 for the
+// missing ones and -1 for the ones that never expire, as PTTL reports. They
+// are only needed to extend the sets up to ttl, so none are read when ttl is 0.
+func (r *redisCache) tagTTLs(ctx context.Context, tags []string, ttl time.Duration) ([]time.Duration, error) {
+	ttls := make([]time.Duration, len(tags))
+	if ttl <= 0 || len(tags) == 0 {
+		return ttls, nil
+	}
+	cmds := make([]*redis.DurationCmd, len(tags))
+	_, err := r.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, tag := range tags {
+			cmds[i] = pipe.PTTL(ctx, tagKey(tag))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, cmd := range cmds {
+		ttls[i] = cmd.Val()
+	}
+	return ttls, nil
+}
+
+// expireTags makes the sets of tags live as long as a key expiring in ttl,
+// or never when ttl is 0, ttls being the ones tagTTLs read. The set of a tag
+// expires with the last of its keys, short of a write racing with this one.
+func expireTags(ctx context.Context, pipe redis.Pipeliner, tags []string, ttls []time.Duration, ttl time.Duration) {
+	for i, tag := range tags {
+		switch {
+		case ttl <= 0:
+			pipe.Persist(ctx, tagKey(tag))
+		case ttls[i] == -2 || ttls[i] >= 0 && ttls[i] < ttl:
+			pipe.PExpire(ctx, tagKey(tag), ttl)
+		}
+	}
+}
+
+// SetWithTags sets key with tags, which its envelope records, and adds key
+// to the set of each tag.
+func (r *redisCache) SetWithTags(key string, value interface{}, tags []string, expiration ...time.Duration) error {
+	if len(tags) == 0 {
+		return r.Set(key, value, expiration...)
+	}
+	var dur time.Duration
+	if len(expiration) > 0 {
+		dur = expiration[0]
+	}
+	e, err := r.codec.Marshal(value, dur)
+	if err != nil {
+		return err
+	}
+	e.Tags = tags
+	v, err := r.codec.Encode(e)
+	if err != nil {
+		return err
+	}
+	ctx := r.context()
+	start := time.Now()
+	ttls, err := r.tagTTLs(ctx, tags, dur)
+	if err == nil {
+		_, err = r.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, v, dur)
+			for _, tag := range tags {
+				pipe.SAdd(ctx, tagKey(tag), key)
+			}
+			expireTags(ctx, pipe, tags, ttls, dur)
+			return nil
+		})
+	}
+	r.stats.Observe(cache.OpSet, start)
+	if err != nil {
+		r.stats.Error()
+		return err
+	}
+	r.stats.Set(1)
+
+	if r.parent != nil {
+		return r.parent.SetWithTags(key, value, tags, expiration...)
+	}
+	return r.changed(key)
+}
+
+// carrying returns the keys whose value still carries one of tags.
+func (r *redisCache) carrying(ctx context.Context, keys []string, tags []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	gets := make([]*redis.StringCmd, len(keys))
+	// the errors are checked per command below
+	_, _ = r.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			gets[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	var carrying []string
+	for i, key := range keys {
+		s, err := gets[i].Result()
+		switch {
+		case err == redis.Nil || isWrongType(err):
+			continue
+		case err != nil:
+			return nil, err
+		}
+		if hasTag(decode(s).Tags, tags) {
+			carrying = append(carrying, key)
+		}
+	}
+	return carrying, nil
+}
+
+func hasTag(carried, tags []string) bool {
+	for _, tag := range carried {
+		for _, t := range tags {
+			if tag == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// InvalidateTags drops the keys carrying tags, and the keys it read from the
+// sets of tags. A key set again without the tags between the two may be
+// dropped as well. At the top level the dropped keys are broadcast on
+// redisDelKeysChannel so that every node evicts them from its child levels.
+func (r *redisCache) InvalidateTags(tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	ctx := r.context()
+	start := time.Now()
+	sets := make([]*redis.StringSliceCmd, len(tags))
+	_, err := r.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, tag := range tags {
+			sets[i] = pipe.SMembers(ctx, tagKey(tag))
+		}
+		return nil
+	})
+	if err != nil {
+		r.stats.Error()
+		return err
+	}
+	var members []string
+	seen := make(map[string]bool)
+	for _, set := range sets {
+		for _, key := range set.Val() {
+			if !seen[key] {
+				seen[key] = true
+				members = append(members, key)
+			}
+		}
+	}
+	keys, err := r.carrying(ctx, members, tags)
+	if err != nil {
+		r.stats.Error()
+		return err
+	}
+
+	var dels []*redis.IntCmd
+	if len(members) > 0 {
+		_, err = r.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, key := range keys {
+				dels = append(dels, pipe.Del(ctx, key))
+			}
+			for i, tag := range tags {
+				if read := sets[i].Val(); len(read) > 0 {
+					v := make([]interface{}, len(read))
+					for j, key := range read {
+						v[j] = key
+					}
+					pipe.SRem(ctx, tagKey(tag), v...)
+				}
+			}
+			return nil
+		})
+	}
+	r.stats.Observe(cache.OpDel, start)
+	if err != nil {
+		r.stats.Error()
+		return err
+	}
+	n := 0
+	for _, del := range dels {
+		n += int(del.Val())
+	}
+	r.stats.Delete(n)
+
+	if r.parent != nil {
+		return r.parent.InvalidateTags(tags...)
+	}
+	if !r.local && len(keys) > 0 {
+		return r.Publish(redisDelKeysChannel, strings.Join(keys, ","))
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package cache
+
+import (
+	"bytes"
+	"github.com/motclub/common/json"
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidCursor = errors.New(`mot: invalid scan cursor`)
+
+// ValueString returns JSON data as HasPrefix and friends report it: strings unquoted, any other value as is.
+func ValueString(data []byte) string {
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		var s string
+		if err := json.STD().Unmarshal(data, &s); err == nil {
+			return s
+		}
+	}
+	return string(data)
+}
@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	OpGet = "get"
+	OpSet = "set"
+	OpDel = "del"
+)
+
+// LatencyBuckets are the upper bounds of the latency histograms; slower operations fall in an extra overflow bucket.
+var LatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+type Histogram struct {
+	Buckets []time.Duration `json:"buckets"`
+	Counts  []uint64        `json:"counts"`
+	Count   uint64          `json:"count"`
+	Sum     time.Duration   `json:"sum"`
+}
+
+// Stats is a snapshot of the counters of a single cache level.
+type Stats struct {
+	Level        string               `json:"level"`
+	Hits         uint64               `json:"hits"`
+	Misses       uint64               `json:"misses"`
+	Fallthroughs uint64               `json:"fallthroughs"`
+	Sets         uint64               `json:"sets"`
+	Deletes      uint64               `json:"deletes"`
+	Evictions    uint64               `json:"evictions"`
+	Expirations  uint64               `json:"expirations"`
+	Errors       uint64               `json:"errors"`
+	Keys         int64                `json:"keys"`
+	Bytes        int64                `json:"bytes"`
+	Latency      map[string]Histogram `json:"latency"`
+}
+
+// ChainStats returns the stats of c and of every parent level above it, starting with c.
+func ChainStats(c ICache) []Stats {
+	var stats []Stats
+	for ; c != nil; c = c.Parent() {
+		stats = append(stats, c.Stats())
+	}
+	return stats
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    int64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(LatencyBuckets) && d > LatencyBuckets[i] {
+		i++
+	}
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+func (h *histogram) snapshot() Histogram {
+	v := Histogram{
+		Buckets: LatencyBuckets,
+		Counts:  make([]uint64, len(h.counts)),
+		Count:   atomic.LoadUint64(&h.count),
+		Sum:     time.Duration(atomic.LoadInt64(&h.sum)),
+	}
+	for i := range h.counts {
+		v.Counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+	return v
+}
+
+// StatsRecorder collects the counters of a cache level. It is safe for concurrent use.
+type StatsRecorder struct {
+	level        string
+	hits         uint64
+	misses       uint64
+	fallthroughs uint64
+	sets         uint64
+	deletes      uint64
+	evictions    uint64
+	expirations  uint64
+	errors       uint64
+	keys         int64
+	bytes        int64
+	latency      map[string]*histogram
+}
+
+func NewStatsRecorder(level string) *StatsRecorder {
+	s := &StatsRecorder{level: level, latency: make(map[string]*histogram)}
+	for _, op := range []string{OpGet, OpSet, OpDel} {
+		s.latency[op] = &histogram{counts: make([]uint64, len(LatencyBuckets)+1)}
+	}
+	return s
+}
+
+func (s *StatsRecorder) Hit() {
+	atomic.AddUint64(&s.hits, 1)
+}
+
+func (s *StatsRecorder) Miss() {
+	atomic.AddUint64(&s.misses, 1)
+}
+
+func (s *StatsRecorder) Fallthrough() {
+	atomic.AddUint64(&s.fallthroughs, 1)
+}
+
+func (s *StatsRecorder) Set(n int) {
+	atomic.AddUint64(&s.sets, uint64(n))
+}
+
+func (s *StatsRecorder) Delete(n int) {
+	atomic.AddUint64(&s.deletes, uint64(n))
+}
+
+func (s *StatsRecorder) Evict(n int) {
+	atomic.AddUint64(&s.evictions, uint64(n))
+}
+
+func (s *StatsRecorder) Expire(n int) {
+	atomic.AddUint64(&s.expirations, uint64(n))
+}
+
+func (s *StatsRecorder) Error() {
+	atomic.AddUint64(&s.errors, 1)
+}
+
+// Size records the number of keys stored by the level and their size in bytes.
+func (s *StatsRecorder) Size(keys, bytes int64) {
+	atomic.StoreInt64(&s.keys, keys)
+	atomic.StoreInt64(&s.bytes, bytes)
+}
+
+// Observe records the latency of op, measured from start.
+func (s *StatsRecorder) Observe(op string, start time.Time) {
+	if h, has := s.latency[op]; has {
+		h.observe(time.Since(start))
+	}
+}
+
+func (s *StatsRecorder) Stats() Stats {
+	v := Stats{
+		Level:        s.level,
+		Hits:         atomic.LoadUint64(&s.hits),
+		Misses:       atomic.LoadUint64(&s.misses),
+		Fallthroughs: atomic.LoadUint64(&s.fallthroughs),
+		Sets:         atomic.LoadUint64(&s.sets),
+		Deletes:      atomic.LoadUint64(&s.deletes),
+		Evictions:    atomic.LoadUint64(&s.evictions),
+		Expirations:  atomic.LoadUint64(&s.expirations),
+		Errors:       atomic.LoadUint64(&s.errors),
+		Keys:         atomic.LoadInt64(&s.keys),
+		Bytes:        atomic.LoadInt64(&s.bytes),
+		Latency:      make(map[string]Histogram, len(s.latency)),
+	}
+	for op, h := range s.latency {
+		v.Latency[op] = h.snapshot()
+	}
+	return v
+}
@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"github.com/motclub/common/logging"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+// ErrCacheClosed ends the subscriptions of a closed cache.
+var ErrCacheClosed = errors.New(`mot: cache closed`)
+
+// ISubscription is a subscription to pub/sub channels, returned by Subscribe and PSubscribe.
+type ISubscription interface {
+	// Close unsubscribes and waits for the handlers running to return, so it
+	// must not be called from the handler.
+	Close() error
+	// Err returns the error the subscription last failed to receive with, nil
+	// once it has reconnected. After the subscription stops on its own, it is
+	// the error that stopped it.
+	Err() error
+}
+
+// SubscribeOptions tune how a subscription delivers its messages.
+type SubscribeOptions struct {
+	// Concurrency is how many messages are handled at once, 1 by default so
+	// that messages are handled in the order they are received.
+	Concurrency int `json:"concurrency"`
+	// OnDisconnect is called when the subscription loses its connection.
+	OnDisconnect func(err error) `json:"-"`
+	// OnReconnect is called once the subscription is connected and subscribed again.
+	OnReconnect func() `json:"-"`
+	// Logger logs the panics of the handler, logging.DefaultLogger by default.
+	Logger logging.ILogger `json:"-"`
+}
+
+func resolveSubscribeOptions(options []*SubscribeOptions) *SubscribeOptions {
+	var o SubscribeOptions
+	if len(options) > 0 && options[0] != nil {
+		o = *options[0]
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 1
+	}
+	if o.Logger == nil {
+		o.Logger = logging.DefaultLogger
+	}
+	return &o
+}
+
+// Subscription delivers the messages a backend receives to a handler, recovering
+// and logging its panics, and implements ISubscription for the backend.
+type Subscription struct {
+	handler func(string, string)
+	options *SubscribeOptions
+	// slots bounds the handlers running at once.
+	slots chan struct{}
+	wg    sync.WaitGroup
+
+	mu           sync.Mutex
+	err          error
+	disconnected bool
+	closed       bool
+	done         chan struct{}
+	unsubscribe  func() error
+}
+
+// NewSubscription returns a subscription delivering messages to handler.
+// unsubscribe, when not nil, releases the resources of the backend on Close.
+func NewSubscription(handler func(string, string), unsubscribe func() error, options ...*SubscribeOptions) *Subscription {
+	o := resolveSubscribeOptions(options)
+	return &Subscription{
+		handler:     handler,
+		options:     o,
+		slots:       make(chan struct{}, o.Concurrency),
+		done:        make(chan struct{}),
+		unsubscribe: unsubscribe,
+	}
+}
+
+// Deliver hands a message to the handler, blocking while Concurrency handlers are running.
+func (s *Subscription) Deliver(channel, message string) {
+	select {
+	case s.slots <- struct{}{}:
+	case <-s.done:
+		return
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		<-s.slots
+		return
+	}
+	s.wg.Add(1)
+	s.mu.Unlock()
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				s.options.Logger.ERROR("mot: subscription handler panicked on channel %s: %v", channel, r)
+			}
+			<-s.slots
+			s.wg.Done()
+		}()
+		s.handler(channel, message)
+	}()
+}
+
+// Disconnected records that receiving failed with err, calling OnDisconnect
+// the first time until Reconnected.
+func (s *Subscription) Disconnected(err error) {
+	s.mu.Lock()
+	first := !s.disconnected
+	s.disconnected = true
+	s.err = err
+	s.mu.Unlock()
+	if first && s.options.OnDisconnect != nil {
+		s.options.OnDisconnect(err)
+	}
+}
+
+// Reconnected records that the subscription is subscribed again, calling
+// OnReconnect when it was disconnected.
+func (s *Subscription) Reconnected() {
+	s.mu.Lock()
+	was := s.disconnected
+	s.disconnected = false
+	s.err = nil
+	s.mu.Unlock()
+	if was && s.options.OnReconnect != nil {
+		s.options.OnReconnect()
+	}
+}
+
+// Stop ends the subscription with err, as when its backend is closed.
+func (s *Subscription) Stop(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	_ = s.Close()
+}
+
+// Done is closed once the subscription is closed.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Subscription) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	s.mu.Unlock()
+
+	var err error
+	if s.unsubscribe != nil {
+		err = s.unsubscribe()
+	}
+	s.wg.Wait()
+	return err
+}
+
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
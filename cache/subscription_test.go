@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubscription_Reconnect(t *testing.T) {
+	var disconnects, reconnects int32
+	sub := NewSubscription(func(string, string) {}, nil, &SubscribeOptions{
+		OnDisconnect: func(err error) { atomic.AddInt32(&disconnects, 1) },
+		OnReconnect:  func() { atomic.AddInt32(&reconnects, 1) },
+	})
+	lost := errors.New("connection reset")
+
+	sub.Reconnected()
+	assert.Equal(t, int32(0), reconnects)
+	sub.Disconnected(lost)
+	sub.Disconnected(lost)
+	assert.Equal(t, int32(1), disconnects)
+	assert.Equal(t, lost, sub.Err())
+	sub.Reconnected()
+	assert.Equal(t, int32(1), reconnects)
+	assert.Nil(t, sub.Err())
+}
+
+func TestSubscription_Concurrency(t *testing.T) {
+	var running, max int32
+	release := make(chan struct{})
+	sub := NewSubscription(func(string, string) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+	}, nil, &SubscribeOptions{Concurrency: 2})
+
+	go func() {
+		for i := 0; i < 4; i++ {
+			sub.Deliver("c", "m")
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&max))
+	close(release)
+	assert.Nil(t, sub.Close())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&running))
+}
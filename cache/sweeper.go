@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultSweepInterval is how often the levels without a sweep interval sweep
+// expired entries once their expirations are subscribed to.
+const DefaultSweepInterval = time.Second
+
+// Sweeper runs the sweeps of a level in the background.
+type Sweeper struct {
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Start calls sweep every interval until Stop, unless it is running already.
+func (s *Sweeper) Start(interval time.Duration, sweep func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop, s.done = make(chan struct{}), make(chan struct{})
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				sweep()
+			}
+		}
+	}(s.stop, s.done)
+}
+
+// Stop stops the sweeps and waits for the one running, if any, to return.
+func (s *Sweeper) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop, s.done = nil, nil
+}
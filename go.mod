@@ -8,9 +8,11 @@ require (
 	github.com/Masterminds/sprig v2.22.0+incompatible
 	github.com/buger/jsonparser v1.0.0
 	github.com/go-redis/redis/v8 v8.0.0-beta.6
+	github.com/golang/snappy v0.0.0-20180518054509-2e65f85255db
 	github.com/google/uuid v1.1.1 // indirect
 	github.com/imdario/mergo v0.3.9 // indirect
 	github.com/json-iterator/go v1.1.10
+	github.com/klauspost/compress v1.11.13
 	github.com/mitchellh/copystructure v1.0.0 // indirect
 	github.com/pkg/errors v0.9.1
 	github.com/sethgrid/pester v1.1.0
@@ -18,6 +20,7 @@ require (
 	github.com/smallnest/rpcx v0.0.0-20200714114247-35b07de0def7
 	github.com/stretchr/testify v1.6.1
 	github.com/syndtr/goleveldb v1.0.0
+	github.com/vmihailenco/msgpack v4.0.4+incompatible
 	golang.org/x/crypto v0.0.0-20200709230013-948cd5f35899
 	google.golang.org/grpc/examples v0.0.0-20200715200837-9fcde86ebe77 // indirect
 	gopkg.in/guregu/null.v4 v4.0.0
@@ -10,6 +10,9 @@ func init() {
 	//extra.SetNamingStrategy(extra.LowerCaseWithUnderscores)
 }
 
+// RawMessage is a raw encoded JSON value, kept as is when marshaling and unmarshaling.
+type RawMessage = jsoniter.RawMessage
+
 func STD() jsoniter.API {
 	return jsoniter.ConfigCompatibleWithStandardLibrary
 }
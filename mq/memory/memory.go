@@ -0,0 +1,521 @@
+package memory
+
+import (
+	"context"
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/logging"
+	"github.com/motclub/common/mq"
+	"github.com/pkg/errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// claimInterval is how often XGroupRead looks for the entries other consumers left pending.
+	claimInterval = 5 * time.Minute
+	// claimMinIdle is how long an entry stays pending before XGroupRead claims it.
+	claimMinIdle = 30 * time.Minute
+)
+
+var (
+	ErrNoStream       = errors.New(`mot: no such stream`)
+	ErrNoGroup        = errors.New(`mot: no such consumer group`)
+	ErrGroupExists    = errors.New(`mot: consumer group name already exists`)
+	ErrValuesRequired = errors.New(`mot: message values required`)
+)
+
+type Options struct {
+	// Logger logs the errors of the callbacks, logging.DefaultLogger by default.
+	Logger logging.ILogger `json:"-"`
+	// Now is the clock entry IDs and idle times are read from, time.Now by
+	// default. Tests set it to move time forward deterministically.
+	Now func() time.Time `json:"-"`
+}
+
+func resolveOptions(options []*Options) *Options {
+	var o Options
+	if len(options) > 0 && options[0] != nil {
+		o = *options[0]
+	}
+	if o.Logger == nil {
+		o.Logger = logging.DefaultLogger
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	return &o
+}
+
+// NewMemoryMessage returns an in-process mq.IMessage with the semantics of
+// Redis streams: increasing entry IDs, consumer groups with their pending
+// entries list, acknowledgements and claims. It suits the tests of consumer
+// group logic and single-node deployments, entries are not persisted.
+func NewMemoryMessage(options ...*Options) mq.IMessage {
+	o := resolveOptions(options)
+	return &memoryMessage{
+		state: &state{
+			streams: make(map[string]*stream),
+			added:   make(chan struct{}),
+			done:    make(chan struct{}),
+		},
+		logger: o.Logger,
+		now:    o.Now,
+	}
+}
+
+// state is shared by the views WithContext returns.
+type state struct {
+	mu      sync.Mutex
+	streams map[string]*stream
+	// added is closed, then replaced, whenever entries are added.
+	added chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+type memoryMessage struct {
+	*state
+	ctx    context.Context
+	logger logging.ILogger
+	now    func() time.Time
+}
+
+func (m *memoryMessage) context() context.Context {
+	if m.ctx != nil {
+		return m.ctx
+	}
+	return context.Background()
+}
+
+func (m *memoryMessage) WithContext(ctx context.Context) mq.IMessage {
+	v := *m
+	v.ctx = ctx
+	return &v
+}
+
+func (m *memoryMessage) Logger() logging.ILogger {
+	return m.logger
+}
+
+// group returns the group of topic, failing like Redis when either is missing.
+func (m *memoryMessage) group(topic, name string) (*stream, *consumerGroup, error) {
+	s, has := m.streams[topic]
+	if !has {
+		return nil, nil, errors.Wrap(ErrNoStream, topic)
+	}
+	g, has := s.groups[name]
+	if !has {
+		return nil, nil, errors.Wrapf(ErrNoGroup, "%s in %s", name, topic)
+	}
+	return s, g, nil
+}
+
+func message(e *entry) *mq.XMessage {
+	values := make(map[string]interface{}, len(e.values))
+	for k, v := range e.values {
+		values[k] = v
+	}
+	return &mq.XMessage{ID: e.id.String(), Values: values}
+}
+
+// XAdd appends an entry to topic, created when missing. Values are stored as
+// the strings Redis would store for them.
+func (m *memoryMessage) XAdd(topic string, values map[string]interface{}) error {
+	if len(values) == 0 {
+		return ErrValuesRequired
+	}
+	fields, err := cache.FormatFields(values)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, has := m.streams[topic]
+	if !has {
+		s = newStream()
+		m.streams[topic] = s
+	}
+	s.add(m.now(), fields)
+	close(m.added)
+	m.added = make(chan struct{})
+	return nil
+}
+
+// wait blocks until entries are added after added was read, and reports false
+// once the context of m is done or the queue closed.
+func (m *memoryMessage) wait(added chan struct{}) bool {
+	select {
+	case <-added:
+		return true
+	case <-m.context().Done():
+		return false
+	case <-m.done:
+		return false
+	}
+}
+
+// delivery is an entry read from a topic.
+type delivery struct {
+	topic string
+	entry *entry
+}
+
+// deliver calls callback with each entry and returns the IDs it handled, by topic.
+func (m *memoryMessage) deliver(deliveries []delivery, callback func(string, *mq.XMessage) error) map[string][]string {
+	handled := make(map[string][]string)
+	for _, d := range deliveries {
+		if err := callback(d.topic, message(d.entry)); err != nil {
+			m.logger.ERROR(err)
+			continue
+		}
+		handled[d.topic] = append(handled[d.topic], d.entry.id.String())
+	}
+	return handled
+}
+
+// XRead delivers the entries added to topics from now on to callback, until
+// the context of m is done or the queue closed.
+func (m *memoryMessage) XRead(topics []string, callback func(string, *mq.XMessage) error) error {
+	if len(topics) == 0 || callback == nil {
+		return nil
+	}
+	cursors := make([]streamID, len(topics))
+	m.mu.Lock()
+	for i, topic := range topics {
+		if s, has := m.streams[topic]; has {
+			cursors[i] = s.last
+		}
+	}
+	m.mu.Unlock()
+	go func() {
+		for {
+			var deliveries []delivery
+			m.mu.Lock()
+			for i, topic := range topics {
+				s, has := m.streams[topic]
+				if !has {
+					continue
+				}
+				for _, e := range s.after(cursors[i]) {
+					deliveries = append(deliveries, delivery{topic: topic, entry: e})
+					cursors[i] = e.id
+				}
+			}
+			added := m.added
+			m.mu.Unlock()
+
+			m.deliver(deliveries, callback)
+			if len(deliveries) == 0 && !m.wait(added) {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// XGroupRead creates group on topics when missing, then delivers the entries
+// added from now on to callback as consumer, acknowledging them once callback
+// returns nil. Every 5 minutes, it claims for consumer the entries of other
+// consumers pending for 30 minutes, as the Redis implementation does.
+func (m *memoryMessage) XGroupRead(topics []string, group, consumer string, callback func(string, *mq.XMessage) error) error {
+	if len(topics) == 0 || group == "" || consumer == "" || callback == nil {
+		return nil
+	}
+	for _, topic := range topics {
+		if err := m.XGroupCreate(topic, group, "$"); err != nil && errors.Cause(err) != ErrGroupExists {
+			return err
+		}
+	}
+	go func() {
+		for {
+			deliveries, added, err := m.readGroup(topics, group, consumer)
+			if err != nil {
+				m.logger.ERROR(err)
+				return
+			}
+			for topic, ids := range m.deliver(deliveries, callback) {
+				_ = m.XGroupAck(topic, group, ids...)
+			}
+			if len(deliveries) == 0 && !m.wait(added) {
+				return
+			}
+		}
+	}()
+	go m.claimLoop(topics, group, consumer)
+	return nil
+}
+
+// readGroup delivers the entries of topics the group has not delivered yet to
+// consumer, adding them to its pending entries.
+func (m *memoryMessage) readGroup(topics []string, name, consumer string) ([]delivery, chan struct{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deliveries []delivery
+	now := m.now()
+	for _, topic := range topics {
+		s, g, err := m.group(topic, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		g.consumers[consumer] = true
+		for _, e := range s.after(g.lastDelivered) {
+			deliveries = append(deliveries, delivery{topic: topic, entry: e})
+			g.pending[e.id] = &pendingEntry{id: e.id, consumer: consumer, deliveredAt: now, deliveries: 1}
+			g.lastDelivered = e.id
+		}
+	}
+	return deliveries, m.added, nil
+}
+
+func (m *memoryMessage) claimLoop(topics []string, group, consumer string) {
+	for {
+		for _, topic := range topics {
+			list, err := m.XGroupPending(topic, group, "-", "+", 10, "")
+			if err != nil {
+				m.logger.ERROR(err)
+				continue
+			}
+			var ids []string
+			for _, item := range list {
+				if item.Consumer != consumer && item.Idle >= claimMinIdle {
+					ids = append(ids, item.ID)
+				}
+			}
+			if len(ids) > 0 {
+				if err := m.XGroupClaim(topic, group, consumer, claimMinIdle, ids...); err != nil {
+					m.logger.ERROR(err)
+				}
+			}
+		}
+		select {
+		case <-m.context().Done():
+			return
+		case <-m.done:
+			return
+		case <-time.After(claimInterval):
+		}
+	}
+}
+
+// XGroupCreate creates group on topic, and topic when missing. The group
+// delivers the entries after start, "$" (the default) meaning the last one.
+func (m *memoryMessage) XGroupCreate(topic, group, start string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, has := m.streams[topic]
+	if !has {
+		s = newStream()
+	}
+	var last streamID
+	if start == "" || start == "$" {
+		last = s.last
+	} else {
+		var err error
+		if last, err = parseID(start, 0); err != nil {
+			return err
+		}
+	}
+	if _, has := s.groups[group]; has {
+		return errors.Wrapf(ErrGroupExists, "%s in %s", group, topic)
+	}
+	m.streams[topic] = s
+	s.groups[group] = &consumerGroup{
+		name:          group,
+		lastDelivered: last,
+		consumers:     make(map[string]bool),
+		pending:       make(map[streamID]*pendingEntry),
+	}
+	return nil
+}
+
+// XGroupDelConsumer removes consumer from group, dropping its pending entries.
+func (m *memoryMessage) XGroupDelConsumer(stream, group, consumer string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, g, err := m.group(stream, group)
+	if err != nil {
+		return err
+	}
+	delete(g.consumers, consumer)
+	for id, p := range g.pending {
+		if p.consumer == consumer {
+			delete(g.pending, id)
+		}
+	}
+	return nil
+}
+
+func (m *memoryMessage) XGroupDestroy(stream, group string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, has := m.streams[stream]
+	if !has {
+		return errors.Wrap(ErrNoStream, stream)
+	}
+	delete(s.groups, group)
+	return nil
+}
+
+// XGroupAck removes ids from the pending entries of group. Like Redis, it
+// ignores the IDs that are not pending, and the missing topics and groups.
+func (m *memoryMessage) XGroupAck(topic, group string, ids ...string) error {
+	parsed := make([]streamID, len(ids))
+	for i, id := range ids {
+		var err error
+		if parsed[i], err = parseID(id, 0); err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, g, err := m.group(topic, group)
+	if err != nil {
+		return nil
+	}
+	for _, id := range parsed {
+		delete(g.pending, id)
+	}
+	return nil
+}
+
+// XGroupPending lists up to count pending entries of group between start and
+// end, of consumer alone unless it is empty.
+func (m *memoryMessage) XGroupPending(topic, group string, start string, end string, count int64, consumer string) (mq.XGroupPendingResult, error) {
+	lo, hi, ok, err := parseRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, g, err := m.group(topic, group)
+	if err != nil || !ok {
+		return nil, err
+	}
+	now := m.now()
+	var result mq.XGroupPendingResult
+	for _, id := range g.pendingIDs() {
+		if count > 0 && int64(len(result)) >= count {
+			break
+		}
+		p := g.pending[id]
+		if id.less(lo) || hi.less(id) || consumer != "" && p.consumer != consumer {
+			continue
+		}
+		result = append(result, mq.XGroupPendingItem{
+			ID:         id.String(),
+			Consumer:   p.consumer,
+			Idle:       now.Sub(p.deliveredAt),
+			RetryCount: p.deliveries,
+		})
+	}
+	return result, nil
+}
+
+// XGroupClaim gives consumer the pending entries of ids idle for minIdle at
+// least, counting a new delivery for each. Like Redis 7, the entries deleted
+// meanwhile are removed from the pending entries instead.
+func (m *memoryMessage) XGroupClaim(topic, group, consumer string, minIdle time.Duration, ids ...string) error {
+	if topic == "" || group == "" || consumer == "" || len(ids) == 0 {
+		return nil
+	}
+	parsed := make([]streamID, len(ids))
+	for i, id := range ids {
+		var err error
+		if parsed[i], err = parseID(id, 0); err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, g, err := m.group(topic, group)
+	if err != nil {
+		return err
+	}
+	now := m.now()
+	for _, id := range parsed {
+		p, has := g.pending[id]
+		if !has || now.Sub(p.deliveredAt) < minIdle {
+			continue
+		}
+		if s.get(id) == nil {
+			delete(g.pending, id)
+			continue
+		}
+		g.consumers[consumer] = true
+		p.consumer = consumer
+		p.deliveredAt = now
+		p.deliveries++
+	}
+	return nil
+}
+
+// XInfoGroups lists the groups of topic, sorted by name.
+func (m *memoryMessage) XInfoGroups(topic string) (mq.XInfoGroupsResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, has := m.streams[topic]
+	if !has {
+		return nil, errors.Wrap(ErrNoStream, topic)
+	}
+	var groups mq.XInfoGroupsResult
+	for _, g := range s.groups {
+		groups = append(groups, mq.XInfoGroupsItem{
+			Name:            g.name,
+			Consumers:       int64(len(g.consumers)),
+			Pending:         int64(len(g.pending)),
+			LastDeliveredID: g.lastDelivered.String(),
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+// XDel deletes the entries of ids from topic. They stay in the pending
+// entries of the groups, as in Redis, until acknowledged or claimed.
+func (m *memoryMessage) XDel(topic string, ids ...string) error {
+	parsed := make([]streamID, len(ids))
+	for i, id := range ids {
+		var err error
+		if parsed[i], err = parseID(id, 0); err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, has := m.streams[topic]; has {
+		for _, id := range parsed {
+			s.del(id)
+		}
+	}
+	return nil
+}
+
+// XRange returns up to count entries of topic between start and end, every
+// one when count is not positive.
+func (m *memoryMessage) XRange(topic, start, end string, count int64) ([]mq.XMessage, error) {
+	lo, hi, ok, err := parseRange(start, end)
+	if err != nil || !ok {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, has := m.streams[topic]
+	if !has {
+		return nil, nil
+	}
+	var messages []mq.XMessage
+	for _, e := range s.entries[s.search(lo):] {
+		if hi.less(e.id) || count > 0 && int64(len(messages)) >= count {
+			break
+		}
+		messages = append(messages, *message(e))
+	}
+	return messages, nil
+}
+
+// XClose stops the readers, the entries stay readable.
+func (m *memoryMessage) XClose() error {
+	m.once.Do(func() { close(m.done) })
+	return nil
+}
@@ -0,0 +1,232 @@
+package memory
+
+import (
+	"context"
+	"github.com/motclub/common/mq"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// clock is a clock tests move forward by hand.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func newTestMessage() (mq.IMessage, *clock) {
+	c := &clock{now: time.Unix(1000, 0)}
+	return NewMemoryMessage(&Options{Now: c.Now}), c
+}
+
+func ids(messages []mq.XMessage) []string {
+	v := make([]string, len(messages))
+	for i, msg := range messages {
+		v[i] = msg.ID
+	}
+	return v
+}
+
+func TestMemoryMessage_XAddXRange(t *testing.T) {
+	m, c := newTestMessage()
+	defer m.XClose()
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, m.XAdd("t", map[string]interface{}{"n": i, "ok": true}))
+	}
+	c.Add(time.Millisecond)
+	assert.Nil(t, m.XAdd("t", map[string]interface{}{"n": 3}))
+	assert.Equal(t, ErrValuesRequired, m.XAdd("t", nil))
+
+	messages, err := m.XRange("t", "-", "+", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1000000-0", "1000000-1", "1000000-2", "1000001-0"}, ids(messages))
+	assert.Equal(t, map[string]interface{}{"n": "0", "ok": "1"}, messages[0].Values)
+
+	messages, _ = m.XRange("t", "(1000000-0", "1000000", 0)
+	assert.Equal(t, []string{"1000000-1", "1000000-2"}, ids(messages))
+	messages, _ = m.XRange("t", "-", "+", 2)
+	assert.Equal(t, []string{"1000000-0", "1000000-1"}, ids(messages))
+	messages, err = m.XRange("missing", "-", "+", 0)
+	assert.Nil(t, err)
+	assert.Len(t, messages, 0)
+	_, err = m.XRange("t", "x", "+", 0)
+	assert.Equal(t, ErrInvalidStreamID, err)
+
+	// IDs keep increasing after deletions, and when the clock goes back
+	assert.Nil(t, m.XDel("t", "1000001-0", "1000000-1"))
+	c.Add(-time.Second)
+	assert.Nil(t, m.XAdd("t", map[string]interface{}{"n": 4}))
+	messages, _ = m.XRange("t", "-", "+", 0)
+	assert.Equal(t, []string{"1000000-0", "1000000-2", "1000001-1"}, ids(messages))
+}
+
+func TestMemoryMessage_XRead(t *testing.T) {
+	m, _ := newTestMessage()
+	defer m.XClose()
+
+	assert.Nil(t, m.XAdd("t", map[string]interface{}{"n": "old"}))
+	received := make(chan string, 10)
+	assert.Nil(t, m.XRead([]string{"t", "u"}, func(topic string, msg *mq.XMessage) error {
+		received <- topic + ":" + msg.Values["n"].(string)
+		return nil
+	}))
+	assert.Nil(t, m.XAdd("u", map[string]interface{}{"n": "1"}))
+	assert.Nil(t, m.XAdd("t", map[string]interface{}{"n": "2"}))
+	var got []string
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-received:
+			got = append(got, msg)
+		case <-time.After(time.Second):
+			t.Fatal("message not delivered")
+		}
+	}
+	assert.ElementsMatch(t, []string{"u:1", "t:2"}, got)
+}
+
+func TestMemoryMessage_ConsumerGroups(t *testing.T) {
+	m, c := newTestMessage()
+	defer m.XClose()
+
+	assert.Nil(t, m.XAdd("t", map[string]interface{}{"n": 0}))
+	assert.Nil(t, m.XGroupCreate("t", "g", "0"))
+	assert.Equal(t, ErrGroupExists, errors.Cause(m.XGroupCreate("t", "g", "$")))
+	_, err := m.XGroupPending("t", "missing", "-", "+", 10, "")
+	assert.Equal(t, ErrNoGroup, errors.Cause(err))
+
+	// a failing callback leaves its entries pending, the others are acknowledged
+	delivered := make(chan string, 10)
+	assert.Nil(t, m.XGroupRead([]string{"t"}, "g", "alice", func(topic string, msg *mq.XMessage) error {
+		delivered <- msg.ID
+		if msg.Values["n"] == "1" {
+			return errors.New("failed")
+		}
+		return nil
+	}))
+	assert.Nil(t, m.XAdd("t", map[string]interface{}{"n": 1}))
+	for i := 0; i < 2; i++ {
+		select {
+		case <-delivered:
+		case <-time.After(time.Second):
+			t.Fatal("message not delivered")
+		}
+	}
+	var pending mq.XGroupPendingResult
+	for i := 0; i < 100; i++ {
+		if pending, err = m.XGroupPending("t", "g", "-", "+", 10, ""); len(pending) == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Nil(t, err)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, "1000000-1", pending[0].ID)
+		assert.Equal(t, "alice", pending[0].Consumer)
+		assert.Equal(t, int64(1), pending[0].RetryCount)
+	}
+
+	// another consumer claims it once idle long enough
+	assert.Nil(t, m.XGroupClaim("t", "g", "bob", time.Minute, "1000000-1"))
+	pending, _ = m.XGroupPending("t", "g", "-", "+", 10, "bob")
+	assert.Len(t, pending, 0)
+	c.Add(2 * time.Minute)
+	pending, _ = m.XGroupPending("t", "g", "-", "+", 10, "")
+	assert.Equal(t, 2*time.Minute, pending[0].Idle)
+	assert.Nil(t, m.XGroupClaim("t", "g", "bob", time.Minute, "1000000-1"))
+	pending, _ = m.XGroupPending("t", "g", "-", "+", 10, "bob")
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, time.Duration(0), pending[0].Idle)
+		assert.Equal(t, int64(2), pending[0].RetryCount)
+	}
+
+	groups, err := m.XInfoGroups("t")
+	assert.Nil(t, err)
+	assert.Equal(t, mq.XInfoGroupsResult{{Name: "g", Consumers: 2, Pending: 1, LastDeliveredID: "1000000-1"}}, groups)
+
+	assert.Nil(t, m.XGroupAck("t", "g", "1000000-1"))
+	pending, _ = m.XGroupPending("t", "g", "-", "+", 10, "")
+	assert.Len(t, pending, 0)
+	assert.Nil(t, m.XGroupDelConsumer("t", "g", "bob"))
+	assert.Nil(t, m.XGroupDestroy("t", "g"))
+	groups, _ = m.XInfoGroups("t")
+	assert.Len(t, groups, 0)
+	_, err = m.XInfoGroups("missing")
+	assert.Equal(t, ErrNoStream, errors.Cause(err))
+}
+
+func TestMemoryMessage_PendingEntries(t *testing.T) {
+	m, c := newTestMessage()
+	defer m.XClose()
+
+	assert.Nil(t, m.XGroupCreate("t", "g", "$"))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, m.XAdd("t", map[string]interface{}{"n": i}))
+	}
+	// readGroup delivers synchronously, without a callback to race with
+	mm := m.(*memoryMessage)
+	deliveries, _, err := mm.readGroup([]string{"t"}, "g", "alice")
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 3)
+	deliveries, _, _ = mm.readGroup([]string{"t"}, "g", "bob")
+	assert.Len(t, deliveries, 0)
+
+	pending, _ := m.XGroupPending("t", "g", "(1000000-0", "+", 1, "alice")
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, "1000000-1", pending[0].ID)
+	}
+
+	// entries deleted while pending are dropped when claimed, as in Redis 7
+	assert.Nil(t, m.XDel("t", "1000000-0"))
+	pending, _ = m.XGroupPending("t", "g", "-", "+", 10, "")
+	assert.Len(t, pending, 3)
+	c.Add(time.Hour)
+	assert.Nil(t, m.XGroupClaim("t", "g", "bob", time.Minute, "1000000-0", "1000000-2", "9-0"))
+	pending, _ = m.XGroupPending("t", "g", "-", "+", 10, "")
+	if assert.Len(t, pending, 2) {
+		assert.Equal(t, "alice", pending[0].Consumer)
+		assert.Equal(t, "bob", pending[1].Consumer)
+	}
+
+	// deleting a consumer drops its pending entries
+	assert.Nil(t, m.XGroupDelConsumer("t", "g", "alice"))
+	pending, _ = m.XGroupPending("t", "g", "-", "+", 10, "")
+	assert.Len(t, pending, 1)
+}
+
+func TestMemoryMessage_WithContext(t *testing.T) {
+	m, _ := newTestMessage()
+	defer m.XClose()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan string, 10)
+	assert.Nil(t, m.WithContext(ctx).XRead([]string{"t"}, func(topic string, msg *mq.XMessage) error {
+		received <- msg.ID
+		return nil
+	}))
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, m.XAdd("t", map[string]interface{}{"n": 1}))
+	select {
+	case id := <-received:
+		t.Fatalf("message %s delivered after the context was canceled", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// the view shares the streams of m
+	messages, _ := m.WithContext(context.Background()).XRange("t", "-", "+", 0)
+	assert.Len(t, messages, 1)
+}
@@ -0,0 +1,186 @@
+package memory
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidStreamID = errors.New(`mot: invalid stream ID specified as stream command argument`)
+
+// streamID is the ID of a stream entry, the milliseconds of its creation and a
+// sequence number among the entries created in the same millisecond.
+type streamID struct {
+	ms  uint64
+	seq uint64
+}
+
+var maxStreamID = streamID{ms: math.MaxUint64, seq: math.MaxUint64}
+
+func (id streamID) String() string {
+	return fmt.Sprintf("%d-%d", id.ms, id.seq)
+}
+
+func (id streamID) less(other streamID) bool {
+	return id.ms < other.ms || id.ms == other.ms && id.seq < other.seq
+}
+
+func (id streamID) next() streamID {
+	if id.seq == math.MaxUint64 {
+		return streamID{ms: id.ms + 1}
+	}
+	return streamID{ms: id.ms, seq: id.seq + 1}
+}
+
+func (id streamID) prev() streamID {
+	if id.seq == 0 {
+		return streamID{ms: id.ms - 1, seq: math.MaxUint64}
+	}
+	return streamID{ms: id.ms, seq: id.seq - 1}
+}
+
+// parseID parses an ID written "ms-seq", or "ms" alone, whose sequence is then seq.
+func parseID(s string, seq uint64) (streamID, error) {
+	msPart, seqPart := s, ""
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		msPart, seqPart = s[:i], s[i+1:]
+	}
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return streamID{}, ErrInvalidStreamID
+	}
+	if seqPart != "" {
+		if seq, err = strconv.ParseUint(seqPart, 10, 64); err != nil {
+			return streamID{}, ErrInvalidStreamID
+		}
+	}
+	return streamID{ms: ms, seq: seq}, nil
+}
+
+// parseRange parses the bounds of XRange and XGroupPending: "-" and "+" are
+// the smallest and greatest IDs, and a bound starting with "(" is exclusive.
+// It reports false when the range is empty.
+func parseRange(start, end string) (streamID, streamID, bool, error) {
+	lo, err := parseBound(start, false)
+	if err != nil {
+		return lo, lo, false, err
+	}
+	hi, err := parseBound(end, true)
+	if err != nil {
+		return lo, hi, false, err
+	}
+	if strings.HasPrefix(start, "(") {
+		if lo == maxStreamID {
+			return lo, hi, false, nil
+		}
+		lo = lo.next()
+	}
+	if strings.HasPrefix(end, "(") {
+		if hi == (streamID{}) {
+			return lo, hi, false, nil
+		}
+		hi = hi.prev()
+	}
+	return lo, hi, !hi.less(lo), nil
+}
+
+func parseBound(s string, end bool) (streamID, error) {
+	switch strings.TrimPrefix(s, "(") {
+	case "-":
+		return streamID{}, nil
+	case "+":
+		return maxStreamID, nil
+	}
+	var seq uint64
+	if end {
+		seq = math.MaxUint64
+	}
+	return parseID(strings.TrimPrefix(s, "("), seq)
+}
+
+type entry struct {
+	id     streamID
+	values map[string]string
+}
+
+// pendingEntry is an entry delivered to a consumer of a group and not acknowledged yet.
+type pendingEntry struct {
+	id          streamID
+	consumer    string
+	deliveredAt time.Time
+	deliveries  int64
+}
+
+type consumerGroup struct {
+	name          string
+	lastDelivered streamID
+	consumers     map[string]bool
+	pending       map[streamID]*pendingEntry
+}
+
+// pendingIDs returns the IDs of the pending entries, sorted.
+func (g *consumerGroup) pendingIDs() []streamID {
+	ids := make([]streamID, 0, len(g.pending))
+	for id := range g.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+	return ids
+}
+
+type stream struct {
+	// entries are sorted by ID.
+	entries []*entry
+	// last is the greatest ID ever added, which deleting entries leaves as is.
+	last   streamID
+	groups map[string]*consumerGroup
+}
+
+func newStream() *stream {
+	return &stream{groups: make(map[string]*consumerGroup)}
+}
+
+// add appends an entry with an ID greater than every ID ever added.
+func (s *stream) add(now time.Time, values map[string]string) *entry {
+	id := streamID{ms: uint64(now.UnixNano() / int64(time.Millisecond))}
+	if !s.last.less(id) {
+		id = s.last.next()
+	}
+	s.last = id
+	e := &entry{id: id, values: values}
+	s.entries = append(s.entries, e)
+	return e
+}
+
+// search returns the index of the first entry whose ID is not less than id.
+func (s *stream) search(id streamID) int {
+	return sort.Search(len(s.entries), func(i int) bool { return !s.entries[i].id.less(id) })
+}
+
+// after returns the entries whose ID is greater than id.
+func (s *stream) after(id streamID) []*entry {
+	if id == maxStreamID {
+		return nil
+	}
+	return s.entries[s.search(id.next()):]
+}
+
+func (s *stream) get(id streamID) *entry {
+	if i := s.search(id); i < len(s.entries) && s.entries[i].id == id {
+		return s.entries[i]
+	}
+	return nil
+}
+
+func (s *stream) del(id streamID) bool {
+	i := s.search(id)
+	if i == len(s.entries) || s.entries[i].id != id {
+		return false
+	}
+	s.entries = append(s.entries[:i], s.entries[i+1:]...)
+	return true
+}
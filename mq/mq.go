@@ -1,6 +1,7 @@
 package mq
 
 import (
+	"context"
 	"github.com/motclub/common/logging"
 	"time"
 )
@@ -45,4 +46,8 @@ type IMessage interface {
 	XDel(topic string, ids ...string) error
 	XRange(topic, start, end string, count int64) ([]XMessage, error)
 	XClose() error
+
+	// WithContext returns a view of the message queue whose operations use
+	// ctx, context.Background() when ctx is nil.
+	WithContext(ctx context.Context) IMessage
 }
@@ -25,15 +25,29 @@ func NewRedisMessage(opts *redis.UniversalOptions, logger logging.ILogger) (mq.I
 
 type redisMessage struct {
 	rdb    redis.UniversalClient
+	ctx    context.Context
 	logger logging.ILogger
 }
 
+func (r *redisMessage) context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+func (r *redisMessage) WithContext(ctx context.Context) mq.IMessage {
+	m := *r
+	m.ctx = ctx
+	return &m
+}
+
 func (r *redisMessage) Logger() logging.ILogger {
 	return r.logger
 }
 
 func (r *redisMessage) XAdd(topic string, values map[string]interface{}) error {
-	res := r.rdb.XAdd(context.Background(), &redis.XAddArgs{
+	res := r.rdb.XAdd(r.context(), &redis.XAddArgs{
 		Stream: topic,
 		ID:     "*",
 		Values: values,
@@ -51,12 +65,15 @@ func (r *redisMessage) XRead(topics []string, callback func(string, *mq.XMessage
 	go func() {
 		for {
 			// block here...
-			cmd := r.rdb.XRead(context.Background(), &redis.XReadArgs{
+			cmd := r.rdb.XRead(r.context(), &redis.XReadArgs{
 				Streams: streams,
 				Block:   0,
 			})
 			result, err := cmd.Result()
 			if err != nil {
+				if r.context().Err() != nil {
+					return
+				}
 				r.logger.ERROR(err)
 				continue
 			}
@@ -96,7 +113,7 @@ func (r *redisMessage) XGroupRead(topics []string, group, consumer string, callb
 	go func() {
 		for {
 			// block here...
-			cmd := r.rdb.XReadGroup(context.Background(), &redis.XReadGroupArgs{
+			cmd := r.rdb.XReadGroup(r.context(), &redis.XReadGroupArgs{
 				Group:    group,
 				Consumer: consumer,
 				Streams:  streams,
@@ -136,7 +153,11 @@ func (r *redisMessage) XGroupRead(topics []string, group, consumer string, callb
 					}
 				}
 			}
-			time.Sleep(5 * time.Minute) // 每5分钟监听一次
+			select {
+			case <-r.context().Done():
+				return
+			case <-time.After(5 * time.Minute): // 每5分钟监听一次
+			}
 		}
 	}()
 	return nil
@@ -168,23 +189,23 @@ func (r *redisMessage) XGroupCreate(topic, group, start string) error {
 	if start == "" {
 		start = "$"
 	}
-	return r.rdb.XGroupCreateMkStream(context.Background(), topic, group, start).Err()
+	return r.rdb.XGroupCreateMkStream(r.context(), topic, group, start).Err()
 }
 
 func (r *redisMessage) XGroupDelConsumer(stream, group, consumer string) error {
-	return r.rdb.XGroupDelConsumer(context.Background(), stream, group, consumer).Err()
+	return r.rdb.XGroupDelConsumer(r.context(), stream, group, consumer).Err()
 }
 
 func (r *redisMessage) XGroupDestroy(stream, group string) error {
-	return r.rdb.XGroupDestroy(context.Background(), stream, group).Err()
+	return r.rdb.XGroupDestroy(r.context(), stream, group).Err()
 }
 
 func (r *redisMessage) XGroupAck(topic, group string, ids ...string) error {
-	return r.rdb.XAck(context.Background(), topic, group, ids...).Err()
+	return r.rdb.XAck(r.context(), topic, group, ids...).Err()
 }
 
 func (r *redisMessage) XGroupPending(topic, group string, start string, end string, count int64, consumer string) (mq.XGroupPendingResult, error) {
-	cmd, err := r.rdb.XPendingExt(context.Background(), &redis.XPendingExtArgs{
+	cmd, err := r.rdb.XPendingExt(r.context(), &redis.XPendingExtArgs{
 		Stream:   topic,
 		Group:    group,
 		Start:    start,
@@ -211,7 +232,7 @@ func (r *redisMessage) XGroupClaim(topic, group, consumer string, minIdle time.D
 	if topic == "" || group == "" || consumer == "" || len(ids) == 0 {
 		return nil
 	}
-	return r.rdb.XClaim(context.Background(), &redis.XClaimArgs{
+	return r.rdb.XClaim(r.context(), &redis.XClaimArgs{
 		Stream:   topic,
 		Group:    group,
 		Consumer: consumer,
@@ -221,7 +242,7 @@ func (r *redisMessage) XGroupClaim(topic, group, consumer string, minIdle time.D
 }
 
 func (r *redisMessage) XInfoGroups(topic string) (mq.XInfoGroupsResult, error) {
-	result, err := r.rdb.XInfoGroups(context.Background(), topic).Result()
+	result, err := r.rdb.XInfoGroups(r.context(), topic).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -238,15 +259,15 @@ func (r *redisMessage) XInfoGroups(topic string) (mq.XInfoGroupsResult, error) {
 }
 
 func (r *redisMessage) XDel(topic string, ids ...string) error {
-	return r.rdb.XDel(context.Background(), topic, ids...).Err()
+	return r.rdb.XDel(r.context(), topic, ids...).Err()
 }
 
 func (r *redisMessage) XRange(topic, start, end string, count int64) ([]mq.XMessage, error) {
 	var cmd *redis.XMessageSliceCmd
 	if count > 0 {
-		cmd = r.rdb.XRangeN(context.Background(), topic, start, end, count)
+		cmd = r.rdb.XRangeN(r.context(), topic, start, end, count)
 	} else {
-		cmd = r.rdb.XRange(context.Background(), topic, start, end)
+		cmd = r.rdb.XRange(r.context(), topic, start, end)
 	}
 	result, err := cmd.Result()
 	if err != nil {
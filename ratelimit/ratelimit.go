@@ -0,0 +1,285 @@
+package ratelimit
+
+import (
+	"github.com/motclub/common/cache"
+	"github.com/pkg/errors"
+	"math"
+	"time"
+)
+
+const keyPrefix = "__MOT_RATELIMIT__:"
+
+var (
+	ErrInvalidScriptReply = errors.New(`mot: invalid rate limit script reply`)
+	ErrStateConflict      = errors.New(`mot: rate limit state kept changing`)
+)
+
+// maxStateRetries bounds the attempts to update a state that other limiters keep changing meanwhile.
+const maxStateRetries = 16
+
+type Result struct {
+	Allowed   bool `json:"allowed"`
+	Limit     int  `json:"limit"`
+	Remaining int  `json:"remaining"`
+	// RetryAfter is how long to wait before the request can be allowed, 0 when it was allowed.
+	RetryAfter time.Duration `json:"retry_after"`
+}
+
+type ILimiter interface {
+	Allow(key string) (*Result, error)
+	AllowN(key string, n int) (*Result, error)
+}
+
+// limiter runs a rate limit algorithm atomically: as a Lua script when the
+// cache can run scripts, see cache.Scripter, or on state kept in the cache and
+// updated with CompareAndSwap otherwise.
+type limiter struct {
+	c     cache.ICache
+	kind  string
+	limit int
+	ttl   time.Duration
+	// script runs the algorithm in the cache, with the arguments args returns.
+	script string
+	args   func(now time.Time, n int) []interface{}
+	// local runs the algorithm on the state newState returns, changing it.
+	newState func() interface{}
+	local    func(state interface{}, now time.Time, n int) *Result
+	scripts  cache.IScripter
+}
+
+func newLimiter(c cache.ICache, kind string, limit int, ttl time.Duration) *limiter {
+	l := &limiter{
+		c:     c,
+		kind:  kind,
+		limit: limit,
+		ttl:   ttl,
+	}
+	if s, ok := cache.Scripter(c); ok {
+		l.scripts = s
+	}
+	return l
+}
+
+func (l *limiter) Allow(key string) (*Result, error) {
+	return l.AllowN(key, 1)
+}
+
+func (l *limiter) AllowN(key string, n int) (*Result, error) {
+	key = keyPrefix + l.kind + ":" + key
+	if l.scripts != nil {
+		reply, err := l.scripts.Eval(l.script, []string{key}, l.args(time.Now(), n)...)
+		if err != nil {
+			return nil, err
+		}
+		return l.parseReply(reply)
+	}
+
+	for i := 0; i < maxStateRetries; i++ {
+		items, err := l.c.MGet(key)
+		if err != nil {
+			return nil, err
+		}
+		state := l.newState()
+		old, has := items[key]
+		if has {
+			if err := old.Bind(state); err != nil {
+				return nil, err
+			}
+		}
+		res := l.local(state, time.Now(), n)
+		var ok bool
+		if has {
+			ok, err = l.c.CompareAndSwap(key, old, state, l.ttl)
+		} else {
+			ok, err = l.c.SetNX(key, state, l.ttl)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return res, nil
+		}
+	}
+	return nil, ErrStateConflict
+}
+
+// parseReply reads the {allowed, remaining, retry after in ms} reply of the scripts.
+func (l *limiter) parseReply(reply interface{}) (*Result, error) {
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 3 {
+		return nil, ErrInvalidScriptReply
+	}
+	var ints [3]int64
+	for i, v := range values {
+		if ints[i], ok = v.(int64); !ok {
+			return nil, ErrInvalidScriptReply
+		}
+	}
+	return &Result{
+		Allowed:    ints[0] == 1,
+		Limit:      l.limit,
+		Remaining:  int(ints[1]),
+		RetryAfter: time.Duration(ints[2]) * time.Millisecond,
+	}, nil
+}
+
+const fixedWindowScript = `
+local count = tonumber(redis.call("get", KEYS[1]) or "0")
+local ttl = redis.call("pttl", KEYS[1])
+local limit = tonumber(ARGV[1])
+local n = tonumber(ARGV[3])
+if count + n > limit then
+	if ttl < 0 then ttl = tonumber(ARGV[2]) end
+	return {0, math.max(limit - count, 0), ttl}
+end
+count = redis.call("incrby", KEYS[1], n)
+if ttl < 0 then redis.call("pexpire", KEYS[1], ARGV[2]) end
+return {1, limit - count, 0}`
+
+// NewFixedWindow allows limit requests per key in each window, starting with the first request.
+func NewFixedWindow(c cache.ICache, limit int, window time.Duration) ILimiter {
+	l := newLimiter(c, "fixed", limit, window)
+	l.script = fixedWindowScript
+	l.args = func(now time.Time, n int) []interface{} {
+		return []interface{}{limit, window.Milliseconds(), n}
+	}
+	type state struct {
+		Count int   `json:"count"`
+		Start int64 `json:"start"`
+	}
+	l.newState = func() interface{} { return new(state) }
+	l.local = func(v interface{}, now time.Time, n int) *Result {
+		s := v.(*state)
+		start := time.Unix(0, s.Start)
+		if s.Start == 0 || !now.Before(start.Add(window)) {
+			s.Count, s.Start, start = 0, now.UnixNano(), now
+		}
+		if s.Count+n > limit {
+			return &Result{
+				Limit:      limit,
+				Remaining:  max(limit-s.Count, 0),
+				RetryAfter: start.Add(window).Sub(now),
+			}
+		}
+		s.Count += n
+		return &Result{Allowed: true, Limit: limit, Remaining: limit - s.Count}
+	}
+	return l
+}
+
+const slidingWindowScript = `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+redis.call("zremrangebyscore", KEYS[1], "-inf", now - window)
+local count = redis.call("zcard", KEYS[1])
+if count + n > limit then
+	local retry = window
+	if n <= limit then
+		local oldest = redis.call("zrange", KEYS[1], count + n - limit - 1, count + n - limit - 1, "withscores")
+		if oldest[2] then retry = tonumber(oldest[2]) + window - now end
+	end
+	return {0, math.max(limit - count, 0), retry}
+end
+for i = 1, n do
+	redis.call("zadd", KEYS[1], now, ARGV[5] .. ":" .. i)
+end
+redis.call("pexpire", KEYS[1], window)
+return {1, limit - count - n, 0}`
+
+// NewSlidingWindow allows limit requests per key in any window ending now, logging the time of each request.
+func NewSlidingWindow(c cache.ICache, limit int, window time.Duration) ILimiter {
+	l := newLimiter(c, "sliding", limit, window)
+	l.script = slidingWindowScript
+	l.args = func(now time.Time, n int) []interface{} {
+		token, _ := cache.NewLockToken()
+		return []interface{}{now.UnixNano() / int64(time.Millisecond), window.Milliseconds(), limit, n, token}
+	}
+	type state struct {
+		// Log holds the times of the requests in the window, in nanoseconds.
+		Log []int64 `json:"log"`
+	}
+	l.newState = func() interface{} { return new(state) }
+	l.local = func(v interface{}, now time.Time, n int) *Result {
+		s := v.(*state)
+		i := 0
+		for i < len(s.Log) && s.Log[i] <= now.Add(-window).UnixNano() {
+			i++
+		}
+		s.Log = s.Log[i:]
+		if len(s.Log)+n > limit {
+			retry := window
+			if n <= limit {
+				retry = time.Unix(0, s.Log[len(s.Log)+n-limit-1]).Add(window).Sub(now)
+			}
+			return &Result{Limit: limit, Remaining: max(limit-len(s.Log), 0), RetryAfter: retry}
+		}
+		for i := 0; i < n; i++ {
+			s.Log = append(s.Log, now.UnixNano())
+		}
+		return &Result{Allowed: true, Limit: limit, Remaining: limit - len(s.Log)}
+	}
+	return l
+}
+
+const tokenBucketScript = `
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local bucket = redis.call("hmget", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1]) or capacity
+local ts = tonumber(bucket[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local retry = 0
+if tokens >= n then
+	tokens = tokens - n
+	allowed = 1
+else
+	retry = math.ceil((n - tokens) / rate)
+end
+redis.call("hmset", KEYS[1], "tokens", tokens, "ts", now)
+redis.call("pexpire", KEYS[1], math.ceil(capacity / rate))
+return {allowed, math.floor(tokens), retry}`
+
+// NewTokenBucket allows bursts of up to burst requests per key, refilling limit tokens every period.
+func NewTokenBucket(c cache.ICache, limit int, period time.Duration, burst int) ILimiter {
+	// rate in tokens per millisecond
+	rate := float64(limit) / float64(period.Milliseconds())
+	l := newLimiter(c, "bucket", burst, time.Duration(float64(burst)/rate)*time.Millisecond)
+	l.script = tokenBucketScript
+	l.args = func(now time.Time, n int) []interface{} {
+		return []interface{}{burst, rate, now.UnixNano() / int64(time.Millisecond), n}
+	}
+	type state struct {
+		Tokens float64 `json:"tokens"`
+		// TS is the time the tokens were counted at, in nanoseconds.
+		TS int64 `json:"ts"`
+	}
+	l.newState = func() interface{} { return new(state) }
+	l.local = func(v interface{}, now time.Time, n int) *Result {
+		s := v.(*state)
+		if s.TS == 0 {
+			s.Tokens, s.TS = float64(burst), now.UnixNano()
+		}
+		elapsed := float64(now.UnixNano()-s.TS) / float64(time.Millisecond)
+		s.Tokens = math.Min(float64(burst), s.Tokens+math.Max(0, elapsed)*rate)
+		s.TS = now.UnixNano()
+		if s.Tokens < float64(n) {
+			retry := math.Ceil((float64(n) - s.Tokens) / rate)
+			return &Result{Limit: burst, Remaining: int(s.Tokens), RetryAfter: time.Duration(retry) * time.Millisecond}
+		}
+		s.Tokens -= float64(n)
+		return &Result{Allowed: true, Limit: burst, Remaining: int(s.Tokens)}
+	}
+	return l
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"github.com/motclub/common/cache"
+	"github.com/motclub/common/cache/breaker"
+	"github.com/motclub/common/cache/memory"
+	"github.com/motclub/common/cache/namespace"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFixedWindow(t *testing.T) {
+	c, _ := memory.NewMemoryCache()
+	l := NewFixedWindow(c, 3, 50*time.Millisecond)
+
+	for i := 2; i >= 0; i-- {
+		res, err := l.Allow("user")
+		assert.Nil(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+	}
+	res, _ := l.Allow("user")
+	assert.False(t, res.Allowed)
+	assert.True(t, res.RetryAfter > 0 && res.RetryAfter <= 50*time.Millisecond)
+
+	res, _ = l.Allow("other")
+	assert.True(t, res.Allowed)
+
+	time.Sleep(60 * time.Millisecond)
+	res, _ = l.Allow("user")
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 2, res.Remaining)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	c, _ := memory.NewMemoryCache()
+	l := NewSlidingWindow(c, 2, 50*time.Millisecond)
+
+	res, _ := l.AllowN("user", 2)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	res, _ = l.Allow("user")
+	assert.False(t, res.Allowed)
+	assert.True(t, res.RetryAfter > 0)
+
+	time.Sleep(res.RetryAfter + 5*time.Millisecond)
+	res, _ = l.Allow("user")
+	assert.True(t, res.Allowed)
+}
+
+func TestTokenBucket(t *testing.T) {
+	c, _ := memory.NewMemoryCache()
+	l := NewTokenBucket(c, 10, 100*time.Millisecond, 5)
+
+	res, _ := l.AllowN("user", 5)
+	assert.True(t, res.Allowed)
+	res, _ = l.Allow("user")
+	assert.False(t, res.Allowed)
+	assert.True(t, res.RetryAfter > 0 && res.RetryAfter <= 10*time.Millisecond)
+
+	time.Sleep(25 * time.Millisecond)
+	res, _ = l.AllowN("user", 2)
+	assert.True(t, res.Allowed)
+}
+
+func TestLimiter_SharedState(t *testing.T) {
+	c, _ := memory.NewMemoryCache()
+	l1 := NewFixedWindow(c, 100, time.Minute)
+	l2 := NewFixedWindow(c, 100, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(l ILimiter) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				res, err := l.Allow("user")
+				assert.Nil(t, err)
+				assert.True(t, res.Allowed)
+			}
+		}([]ILimiter{l1, l2}[i%2])
+	}
+	wg.Wait()
+
+	// both limiters count on the state kept in the cache
+	res, err := l1.Allow("user")
+	assert.Nil(t, err)
+	assert.Equal(t, 49, res.Remaining)
+	assert.True(t, c.Has(keyPrefix+"fixed:user"))
+}
+
+type recordingScripter struct {
+	cache.ICache
+	keys []string
+}
+
+func (s *recordingScripter) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	s.keys = append(s.keys, keys...)
+	return []interface{}{int64(1), int64(2), int64(0)}, nil
+}
+
+func TestLimiter_Scripter(t *testing.T) {
+	mc, _ := memory.NewMemoryCache()
+	s := &recordingScripter{ICache: mc}
+	c, err := namespace.NewNamespaceCache(breaker.NewBreakerCache(s), "app")
+	assert.Nil(t, err)
+
+	// the script runs through the wrappers, on the key of the namespace
+	res, err := NewFixedWindow(c, 3, time.Minute).Allow("user")
+	assert.Nil(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 2, res.Remaining)
+	assert.Equal(t, []string{"app:" + keyPrefix + "fixed:user"}, s.keys)
+}